@@ -5,14 +5,20 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/cmdutil"
 	"github.com/mscno/uptask/internal/slogger"
 	"github.com/mscno/uptask/uptaskhttp"
+	"github.com/mscno/uptask/uptaskmetrics"
 	"log/slog"
 	"math/rand/v2"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -117,47 +123,69 @@ func main() {
 		fmt.Println("JOB_URL environment variable is required")
 		os.Exit(1)
 	}
-	redisUrl := os.Getenv("REDIS_URL")
-	if redisUrl == "" {
-		fmt.Println("REDIS_URL environment variable is required")
-		os.Exit(1)
-	}
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-	if redisPassword == "" {
-		fmt.Println("REDIS_PASSWORD environment variable is required")
-		os.Exit(1)
-	}
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
-	}
+	redisUrl := flag.String("redis-url", os.Getenv("REDIS_URL"), "Redis host or URL, such as redis+cluster://host:6379")
+	namespace := flag.String("namespace", os.Getenv("UPTASK_NAMESPACE"), "Namespace of the task store keys")
+	flag.Parse()
 
 	mux := http.NewServeMux()
-	transport, err := uptask.NewUpstashTransport(qstashToken, jobUrl)
+	transport, err := uptask.NewUpstashTransport(qstashToken, jobUrl, uptask.WithDlq(strings.TrimSuffix(jobUrl, "/")+"/dlq"))
 	if err != nil {
 		panic(err)
 	}
-	store, err := uptask.NewRedisTaskStore(uptask.RedisConfig{
-		Addr:     fmt.Sprintf("%s:%s", redisUrl, redisPort),
-		Username: "default",
-		Password: redisPassword,
-		Secure:   true,
-	})
+	store, err := cmdutil.NewRedisStore(*redisUrl, *namespace)
 	if err != nil {
 		fmt.Println("Failed to create Redis task store", err)
 		os.Exit(1)
 	}
-	service := uptask.NewTaskService(transport, uptask.WithStore(store), uptask.WithLogger(l))
+	metrics := uptaskmetrics.New()
+	service := uptask.NewTaskService(transport, uptask.WithStore(store), uptask.WithLogger(l), uptask.WithHooks(metrics.Hooks()))
 	uptask.AddTaskHandler[DummyTask](service, &DummyTaskProcessor{})
-	mux.HandleFunc("POST /", uptaskhttp.HandleTasks(service))
+	router := uptaskhttp.NewRouter(service,
+		uptaskhttp.WithSigningKeys(qstashSigningKey, os.Getenv("QSTASH_NEXT_SIGNING_KEY")),
+		uptaskhttp.WithRouterDlq("/dlq", uptask.NewDlqStore(store)),
+	)
+	mux.Handle("POST /tasks/", router)
+	mux.Handle("POST /events/", router)
+	mux.Handle("POST /dlq/", router)
+	api := uptaskhttp.NewTaskApi(service.Client(), store, uptaskhttp.WithKinds(service))
+	dashboard := uptaskhttp.Dashboard(store, service.Client(), uptaskhttp.WithDashboardPath("/dashboard"), uptaskhttp.WithDashboardKinds(service))
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		mux.Handle(method+" /admin/", http.StripPrefix("/admin", api.Handler()))
+		mux.Handle(method+" /dashboard/", dashboard)
+	}
+	mux.Handle("GET /dashboard", dashboard)
+	mux.HandleFunc("GET /admin/changes", uptaskhttp.HandleTaskChanges(store))
+	health := uptaskhttp.Health(service)
+	mux.Handle("GET /livez", health)
+	mux.Handle("GET /readyz", health)
+	mux.Handle("GET /metrics", metrics.Handler())
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 		w.Write(bytes.NewBufferString("Hello World").Bytes())
 	})
+
+	// On SIGTERM, fail readiness and let running tasks finish before stopping
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":8180", Handler: mux}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := service.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to drain tasks", "error", err)
+		}
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to shut down server", "error", err)
+		}
+	}()
 	fmt.Println("Starting server on :8180")
-	err = http.ListenAndServe(":8180", mux)
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
 		fmt.Println("Failed to start server", err)
 		os.Exit(1)
 	}
+	<-stopped
 }
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/cmdutil"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -31,6 +34,15 @@ type model struct {
 	filterStatus *uptask.TaskStatus
 	taskStore    *uptask.RedisTaskStore
 
+	stats *uptask.TaskStats
+
+	// changes receives the changes of the stored tasks, refreshing the view live.
+	changes <-chan uptask.TaskChange
+
+	// cursors holds the cursor of every page up to the current one, the first page
+	// having an empty cursor.
+	cursors []string
+
 	err error
 }
 
@@ -61,6 +73,17 @@ var Color = Theme{
 
 type FetchMsg struct{}
 
+// ChangeMsg is sent when stored tasks changed.
+type ChangeMsg struct {
+	TaskIDs map[string]bool
+}
+
+// changeDebounce is how long changes are collected before the view is refreshed, so
+// bursts of changes refresh it once.
+const changeDebounce = 250 * time.Millisecond
+
+const pageSize = 100
+
 var _ tea.Model = (*model)(nil)
 
 func main() {
@@ -79,26 +102,10 @@ func initializeModel() *model {
 		fmt.Println("QSTASH_TOKEN environment variable is required")
 		os.Exit(1)
 	}
-	redisUrl := os.Getenv("REDIS_URL")
-	if redisUrl == "" {
-		fmt.Println("REDIS_URL environment variable is required")
-		os.Exit(1)
-	}
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-	if redisPassword == "" {
-		fmt.Println("REDIS_PASSWORD environment variable is required")
-		os.Exit(1)
-	}
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
-	}
-	store, err := uptask.NewRedisTaskStore(uptask.RedisConfig{
-		Addr:     fmt.Sprintf("%s:%s", redisUrl, redisPort),
-		Username: "default",
-		Password: redisPassword,
-		Secure:   true,
-	})
+	redisUrl := flag.String("redis-url", os.Getenv("REDIS_URL"), "Redis host or URL, such as redis+cluster://host:6379")
+	namespace := flag.String("namespace", os.Getenv("UPTASK_NAMESPACE"), "Namespace of the task store keys")
+	flag.Parse()
+	store, err := cmdutil.NewRedisStore(*redisUrl, *namespace)
 	if err != nil {
 		fmt.Println("Failed to create task store", err)
 		os.Exit(1)
@@ -113,6 +120,7 @@ func initializeModel() *model {
 		uptask.TaskStatusRunning,
 		uptask.TaskStatusSuccess,
 		uptask.TaskStatusFailed,
+		uptask.TaskStatusCancelled,
 	}
 
 	tableStyle := table.DefaultStyles()
@@ -126,6 +134,7 @@ func initializeModel() *model {
 			{Title: "Status", Width: 12},
 			{Title: "Retries", Width: 8},
 			{Title: "Queue", Width: 10},
+			{Title: "Tags", Width: 20},
 			{Title: "Created At", Width: 35},
 			{Title: "Scheduled At", Width: 35},
 		}),
@@ -142,8 +151,10 @@ func initializeModel() *model {
 		tab:          0,
 		tableHeight:  tableHeight,
 		filterStatus: &tabs[0],
+		cursors:      []string{""},
 		tasksTable:   t,
 		taskStore:    store, /* Initialize uptask store */
+		changes:      store.Watch(context.Background(), uptask.TaskFilter{}),
 	}
 }
 
@@ -156,7 +167,8 @@ func (m *model) fetchTasks() {
 	}
 	tasks, err := m.taskStore.ListTaskExecutions(ctx, uptask.TaskFilter{
 		Status: filterStatus,
-		Limit:  100,
+		Limit:  pageSize,
+		Cursor: m.cursors[len(m.cursors)-1],
 	})
 	if err != nil {
 		m.err = err
@@ -165,6 +177,13 @@ func (m *model) fetchTasks() {
 
 	m.tasks = tasks
 	m.updateTable()
+
+	stats, err := m.taskStore.Stats(ctx, uptask.StatsQuery{})
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.stats = stats
 }
 
 func (m *model) setActiveTask(taskID string) {
@@ -188,6 +207,7 @@ func (m *model) updateTable() {
 			status,
 			fmt.Sprintf("%d/%d", task.Retried, task.MaxRetries),
 			task.Queue,
+			strings.Join(task.Tags, ","),
 			dashIfZeroTimeAgo(task.CreatedAt),
 			dashIfZeroTimeScheduled(task.ScheduledAt),
 		}
@@ -206,6 +226,15 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		//m.tasksTable.SetHeight(m.tableHeight)
 	case FetchMsg:
 		m.fetchTasks()
+	case ChangeMsg:
+		m.fetchTasks()
+		if m.activeTask != nil && msg.TaskIDs[m.activeTask.ID] {
+			// Keep showing the last state of deleted tasks
+			if task, err := m.taskStore.GetTaskExecution(context.Background(), m.activeTask.ID); err == nil {
+				m.activeTask = task
+			}
+		}
+		return m, m.waitForChange()
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "esc", "backspace":
@@ -243,7 +272,20 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "tab": // Navigate to the next tab
 			m.tab = (m.tab + 1) % len(m.tabs)
 			m.filterStatus = &m.tabs[m.tab]
+			m.cursors = []string{""}
 			m.fetchTasks() // Fetch tasks for the new status
+		case "n", "right": // Next page
+			if len(m.tasks) == pageSize {
+				m.cursors = append(m.cursors, uptask.NextTaskCursor(m.tasks))
+				m.fetchTasks()
+				m.tasksTable.GotoTop()
+			}
+		case "p", "left": // Previous page
+			if len(m.cursors) > 1 {
+				m.cursors = m.cursors[:len(m.cursors)-1]
+				m.fetchTasks()
+				m.tasksTable.GotoTop()
+			}
 		case "q", "ctrl+c": // Quit
 			return m, tea.Quit
 		case "enter":
@@ -266,8 +308,33 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) Init() tea.Cmd {
-	return func() tea.Msg {
+	return tea.Batch(func() tea.Msg {
 		return FetchMsg{}
+	}, m.waitForChange())
+}
+
+// waitForChange waits for the next changes of the stored tasks, collecting those that
+// follow within changeDebounce into a single ChangeMsg.
+func (m *model) waitForChange() tea.Cmd {
+	changes := m.changes
+	return func() tea.Msg {
+		change, ok := <-changes
+		if !ok {
+			return nil
+		}
+		msg := ChangeMsg{TaskIDs: map[string]bool{change.TaskID: true}}
+		timeout := time.After(changeDebounce)
+		for {
+			select {
+			case change, ok := <-changes:
+				if !ok {
+					return msg
+				}
+				msg.TaskIDs[change.TaskID] = true
+			case <-timeout:
+				return msg
+			}
+		}
 	}
 }
 
@@ -302,10 +369,21 @@ func (m model) View() string {
 func (m model) viewHeader() string {
 	var tabs []string
 	for i, status := range m.tabs {
+		label := string(status)
+		if m.stats != nil {
+			count := m.stats.ByStatus[status]
+			if status == "ALL" {
+				count = 0
+				for _, n := range m.stats.ByStatus {
+					count += n
+				}
+			}
+			label = fmt.Sprintf("%s (%d)", status, count)
+		}
 		if i == m.tab {
-			tabs = append(tabs, activeTabStyle.Render(string(status)))
+			tabs = append(tabs, activeTabStyle.Render(label))
 		} else {
-			tabs = append(tabs, tabStyle.Render(string(status)))
+			tabs = append(tabs, tabStyle.Render(label))
 		}
 	}
 
@@ -317,11 +395,19 @@ func (m model) viewHeader() string {
 	if m.lastUpdate.IsZero() {
 		lastUpdated = subtleTextStyle.Render("Last updated: N/A")
 	}
+	page := subtleTextStyle.Render(fmt.Sprintf("Page %d (n/p to page)", len(m.cursors)))
+	summary := subtleTextStyle.Render("Last 24h: N/A")
+	if m.stats != nil {
+		summary = subtleTextStyle.Render(fmt.Sprintf("Last 24h: %d succeeded, %d failed (%.1f%% success), duration p95 %s, queue lag p95 %s",
+			m.stats.Succeeded, m.stats.Failed, m.stats.SuccessRate*100, m.stats.Duration.P95.Round(time.Millisecond), m.stats.QueueLag.P95.Round(time.Second)))
+	}
 	// Return the combined header with tabs and the last updated time
 	return lipgloss.JoinVertical(lipgloss.Top,
 		headerStyle.Render("Task Viewer"), // Header Title
 		tabsRow,                           // Rendered tabs
 		lastUpdated,                       // Metadata row
+		summary,
+		page,
 	)
 }
 
@@ -340,6 +426,7 @@ func (m model) viewTask() string {
 	status := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Status:"), valueStyle.Render(renderStatus(m.activeTask.Status)))
 	retried := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Retried:"), valueStyle.Render(fmt.Sprintf("%d/%d", m.activeTask.Retried, m.activeTask.MaxRetries)))
 	queue := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Queue:"), valueStyle.Render(m.activeTask.Queue))
+	tags := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Tags:"), valueStyle.Render(strings.Join(m.activeTask.Tags, ", ")))
 	createdAt := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Created At:"), valueStyle.Render(dashIfZeroTimeAgo(m.activeTask.CreatedAt)))
 	attemptedAt := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Attempted At:"), valueStyle.Render(dashIfZeroTimeAgo(m.activeTask.AttemptedAt)))
 	scheduledAt := lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Scheduled At:"), valueStyle.Render(dashIfZeroTimeScheduled(m.activeTask.ScheduledAt)))
@@ -381,6 +468,7 @@ func (m model) viewTask() string {
 		status,
 		retried,
 		queue,
+		tags,
 		createdAt,
 		attemptedAt,
 		scheduledAt,
@@ -402,6 +490,8 @@ func renderStatus(status uptask.TaskStatus) string {
 		return lipgloss.NewStyle().Foreground(Color.Green).Render(string(status))
 	case uptask.TaskStatusFailed:
 		return lipgloss.NewStyle().Foreground(Color.Red).Render(string(status))
+	case uptask.TaskStatusCancelled:
+		return lipgloss.NewStyle().Foreground(Color.Secondary).Render(string(status))
 	default:
 		return string(status)
 	}
@@ -416,6 +506,8 @@ func renderStatust(status uptask.TaskStatus) string {
 		return fmt.Sprintf("✅  %s", status) // Symbol for success
 	case uptask.TaskStatusFailed:
 		return fmt.Sprintf("❌  %s", status) // Symbol for failed
+	case uptask.TaskStatusCancelled:
+		return fmt.Sprintf("🚫  %s", status) // Symbol for cancelled
 	default:
 		return string(status)
 	}
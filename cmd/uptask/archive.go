@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/cmdutil"
+)
+
+const archiveUsage = "Usage: uptask archive import [-sqlite <file> | -redis-url <url>] [-namespace <ns>] <path>"
+
+// archive runs the archive subcommands.
+func archive(args []string) error {
+	if len(args) < 1 || args[0] != "import" {
+		return errors.New(archiveUsage)
+	}
+
+	fs := flag.NewFlagSet("archive import", flag.ContinueOnError)
+	sqlitePath := fs.String("sqlite", "uptask-archive.db", "SQLite database to import into")
+	redisUrl := fs.String("redis-url", "", "Redis host or URL to import into instead, such as redis+cluster://host:6379")
+	namespace := fs.String("namespace", os.Getenv("UPTASK_NAMESPACE"), "Namespace of the Redis task store keys")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(archiveUsage)
+	}
+
+	var store uptask.TaskStore
+	if *redisUrl != "" {
+		redisStore, err := cmdutil.NewRedisStore(*redisUrl, *namespace)
+		if err != nil {
+			return err
+		}
+		store = redisStore
+	} else {
+		sqliteStore, err := uptask.NewSQLiteTaskStore(*sqlitePath)
+		if err != nil {
+			return err
+		}
+		defer sqliteStore.Close()
+		store = sqliteStore
+	}
+
+	imported, err := uptask.ImportArchive(context.Background(), store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d tasks\n", imported)
+	return nil
+}
@@ -37,7 +37,12 @@ type QJobsConfig struct {
 }
 
 func main() {
-	err := process()
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		err = archive(os.Args[2:])
+	} else {
+		err = process()
+	}
 	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
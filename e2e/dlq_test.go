@@ -65,7 +65,7 @@ type dummyDlqStore struct {
 	events []cloudevents.Event
 }
 
-func (ds *dummyDlqStore) StoreDlqEvent(event cloudevents.Event) error {
+func (ds *dummyDlqStore) StoreDlqEvent(ctx context.Context, event cloudevents.Event, letter uptask.DeadLetter) error {
 	defer ds.wg.Done()
 	ds.mux.Lock()
 	defer ds.mux.Unlock()
@@ -2,6 +2,8 @@ package uptask
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -48,16 +50,63 @@ type Event TaskArgs
 //	}
 //}
 
-func AddEventHandler[E Event](service *TaskService, handlerName string, handler EventHandler[E]) {
-	if err := AddEventHandlerSafely(service, handlerName, handler); err != nil {
+// AddEventHandler registers handler for the events of kind E published by this service
+// or, through a SubscriptionRegistry, by other services. When the service has a store,
+// events published elsewhere get an execution in it on their first delivery.
+func AddEventHandler[E Event](service *TaskService, handlerName string, handler EventHandler[E], opts ...HandlerOption) {
+	if err := AddEventHandlerSafely(service, handlerName, handler, opts...); err != nil {
 		panic(err)
 	}
 }
 
-func AddEventHandlerSafely[E Event](service *TaskService, handlerName string, handler EventHandler[E]) error {
+func AddEventHandlerSafely[E Event](service *TaskService, handlerName string, handler EventHandler[E], opts ...HandlerOption) error {
 	var event E
 	var task = TaskEventGen[E]{event, handlerName}
-	return service.addTask(task, handlerName, &taskUnitFactoryWrapper[E]{tasker: &taskEventHandler[E]{handler}})
+	cfg := newHandlerConfig(opts)
+	cfg.event = true
+	if filter, ok := handler.(EventFilter[E]); ok {
+		cfg.filter = newEventFilterFunc(filter)
+	}
+	err := service.addTask(task, handlerName, &taskUnitFactoryWrapper[E]{tasker: &taskEventHandler[E]{handler}, upcasters: cfg.upcasters}, cfg)
+	if err != nil {
+		return err
+	}
+
+	service.mux.Lock()
+	defer service.mux.Unlock()
+	service.subscriptions = append(service.subscriptions, Subscription{
+		Handler:    handlerName,
+		EventKind:  event.Kind(),
+		Patterns:   cfg.patterns,
+		InsertOpts: cfg.insertOpts,
+	})
+	return nil
+}
+
+func newEventFilterFunc[E Event](filter EventFilter[E]) eventFilterFunc {
+	return func(event Event, opts *InsertOpts) (bool, error) {
+		container := &Container[E]{
+			CreatedAt: time.Now(),
+			EventKind: event.Kind(),
+		}
+		if opts != nil {
+			container.InsertOpts = *opts
+		}
+		if e, ok := event.(E); ok {
+			container.Args = e
+		} else {
+			// The event is of another type matched by a pattern, decode it the
+			// same way the handler will.
+			data, err := json.Marshal(event)
+			if err != nil {
+				return false, fmt.Errorf("failed to marshal event: %w", err)
+			}
+			if err := json.Unmarshal(data, &container.Args); err != nil {
+				return false, fmt.Errorf("failed to unmarshal event: %w", err)
+			}
+		}
+		return filter.Filter(container), nil
+	}
 }
 
 type taskEventHandler[E Event] struct {
@@ -0,0 +1,277 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mscno/uptask/internal/events"
+	"golang.org/x/sync/errgroup"
+)
+
+// fanoutNamespace is the namespace of the deterministic IDs given to the tasks
+// started by the fan-out worker.
+var fanoutNamespace = uuid.MustParse("6f1b7c5e-2a43-4d8e-9a57-0c3e1f2b8d41")
+
+type EventFanoutArgs struct {
+	// Handlers are the task kinds of local handlers. Kept so that fan-out tasks
+	// enqueued before Subscribers was introduced are still delivered.
+	Handlers  []string
+	EventType string
+	Payload   any
+	// EventVersion is the version of the published event, see Versioned.
+	EventVersion int `json:",omitempty"`
+	// Subscribers are the handlers to deliver the event to, both local and
+	// registered by other services.
+	Subscribers []Subscription `json:",omitempty"`
+}
+
+func (e EventFanoutArgs) Kind() string {
+	return "_UptaskFanoutTask"
+}
+
+type EventFanoutWorker struct {
+	c *TaskClient
+	TaskHandlerDefaults[EventFanoutArgs]
+}
+
+type TaskEvent struct {
+	PayloadData any
+	EventType   string
+	// PublishedKind is the kind of the event that was published.
+	PublishedKind string
+	// PublishedVersion is the version of the event that was published.
+	PublishedVersion int
+}
+
+func (e TaskEvent) Kind() string {
+	return e.EventType
+}
+
+func (e TaskEvent) Payload() any {
+	return e.PayloadData
+}
+
+func (e TaskEvent) Version() int {
+	return e.PublishedVersion
+}
+
+func (e TaskEvent) Extensions() map[string]string {
+	if e.PublishedKind == "" {
+		return nil
+	}
+	return map[string]string{events.EventKindExtension: e.PublishedKind}
+}
+
+type TaskEventGen[T Event] struct {
+	Event       T
+	HandlerName string
+}
+
+func (e TaskEventGen[T]) Kind() string {
+	return fmt.Sprintf("%s/%s", e.HandlerName, e.Event.Kind())
+}
+
+// Dispatch statuses recorded for each subscriber of a fan-out task.
+const (
+	DispatchStatusDispatched = "DISPATCHED"
+	DispatchStatusSkipped    = "SKIPPED"
+	DispatchStatusFailed     = "FAILED"
+)
+
+// FanoutDispatch is the outcome of delivering an event to a single subscriber.
+type FanoutDispatch struct {
+	Subscription Subscription `json:"subscription"`
+	TaskID       string       `json:"task_id"`
+	Status       string       `json:"status"`
+	Error        string       `json:"error,omitempty"`
+}
+
+// FanoutTaskID returns the ID of the task started for sub by the fan-out task with
+// ID fanoutID. The ID is stable, so a retried fan-out task never enqueues the same
+// subscriber twice.
+func FanoutTaskID(fanoutID string, sub Subscription) string {
+	return uuid.NewSHA1(fanoutNamespace, []byte(fanoutID+"|"+sub.TargetUrl+"|"+sub.TaskKind())).String()
+}
+
+// fanoutError is returned when the event could not be delivered to some subscribers.
+// Its details are recorded on the fan-out task execution.
+type fanoutError struct {
+	dispatches []FanoutDispatch
+}
+
+func (e *fanoutError) Error() string {
+	var failed []string
+	for _, d := range e.dispatches {
+		if d.Status == DispatchStatusFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", d.Subscription.TaskKind(), d.Error))
+		}
+	}
+	return fmt.Sprintf("failed to dispatch event to %d subscriber(s): %s", len(failed), strings.Join(failed, "; "))
+}
+
+func (e *fanoutError) Details() map[string]interface{} {
+	return map[string]interface{}{"dispatches": e.dispatches}
+}
+
+func (w *EventFanoutWorker) ProcessTask(ctx context.Context, task *Container[EventFanoutArgs]) error {
+	subscribers := task.Args.Subscribers
+	for _, handlerKind := range task.Args.Handlers {
+		parts := strings.SplitN(handlerKind, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		subscribers = append(subscribers, Subscription{Handler: parts[0], EventKind: parts[1]})
+	}
+
+	var (
+		errGroup   errgroup.Group
+		mux        sync.Mutex
+		dispatches = make([]FanoutDispatch, 0, len(subscribers))
+		failed     bool
+	)
+	for _, sub := range subscribers {
+		errGroup.Go(func() error {
+			dispatch := w.dispatch(ctx, task, sub)
+			mux.Lock()
+			defer mux.Unlock()
+			dispatches = append(dispatches, dispatch)
+			failed = failed || dispatch.Status == DispatchStatusFailed
+			return nil
+		})
+	}
+	_ = errGroup.Wait()
+
+	sort.Slice(dispatches, func(i, j int) bool {
+		return dispatches[i].TaskID < dispatches[j].TaskID
+	})
+	for _, d := range dispatches {
+		w.c.log.Debug("event dispatched", "event", task.Args.EventType, "handler", d.Subscription.TaskKind(), "target", d.Subscription.TargetUrl, "id", d.TaskID, "status", d.Status)
+	}
+	if w.c.storeEnabled {
+		w.recordDispatches(context.WithoutCancel(ctx), task.Id, dispatches)
+	}
+
+	if failed {
+		return &fanoutError{dispatches: dispatches}
+	}
+	return nil
+}
+
+// recordDispatches records the outcome of every subscriber on the execution of the
+// fan-out task.
+func (w *EventFanoutWorker) recordDispatches(ctx context.Context, taskID string, dispatches []FanoutDispatch) {
+	execution, err := w.c.store.GetTaskExecution(ctx, taskID)
+	if err != nil {
+		w.c.log.Error("failed to get fan-out task", "id", taskID, "error", err)
+		return
+	}
+	execution.Dispatches = dispatches
+	if err := w.c.store.CreateTaskExecution(ctx, execution); err != nil {
+		w.c.log.Error("failed to record fan-out dispatches", "id", taskID, "error", err)
+	}
+}
+
+// dispatch starts the task for a single subscriber, unless a previous attempt of the
+// fan-out task already did.
+func (w *EventFanoutWorker) dispatch(ctx context.Context, task *Container[EventFanoutArgs], sub Subscription) FanoutDispatch {
+	dispatch := FanoutDispatch{
+		Subscription: sub,
+		TaskID:       FanoutTaskID(task.Id, sub),
+		Status:       DispatchStatusDispatched,
+	}
+
+	// A child still pending may have been created by an attempt that stopped before
+	// sending it, so it is sent again, and the transport drops the duplicates by ID,
+	// as QStash does with Upstash-Deduplication-Id. Children past pending were sent.
+	if w.c.storeEnabled {
+		if exists, err := w.c.store.TaskExists(ctx, dispatch.TaskID); err == nil && exists {
+			child, err := w.c.store.GetTaskExecution(ctx, dispatch.TaskID)
+			if err == nil && child.Status != TaskStatusPending {
+				dispatch.Status = DispatchStatusSkipped
+				return dispatch
+			}
+		}
+	}
+
+	opts := &InsertOpts{
+		MaxRetries:  task.InsertOpts.MaxRetries,
+		Queue:       task.InsertOpts.Queue,
+		ScheduledAt: task.InsertOpts.ScheduledAt,
+		Tags:        task.InsertOpts.Tags,
+	}
+	opts = opts.merge(sub.InsertOpts)
+	opts.targetUrl = sub.TargetUrl
+	opts.id = dispatch.TaskID
+	opts.parentID = task.Id
+
+	eventTask := TaskEvent{
+		PayloadData:      task.Args.Payload,
+		EventType:        sub.TaskKind(),
+		PublishedKind:    task.Args.EventType,
+		PublishedVersion: task.Args.EventVersion,
+	}
+	_, err := w.c.StartTask(ctx, eventTask, opts)
+	if err != nil {
+		dispatch.Status = DispatchStatusFailed
+		dispatch.Error = err.Error()
+	}
+	return dispatch
+}
+
+// PublishEvent starts a fan-out task delivering event to every handler subscribed to
+// its kind, both in this service and, when a SubscriptionRegistry is configured, in
+// other services. Local handlers implementing EventFilter are skipped if their filter
+// rejects the event; if every handler rejects it no task is started and the returned
+// ID is empty.
+func (c *TaskService) PublishEvent(ctx context.Context, event Event, opts *InsertOpts) (string, error) {
+	type candidate struct {
+		sub    Subscription
+		filter eventFilterFunc
+	}
+	var candidates []candidate
+	c.mux.Lock()
+	for _, sub := range c.subscriptions {
+		if sub.Matches(event.Kind()) {
+			candidates = append(candidates, candidate{sub, c.handlersMap[sub.TaskKind()].config.filter})
+		}
+	}
+	c.mux.Unlock()
+
+	var subscribers []Subscription
+	for _, cand := range candidates {
+		if cand.filter != nil {
+			ok, err := cand.filter(event, opts)
+			if err != nil {
+				return "", fmt.Errorf("failed to filter event for handler %s: %w", cand.sub.TaskKind(), err)
+			}
+			if !ok {
+				c.log.Debug("event skipped by handler filter", "event", event.Kind(), "handler", cand.sub.TaskKind())
+				continue
+			}
+		}
+		subscribers = append(subscribers, cand.sub)
+	}
+
+	remote, err := c.remoteSubscribers(ctx, event.Kind())
+	if err != nil {
+		return "", err
+	}
+	subscribers = append(subscribers, remote...)
+	if candidates == nil && remote == nil {
+		return "", fmt.Errorf("no handler registered for event: %s", event.Kind())
+	}
+	if subscribers == nil {
+		return "", nil
+	}
+	c.ensureSystemHandlers()
+	return c.client.StartTask(ctx, EventFanoutArgs{
+		EventType:    event.Kind(),
+		EventVersion: argsVersion(event),
+		Payload:      event,
+		Subscribers:  subscribers,
+	}, opts)
+}
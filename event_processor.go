@@ -35,3 +35,12 @@ type EventHandler[T Event] interface {
 	// terminating the process.
 	ProcessEvent(ctx context.Context, task *Container[T]) error
 }
+
+// EventFilter can optionally be implemented by an EventHandler to skip events before a
+// task is enqueued for them. Filter is called by PublishEvent with the published event
+// decoded into the handler's event type; returning false skips the handler.
+//
+// Filters only apply to handlers registered in the publishing service.
+type EventFilter[T Event] interface {
+	Filter(event *Container[T]) bool
+}
@@ -0,0 +1,114 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// Subscription describes an event handler registered by a service together with the
+// base URL that tasks for the handler must be delivered to.
+type Subscription struct {
+	// Handler is the handler name given to AddEventHandler.
+	Handler string `json:"handler"`
+	// EventKind is the kind of the event the handler subscribes to.
+	EventKind string `json:"event_kind"`
+	// Patterns replace EventKind when matching published events, as set with
+	// WithEventPatterns.
+	Patterns []string `json:"patterns,omitempty"`
+	// TargetUrl is the base URL of the service that owns the handler.
+	TargetUrl string `json:"target_url"`
+	// InsertOpts overrides the fan-out task's options for this subscriber, as set
+	// with WithInsertOpts.
+	InsertOpts *InsertOpts `json:"insert_opts,omitempty"`
+}
+
+// TaskKind returns the task kind the handler is registered under, which is also the
+// kind of the tasks the fan-out worker starts for it.
+func (s Subscription) TaskKind() string {
+	return fmt.Sprintf("%s/%s", s.Handler, s.EventKind)
+}
+
+// Matches reports whether a published event of kind eventKind must be delivered to
+// the subscriber. Patterns use the syntax of path.Match, so "room.*" matches
+// "room.booked" and "*.created" matches "room.created".
+func (s Subscription) Matches(eventKind string) bool {
+	if len(s.Patterns) == 0 {
+		return s.EventKind == eventKind
+	}
+	for _, pattern := range s.Patterns {
+		if ok, _ := path.Match(pattern, eventKind); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriptionRegistry stores event subscriptions across services, so that an event
+// published by one service reaches handlers registered in another.
+//
+// Implemented by RedisTaskStore.
+type SubscriptionRegistry interface {
+	// RegisterSubscriptions replaces all subscriptions previously registered for
+	// targetUrl with subs.
+	RegisterSubscriptions(ctx context.Context, targetUrl string, subs []Subscription) error
+	// ListSubscriptions returns the subscriptions of all services.
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+}
+
+// WithSubscriptionRegistry shares the service's event subscriptions through registry.
+// targetUrl is the base URL other services must deliver this service's event tasks to,
+// usually the same URL the service's transport targets.
+//
+// Subscriptions are published by calling RegisterSubscriptions once all event handlers
+// have been added.
+func WithSubscriptionRegistry(registry SubscriptionRegistry, targetUrl string) ServiceOption {
+	return func(t *TaskService) {
+		t.registry = registry
+		t.targetUrl = targetUrl
+	}
+}
+
+// RegisterSubscriptions publishes the event handlers added to the service to its
+// SubscriptionRegistry. It should be called on startup after all calls to
+// AddEventHandler.
+func (c *TaskService) RegisterSubscriptions(ctx context.Context) error {
+	if c.registry == nil {
+		return fmt.Errorf("no subscription registry configured")
+	}
+	c.mux.Lock()
+	subs := make([]Subscription, len(c.subscriptions))
+	for i, sub := range c.subscriptions {
+		sub.TargetUrl = c.targetUrl
+		subs[i] = sub
+	}
+	c.mux.Unlock()
+
+	if err := c.registry.RegisterSubscriptions(ctx, c.targetUrl, subs); err != nil {
+		return fmt.Errorf("failed to register subscriptions: %w", err)
+	}
+	c.log.Info("event subscriptions registered", "targetUrl", c.targetUrl, "count", len(subs))
+	return nil
+}
+
+// remoteSubscribers returns the subscriptions to eventKind registered by other services.
+func (c *TaskService) remoteSubscribers(ctx context.Context, eventKind string) ([]Subscription, error) {
+	if c.registry == nil {
+		return nil, nil
+	}
+	subs, err := c.registry.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	var remote []Subscription
+	seen := make(map[string]bool)
+	for _, sub := range subs {
+		if !sub.Matches(eventKind) || sub.TargetUrl == c.targetUrl || seen[subscriptionField(sub)] {
+			continue
+		}
+		seen[subscriptionField(sub)] = true
+		remote = append(remote, sub)
+	}
+	return remote, nil
+}
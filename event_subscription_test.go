@@ -0,0 +1,300 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentEvent struct {
+	ce   cloudevents.Event
+	opts InsertOpts
+}
+
+// captureTransport records every event sent through it instead of delivering it.
+type captureTransport struct {
+	mux  sync.Mutex
+	sent []sentEvent
+}
+
+func (c *captureTransport) Send(ctx context.Context, ce cloudevents.Event, opts *InsertOpts) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.sent = append(c.sent, sentEvent{ce: ce, opts: *opts})
+	return nil
+}
+
+func (c *captureTransport) take() []sentEvent {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+// received adds the extensions the HTTP layer sets on incoming events.
+func received(ce cloudevents.Event) cloudevents.Event {
+	if _, ok := events.GetRetried(&ce); !ok {
+		events.SetRetried(&ce, 0)
+	}
+	events.SetScheduled(&ce, false)
+	events.SetQstashMessageID(&ce, "msg-"+ce.ID())
+	return ce
+}
+
+func TestCrossServiceSubscriptions(t *testing.T) {
+	store, mr := setupTestRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	billingTransport := &captureTransport{}
+	billing := NewTaskService(billingTransport, WithSubscriptionRegistry(store, "https://billing.example.com"))
+
+	notifications := NewTaskService(dummyTransport(), WithSubscriptionRegistry(store, "https://notifications.example.com"))
+	processor := &DummyEventProcessor{}
+	AddEventHandler(notifications, "notify", processor)
+	require.NoError(t, notifications.RegisterSubscriptions(ctx))
+
+	subs, err := store.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Subscription{{Handler: "notify", EventKind: "DummyTask", TargetUrl: "https://notifications.example.com"}}, subs)
+
+	t.Run("publish reaches remote subscriber", func(t *testing.T) {
+		_, err := billing.PublishEvent(ctx, DummyTask{Name: "invoice"}, nil)
+		require.NoError(t, err)
+
+		sent := billingTransport.take()
+		require.Len(t, sent, 1)
+		require.Equal(t, EventFanoutArgs{}.Kind(), sent[0].ce.Type())
+
+		// The fan-out task is handled by the publishing service.
+		require.NoError(t, billing.HandleEvent(ctx, received(sent[0].ce)))
+
+		sent = billingTransport.take()
+		require.Len(t, sent, 1)
+		assert.Equal(t, "notify/DummyTask", sent[0].ce.Type())
+		assert.Equal(t, "https://notifications.example.com", sent[0].opts.targetUrl)
+
+		require.NoError(t, notifications.HandleEvent(ctx, received(sent[0].ce)))
+		require.Len(t, processor.Tasks, 1)
+		assert.Equal(t, "invoice", processor.Tasks[0].DummyTask.Name)
+	})
+
+	t.Run("re-registering replaces subscriptions", func(t *testing.T) {
+		require.NoError(t, store.RegisterSubscriptions(ctx, "https://notifications.example.com", nil))
+
+		subs, err := store.ListSubscriptions(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, subs)
+
+		_, err = billing.PublishEvent(ctx, DummyTask{Name: "invoice"}, nil)
+		require.Error(t, err)
+	})
+}
+
+// flakyTransport fails the first send of every task kind in failKinds.
+type flakyTransport struct {
+	captureTransport
+	failKinds map[string]bool
+}
+
+func (f *flakyTransport) Send(ctx context.Context, ce cloudevents.Event, opts *InsertOpts) error {
+	f.mux.Lock()
+	fail := f.failKinds[ce.Type()]
+	delete(f.failKinds, ce.Type())
+	f.mux.Unlock()
+	if fail {
+		return fmt.Errorf("transport unavailable")
+	}
+	return f.captureTransport.Send(ctx, ce, opts)
+}
+
+func TestSubscribersCreateMissingExecutions(t *testing.T) {
+	ctx := context.Background()
+	billingTransport := &captureTransport{}
+	billing := NewTaskService(billingTransport)
+	AddEventHandler(billing, "notify", &DummyEventProcessor{})
+
+	// The fan-out of another service created the execution in its own store
+	store := NewMemoryTaskStore()
+	notifications := NewTaskService(dummyTransport(), WithStore(store))
+	AddEventHandler(notifications, "notify", &DummyEventProcessor{})
+	AddTaskHandler(notifications, &DummyTaskProcessor{})
+
+	_, err := billing.PublishEvent(ctx, DummyTask{Name: "invoice"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, billing.HandleEvent(ctx, received(billingTransport.take()[0].ce)))
+	sent := billingTransport.take()
+	require.Len(t, sent, 1)
+	require.NoError(t, notifications.HandleEvent(ctx, received(sent[0].ce)))
+	task, err := store.GetTaskExecution(ctx, sent[0].ce.ID())
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusSuccess, task.Status)
+
+	// Other tasks must have been started with the store
+	ce, err := events.Serialize(ctx, DummyTask{Name: "unknown"})
+	require.NoError(t, err)
+	assert.Error(t, notifications.HandleEvent(ctx, received(ce)))
+	exists, err := store.TaskExists(ctx, ce.ID())
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestIdempotentEventFanout(t *testing.T) {
+	store, mr := setupTestRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	transport := &flakyTransport{failKinds: map[string]bool{"second/DummyTask": true}}
+	tsvc := NewTaskService(transport, WithStore(store))
+	AddEventHandler(tsvc, "first", &DummyEventProcessor{})
+	AddEventHandler(tsvc, "second", &DummyEventProcessor{}, WithInsertOpts(InsertOpts{MaxRetries: 7, Queue: "slow"}))
+
+	fanoutID, err := tsvc.PublishEvent(ctx, DummyTask{Name: "booked"}, nil)
+	require.NoError(t, err)
+	sent := transport.take()
+	require.Len(t, sent, 1)
+	fanout := received(sent[0].ce)
+
+	// The first attempt delivers to "first" only.
+	err = tsvc.HandleEvent(ctx, fanout)
+	require.Error(t, err)
+	sent = transport.take()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "first/DummyTask", sent[0].ce.Type())
+	firstID := FanoutTaskID(fanoutID, Subscription{Handler: "first", EventKind: "DummyTask"})
+	assert.Equal(t, firstID, sent[0].ce.ID())
+
+	execution, err := store.GetTaskExecution(ctx, fanoutID)
+	require.NoError(t, err)
+	require.Len(t, execution.Errors, 1)
+	require.Contains(t, execution.Errors[0].Details, "dispatches")
+	secondID := FanoutTaskID(fanoutID, Subscription{Handler: "second", EventKind: "DummyTask"})
+	assert.Equal(t, map[string]string{firstID: DispatchStatusDispatched, secondID: DispatchStatusFailed}, dispatchStatuses(execution))
+
+	// The retry only delivers to the subscriber that failed, once the first child ran.
+	require.NoError(t, store.UpdateTaskStatus(ctx, firstID, TaskStatusRunning))
+	events.SetRetried(&fanout, 1)
+	require.NoError(t, tsvc.HandleEvent(ctx, fanout))
+	sent = transport.take()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "second/DummyTask", sent[0].ce.Type())
+	assert.Equal(t, 7, sent[0].opts.MaxRetries)
+	assert.Equal(t, "slow", sent[0].opts.Queue)
+
+	child, err := store.GetTaskExecution(ctx, sent[0].ce.ID())
+	require.NoError(t, err)
+	assert.Equal(t, fanoutID, child.ParentID)
+	assert.Equal(t, "slow", child.Queue)
+
+	execution, err = store.GetTaskExecution(ctx, fanoutID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusSuccess, execution.Status)
+	assert.Equal(t, map[string]string{firstID: DispatchStatusSkipped, secondID: DispatchStatusDispatched}, dispatchStatuses(execution))
+}
+
+func TestEventFanoutResendsPendingChildren(t *testing.T) {
+	store := NewMemoryTaskStore()
+	ctx := context.Background()
+	transport := &captureTransport{}
+	tsvc := NewTaskService(transport, WithStore(store))
+	AddEventHandler(tsvc, "first", &DummyEventProcessor{})
+
+	fanoutID, err := tsvc.PublishEvent(ctx, DummyTask{Name: "booked"}, nil)
+	require.NoError(t, err)
+	sent := transport.take()
+	require.Len(t, sent, 1)
+
+	// An earlier attempt created the child but stopped before sending it
+	childID := FanoutTaskID(fanoutID, Subscription{Handler: "first", EventKind: "DummyTask"})
+	require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: childID, TaskKind: "first/DummyTask", Status: TaskStatusPending}))
+
+	require.NoError(t, tsvc.HandleEvent(ctx, received(sent[0].ce)))
+	sent = transport.take()
+	require.Len(t, sent, 1)
+	assert.Equal(t, childID, sent[0].ce.ID())
+
+	execution, err := store.GetTaskExecution(ctx, fanoutID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{childID: DispatchStatusDispatched}, dispatchStatuses(execution))
+}
+
+// dispatchStatuses returns the status of each task recorded on a fan-out execution.
+func dispatchStatuses(execution *TaskExecution) map[string]string {
+	statuses := make(map[string]string, len(execution.Dispatches))
+	for _, d := range execution.Dispatches {
+		statuses[d.TaskID] = d.Status
+	}
+	return statuses
+}
+
+type roomEvent struct {
+	Room string `json:"room"`
+	kind string
+}
+
+func (e roomEvent) Kind() string {
+	if e.kind == "" {
+		return "room.booked"
+	}
+	return e.kind
+}
+
+type roomEventProcessor struct {
+	TaskHandlerDefaults[roomEvent]
+	mux     sync.Mutex
+	kinds   []string
+	onlyVIP bool
+}
+
+func (p *roomEventProcessor) ProcessEvent(ctx context.Context, event *Container[roomEvent]) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.kinds = append(p.kinds, event.EventKind)
+	return nil
+}
+
+func (p *roomEventProcessor) Filter(event *Container[roomEvent]) bool {
+	return !p.onlyVIP || event.Args.Room == "vip"
+}
+
+func TestEventPatternsAndFilters(t *testing.T) {
+	ctx := context.Background()
+	transport := &captureTransport{}
+	tsvc := NewTaskService(transport)
+	all := &roomEventProcessor{}
+	vip := &roomEventProcessor{onlyVIP: true}
+	AddEventHandler(tsvc, "all", all, WithEventPatterns("room.*", "*.created"))
+	AddEventHandler(tsvc, "vip", vip)
+
+	publish := func(event Event) []string {
+		_, err := tsvc.PublishEvent(ctx, event, nil)
+		require.NoError(t, err)
+		var kinds []string
+		for _, fanout := range transport.take() {
+			require.NoError(t, tsvc.HandleEvent(ctx, received(fanout.ce)))
+			for _, child := range transport.take() {
+				kinds = append(kinds, child.ce.Type())
+				require.NoError(t, tsvc.HandleEvent(ctx, received(child.ce)))
+			}
+		}
+		return kinds
+	}
+
+	assert.ElementsMatch(t, []string{"all/room.booked"}, publish(roomEvent{Room: "standard"}))
+	assert.ElementsMatch(t, []string{"all/room.booked", "vip/room.booked"}, publish(roomEvent{Room: "vip"}))
+	assert.ElementsMatch(t, []string{"all/room.booked"}, publish(roomEvent{kind: "room.cancelled"}))
+	assert.ElementsMatch(t, []string{"all/room.booked"}, publish(roomEvent{kind: "guest.created"}))
+
+	_, err := tsvc.PublishEvent(ctx, roomEvent{kind: "guest.deleted"}, nil)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{"room.booked", "room.booked", "room.cancelled", "guest.created"}, all.kinds)
+	assert.Equal(t, []string{"room.booked"}, vip.kinds)
+}
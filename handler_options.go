@@ -0,0 +1,68 @@
+package uptask
+
+// HandlerOption configures a task or event handler at registration.
+type HandlerOption func(*handlerConfig)
+
+// handlerConfig bundles the options a handler was registered with.
+type handlerConfig struct {
+	insertOpts *InsertOpts
+	patterns   []string
+	filter     eventFilterFunc
+	upcasters  map[int]Upcaster
+	aliases    []string
+	// event is set for event handlers, which may receive events published by other
+	// services, see TaskService.HandleEvent.
+	event bool
+}
+
+// eventFilterFunc is the non-generic form of EventFilter.Filter.
+type eventFilterFunc func(event Event, opts *InsertOpts) (bool, error)
+
+func newHandlerConfig(opts []HandlerOption) *handlerConfig {
+	cfg := &handlerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithInsertOpts overrides the options of the tasks the fan-out worker starts for an
+// event handler, such as its retries or queue. Non-zero fields of opts take precedence
+// over the options the event was published with.
+//
+//	uptask.AddEventHandler(service, "notify", &NotifyHandler{}, uptask.WithInsertOpts(uptask.InsertOpts{
+//		MaxRetries: 10,
+//		Queue:      "notifications",
+//	}))
+func WithInsertOpts(opts InsertOpts) HandlerOption {
+	return func(c *handlerConfig) {
+		c.insertOpts = &opts
+	}
+}
+
+// WithEventPatterns subscribes an event handler to every event whose kind matches one
+// of patterns, instead of only the kind of its own event type. Patterns use the syntax
+// of path.Match:
+//
+//	uptask.AddEventHandler(service, "audit", &AuditHandler{}, uptask.WithEventPatterns("room.*", "*.created"))
+//
+// The payload of every matching event is decoded into the handler's event type, and
+// the kind of the published event is available as Container.EventKind.
+func WithEventPatterns(patterns ...string) HandlerOption {
+	return func(c *handlerConfig) {
+		c.patterns = append(c.patterns, patterns...)
+	}
+}
+
+// WithKindAliases registers previous kinds of a renamed task, so that tasks already
+// enqueued or scheduled under an old kind are routed to the handler. Executions
+// stored under an old kind are moved to the handler's kind when the task is handled.
+//
+//	uptask.AddTaskHandler(service, &SendEmailHandler{}, uptask.WithKindAliases("send_mail"))
+//
+// For event handlers aliases are full task kinds of the form "handler/event".
+func WithKindAliases(aliases ...string) HandlerOption {
+	return func(c *handlerConfig) {
+		c.aliases = append(c.aliases, aliases...)
+	}
+}
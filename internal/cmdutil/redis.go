@@ -0,0 +1,40 @@
+// Package cmdutil holds the setup shared by the commands of the module.
+package cmdutil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mscno/uptask"
+)
+
+// NewRedisStore connects to the Redis deployment given by redisUrl, usually read from
+// a -redis-url flag or the REDIS_URL environment variable. Full URLs, such as
+// redis+cluster:// or redis+sentinel:// ones, are used as is; a bare host is combined
+// with REDIS_PORT and REDIS_PASSWORD over TLS. Keys are prefixed with namespace if
+// set.
+func NewRedisStore(redisUrl, namespace string) (*uptask.RedisTaskStore, error) {
+	if redisUrl == "" {
+		return nil, fmt.Errorf("REDIS_URL environment variable or -redis-url flag is required")
+	}
+	if strings.Contains(redisUrl, "://") {
+		return uptask.NewRedisTaskStoreFromURL(redisUrl, uptask.WithRedisNamespace(namespace))
+	}
+
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisPassword == "" {
+		return nil, fmt.Errorf("REDIS_PASSWORD environment variable is required")
+	}
+	redisPort := os.Getenv("REDIS_PORT")
+	if redisPort == "" {
+		redisPort = "6379"
+	}
+	return uptask.NewRedisTaskStore(uptask.RedisConfig{
+		Addr:      fmt.Sprintf("%s:%s", redisUrl, redisPort),
+		Username:  "default",
+		Password:  redisPassword,
+		Secure:    true,
+		Namespace: namespace,
+	})
+}
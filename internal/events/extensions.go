@@ -2,6 +2,7 @@ package events
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
@@ -159,3 +160,40 @@ func SetScheduleID(event *cloudevents.Event, scheduleID string) {
 func SetQstashMessageID(event *cloudevents.Event, messageID string) {
 	event.SetExtension(QstashMessageIdExtension, messageID)
 }
+
+// GetEventKind returns the kind of the published event an event task was started for
+func GetEventKind(event *cloudevents.Event) string {
+	val, ok := GetStringExtension(event, EventKindExtension)
+	if !ok {
+		return ""
+	}
+	return val
+}
+
+// GetVersion returns the version of the args the task was serialized with
+func GetVersion(event *cloudevents.Event) (int, bool) {
+	return GetIntExtension(event, TaskVersionExtension)
+}
+
+// SetVersion sets the version of the args the task was serialized with
+func SetVersion(event *cloudevents.Event, version int) {
+	event.SetExtension(TaskVersionExtension, strconv.Itoa(version))
+}
+
+// GetTags returns the tags of this task
+func GetTags(event *cloudevents.Event) []string {
+	val, ok := GetStringExtension(event, TaskTagsExtension)
+	if !ok || val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
+// SetTags sets the tags of this task. Extension values must be strings, so the tags
+// are joined with commas and must not contain one themselves, which StartTask checks.
+func SetTags(event *cloudevents.Event, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	event.SetExtension(TaskTagsExtension, strings.Join(tags, ","))
+}
@@ -56,6 +56,13 @@ func TestExtensionUtilities(t *testing.T) {
 	assert.Equal(t, false, IsScheduled(&emptyEvent))
 	scheduledAt, _ = GetNotBefore(&emptyEvent)
 	assert.Equal(t, time.Time{}, scheduledAt)
+	assert.Nil(t, GetTags(&emptyEvent))
+
+	// Test tags round trip through a single string extension
+	SetTags(&event, []string{"billing", "eu"})
+	assert.Equal(t, []string{"billing", "eu"}, GetTags(&event))
+	tagsVal, _ := GetStringExtension(&event, TaskTagsExtension)
+	assert.Equal(t, "billing,eu", tagsVal)
 
 	// Test missing values return false for second return value
 	_, strOk := GetStringExtension(&emptyEvent, TaskQueueExtension)
@@ -10,4 +10,7 @@ const (
 	TaskSnoozedExtension     = "tasksnoozed"
 	ScheduleIdExtension      = "scheduleid"
 	QstashMessageIdExtension = "qstashmessageid"
+	EventKindExtension       = "eventkind"
+	TaskVersionExtension     = "taskversion"
+	TaskTagsExtension        = "tasktags"
 )
@@ -20,6 +20,16 @@ type Payloader interface {
 	Payload() any
 }
 
+// Versioner is implemented by args that carry a schema version.
+type Versioner interface {
+	Version() int
+}
+
+// Extender is implemented by args that set their own extensions on the event.
+type Extender interface {
+	Extensions() map[string]string
+}
+
 func Serialize(ctx context.Context, args Kinder) (cloudevents.Event, error) {
 	return SerializeWithExt(ctx, args)
 }
@@ -46,6 +56,14 @@ func SerializeWithExt(ctx context.Context, args Kinder, extKvPairs ...string) (c
 	e.SetType(args.Kind())
 	e.SetSource(Source)
 	e.SetTime(time.Now().UTC())
+	if v, ok := args.(Versioner); ok && v.Version() > 0 {
+		SetVersion(&e, v.Version())
+	}
+	if x, ok := args.(Extender); ok {
+		for k, v := range x.Extensions() {
+			e.SetExtension(k, v)
+		}
+	}
 	for k, v := range exts {
 		e.SetExtension(k, v)
 	}
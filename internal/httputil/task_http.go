@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -24,6 +25,8 @@ const (
 	upstashSourceMsgId       = "sourceMessageId"
 	upstashDlqMaxRetried     = "maxRetries"
 	upstashDlqscheduleId     = "scheduleId"
+	upstashDlqStatus         = "status"
+	upstashDlqBody           = "body"
 )
 
 func NewEventFromHTTPRequest(r *http.Request) (cloudevents.Event, error) {
@@ -92,24 +95,34 @@ func NewEventFromHTTPRequest(r *http.Request) (cloudevents.Event, error) {
 	return *ce, nil
 }
 
-func NewDlqEventFromHTTPRequest(r *http.Request) (cloudevents.Event, error) {
-	var v map[string]interface{}
+// DlqFailure is the failure callback QStash sends for a message that used all its
+// retries.
+type DlqFailure struct {
+	DlqID      string
+	MessageID  string
+	Status     int    // Status of the last response of the endpoint
+	Body       string // Body of the last response of the endpoint
+	Retried    int
+	MaxRetries int
+	Raw        []byte // Callback body as sent by QStash
+}
 
-	err := json.NewDecoder(r.Body).Decode(&v)
+func NewDlqEventFromHTTPRequest(r *http.Request) (cloudevents.Event, DlqFailure, error) {
+	raw, err := io.ReadAll(r.Body)
 	if err != nil {
-		return cloudevents.Event{}, fmt.Errorf("failed to parse upstash-dlq event: %w", err)
+		return cloudevents.Event{}, DlqFailure{}, fmt.Errorf("failed to read upstash-dlq event: %w", err)
 	}
-
-	dataStr := v["sourceBody"].(string)
-	data, err := base64.StdEncoding.DecodeString(dataStr)
+	var v map[string]interface{}
+	err = json.Unmarshal(raw, &v)
 	if err != nil {
-		return cloudevents.Event{}, fmt.Errorf("failed to decdode upstash-dlq event body: %w", err)
+		return cloudevents.Event{}, DlqFailure{}, fmt.Errorf("failed to parse upstash-dlq event: %w", err)
 	}
-	ce := cloudevents.NewEvent(cloudevents.VersionV1)
-	err = ce.UnmarshalJSON(data)
+
+	ce, err := DecodeDlqSourceBody(v)
 	if err != nil {
-		return cloudevents.Event{}, fmt.Errorf("failed to unmarshal cloudevent body: %w", err)
+		return cloudevents.Event{}, DlqFailure{}, err
 	}
+	failure := newDlqFailure(v, raw)
 	//slog.Debug("upstash header", "headers", r.Header)
 
 	//slog.Debug("extenstions in", "ext", ce.Extensions())
@@ -160,9 +173,51 @@ func NewDlqEventFromHTTPRequest(r *http.Request) (cloudevents.Event, error) {
 	}
 
 	//slog.Debug("extenstions out", "ext", ce.Extensions())
+	return ce, failure, nil
+}
+
+// DecodeDlqSourceBody returns the event QStash failed to deliver from the fields of
+// its failure callback.
+func DecodeDlqSourceBody(v map[string]interface{}) (cloudevents.Event, error) {
+	dataStr, ok := v["sourceBody"].(string)
+	if !ok {
+		return cloudevents.Event{}, fmt.Errorf("failed to parse upstash-dlq event: missing sourceBody")
+	}
+	data, err := base64.StdEncoding.DecodeString(dataStr)
+	if err != nil {
+		return cloudevents.Event{}, fmt.Errorf("failed to decdode upstash-dlq event body: %w", err)
+	}
+	ce := cloudevents.NewEvent(cloudevents.VersionV1)
+	err = ce.UnmarshalJSON(data)
+	if err != nil {
+		return cloudevents.Event{}, fmt.Errorf("failed to unmarshal cloudevent body: %w", err)
+	}
 	return ce, nil
 }
 
+func newDlqFailure(v map[string]interface{}, raw []byte) DlqFailure {
+	failure := DlqFailure{Raw: raw}
+	failure.DlqID, _ = v[upstashDlqId].(string)
+	failure.MessageID, _ = v[upstashSourceMsgId].(string)
+	if status, ok := v[upstashDlqStatus].(float64); ok {
+		failure.Status = int(status)
+	}
+	// The response body is base64 encoded, unless QStash could not encode it.
+	if body, ok := v[upstashDlqBody].(string); ok {
+		failure.Body = body
+		if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
+			failure.Body = string(decoded)
+		}
+	}
+	if retried, ok := v[upstashDlqRetried].(float64); ok {
+		failure.Retried = int(retried)
+	}
+	if maxRetries, ok := v[upstashDlqMaxRetried].(float64); ok {
+		failure.MaxRetries = int(maxRetries)
+	}
+	return failure
+}
+
 func stableUUID(input string) uuid.UUID {
 	hash := sha256.Sum256([]byte(input))
 	// Use the first 16 bytes to create a UUID
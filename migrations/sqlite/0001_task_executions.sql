@@ -0,0 +1,52 @@
+-- Timestamps are unix nanoseconds, NULL when unset.
+CREATE TABLE task_executions (
+	id                TEXT    PRIMARY KEY,
+	task_kind         TEXT    NOT NULL,
+	status            TEXT    NOT NULL,
+	args              TEXT,
+	attempt_id        TEXT    NOT NULL DEFAULT '',
+	retried           INTEGER NOT NULL DEFAULT 0,
+	max_retries       INTEGER NOT NULL DEFAULT 0,
+	qstash_message_id TEXT    NOT NULL DEFAULT '',
+	schedule_id       TEXT    NOT NULL DEFAULT '',
+	queue             TEXT    NOT NULL DEFAULT '',
+	parent_id         TEXT    NOT NULL DEFAULT '',
+	created_at        INTEGER NOT NULL,
+	attempted_at      INTEGER,
+	scheduled_at      INTEGER,
+	finalized_at      INTEGER
+);
+
+CREATE INDEX task_executions_created_at ON task_executions (created_at, id);
+CREATE INDEX task_executions_status ON task_executions (status, created_at);
+CREATE INDEX task_executions_kind ON task_executions (task_kind, created_at);
+CREATE INDEX task_executions_queue ON task_executions (queue, created_at);
+CREATE INDEX task_executions_schedule_id ON task_executions (schedule_id);
+CREATE INDEX task_executions_finalized_at ON task_executions (finalized_at);
+
+CREATE TABLE task_attempts (
+	task_id     TEXT    NOT NULL REFERENCES task_executions (id) ON DELETE CASCADE,
+	attempt     INTEGER NOT NULL,
+	status      TEXT    NOT NULL,
+	started_at  INTEGER NOT NULL,
+	finished_at INTEGER,
+	PRIMARY KEY (task_id, attempt)
+);
+
+CREATE TABLE task_errors (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id   TEXT    NOT NULL REFERENCES task_executions (id) ON DELETE CASCADE,
+	message   TEXT    NOT NULL,
+	details   TEXT,
+	timestamp INTEGER NOT NULL
+);
+
+CREATE INDEX task_errors_task_id ON task_errors (task_id, id);
+
+CREATE TABLE task_tags (
+	task_id TEXT NOT NULL REFERENCES task_executions (id) ON DELETE CASCADE,
+	tag     TEXT NOT NULL,
+	PRIMARY KEY (task_id, tag)
+);
+
+CREATE INDEX task_tags_tag ON task_tags (tag, task_id);
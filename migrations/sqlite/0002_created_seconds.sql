@@ -0,0 +1,7 @@
+-- Tasks are listed by creation time at a resolution of one second, then by ID.
+ALTER TABLE task_executions ADD COLUMN created_sec INTEGER GENERATED ALWAYS AS (created_at / 1000000000) VIRTUAL;
+
+CREATE INDEX task_executions_listing ON task_executions (created_sec, id);
+CREATE INDEX task_executions_status_listing ON task_executions (status, created_sec, id);
+CREATE INDEX task_executions_kind_listing ON task_executions (task_kind, created_sec, id);
+CREATE INDEX task_executions_queue_listing ON task_executions (queue, created_sec, id);
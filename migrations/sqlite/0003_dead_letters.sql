@@ -0,0 +1,2 @@
+-- The failure callback of QStash for tasks moved to its dead letter queue, as JSON.
+ALTER TABLE task_executions ADD COLUMN dead_letter TEXT;
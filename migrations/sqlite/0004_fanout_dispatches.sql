@@ -0,0 +1,2 @@
+-- The outcome of delivering the event of a fan-out task to each subscriber, as JSON.
+ALTER TABLE task_executions ADD COLUMN dispatches TEXT;
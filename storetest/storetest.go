@@ -0,0 +1,704 @@
+// Package storetest provides a conformance test suite for uptask.TaskStore
+// implementations.
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func() uptask.TaskStore {
+//			return NewMyStore()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the conformance suite against the stores returned by newStore. Every test
+// gets a new, empty store.
+//
+// The suite defines the contract of a TaskStore:
+//   - Creating a task with an existing ID replaces it.
+//   - Transitions to RUNNING set AttemptedAt, transitions to SUCCESS, FAILED or
+//     CANCELLED set FinalizedAt, and both clear ScheduledAt. Transitions to PENDING increment Retried.
+//   - Snoozing sets the task PENDING with the new ScheduledAt, and increments both
+//     Retried and MaxRetries.
+//   - Lists are ordered by creation time, newest first, at a resolution of one second,
+//     and by descending ID within a second. All filters are combined; a zero date is
+//     unbounded and a zero limit returns every match.
+//   - A cursor from NextTaskCursor continues a listing after the last task of a page,
+//     and an invalid cursor is an error.
+//   - Cleanup removes tasks created at or before the cutoff.
+//   - Stores implementing uptask.StatsStore count the stored tasks by status, kind and
+//     queue, and bucket task creation, finalization and first attempts by the time
+//     they happened.
+//   - Stores implementing uptask.Watcher send every change of a matching task to
+//     watchers started before it, including the changes moving a task out of a
+//     filtered status, and close the channel once the context is done.
+func Run(t *testing.T, newStore func() uptask.TaskStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store uptask.TaskStore)
+	}{
+		{"Create", testCreate},
+		{"CreateReplaces", testCreateReplaces},
+		{"NotFound", testNotFound},
+		{"Transitions", testTransitions},
+		{"AddTaskError", testAddTaskError},
+		{"Snooze", testSnooze},
+		{"Delete", testDelete},
+		{"FilterByStatus", testFilterByStatus},
+		{"FilterByQueue", testFilterByQueue},
+		{"FilterByDate", testFilterByDate},
+		{"FilterByKind", testFilterByKind},
+		{"FilterByTags", testFilterByTags},
+		{"FilterByScheduleID", testFilterByScheduleID},
+		{"CombinedFilters", testCombinedFilters},
+		{"LimitAndOrdering", testLimitAndOrdering},
+		{"CursorPaging", testCursorPaging},
+		{"InvalidCursor", testInvalidCursor},
+		{"MostRecent", testMostRecent},
+		{"Cleanup", testCleanup},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"Stats", testStats},
+		{"Watch", testWatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore())
+		})
+	}
+}
+
+// baseTime is far enough in the past that tasks created relative to it never collide
+// with tasks created at the current time.
+var baseTime = time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+func newTask(id string) *uptask.TaskExecution {
+	return &uptask.TaskExecution{
+		ID:          id,
+		TaskKind:    "TestTask",
+		Status:      uptask.TaskStatusPending,
+		Args:        map[string]interface{}{"name": id},
+		MaxRetries:  3,
+		Queue:       "default",
+		CreatedAt:   baseTime,
+		ScheduledAt: baseTime.Add(time.Hour),
+	}
+}
+
+// createTasks creates tasks with the given IDs, one minute apart, the first being the
+// oldest.
+func createTasks(t *testing.T, store uptask.TaskStore, ids ...string) {
+	for i, id := range ids {
+		task := newTask(id)
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(context.Background(), task))
+	}
+}
+
+func ids(tasks []*uptask.TaskExecution) []string {
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func statusPtr(status uptask.TaskStatus) *uptask.TaskStatus {
+	return &status
+}
+
+func testCreate(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	task := newTask("task-1")
+	task.ParentID = "parent"
+	task.ScheduleID = "schedule"
+	task.Dispatches = []uptask.FanoutDispatch{{
+		Subscription: uptask.Subscription{Handler: "handler", EventKind: "TestEvent"},
+		TaskID:       "child",
+		Status:       uptask.DispatchStatusDispatched,
+	}}
+	require.NoError(t, store.CreateTaskExecution(ctx, task))
+
+	exists, err := store.TaskExists(ctx, "task-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, "task-1", got.ID)
+	assert.Equal(t, "TestTask", got.TaskKind)
+	assert.Equal(t, uptask.TaskStatusPending, got.Status)
+	assert.Equal(t, map[string]interface{}{"name": "task-1"}, got.Args)
+	assert.Equal(t, 3, got.MaxRetries)
+	assert.Equal(t, "default", got.Queue)
+	assert.Equal(t, "parent", got.ParentID)
+	assert.Equal(t, "schedule", got.ScheduleID)
+	assert.Equal(t, task.Dispatches, got.Dispatches)
+	assert.True(t, task.CreatedAt.Equal(got.CreatedAt))
+	assert.True(t, task.ScheduledAt.Equal(got.ScheduledAt))
+
+	unset := &uptask.TaskExecution{ID: "task-2", TaskKind: "TestTask", Status: uptask.TaskStatusPending}
+	require.NoError(t, store.CreateTaskExecution(ctx, unset))
+	got, err = store.GetTaskExecution(ctx, "task-2")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), got.CreatedAt, time.Minute, "CreatedAt is set if zero")
+}
+
+func testCreateReplaces(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	task := newTask("task-1")
+	require.NoError(t, store.CreateTaskExecution(ctx, task))
+
+	task.TaskKind = "RenamedTask"
+	task.Status = uptask.TaskStatusSuccess
+	require.NoError(t, store.CreateTaskExecution(ctx, task))
+
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, "RenamedTask", got.TaskKind)
+	assert.Equal(t, uptask.TaskStatusSuccess, got.Status)
+
+	pending, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusPending)})
+	require.NoError(t, err)
+	assert.Empty(t, pending, "a replaced task is no longer listed under its previous status")
+	byKind, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Kind: "TestTask"})
+	require.NoError(t, err)
+	assert.Empty(t, byKind, "a replaced task is no longer listed under its previous kind")
+	byKind, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Kind: "RenamedTask"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-1"}, ids(byKind))
+}
+
+func testNotFound(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	exists, err := store.TaskExists(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = store.GetTaskExecution(ctx, "missing")
+	assert.Error(t, err)
+	assert.Error(t, store.UpdateTaskStatus(ctx, "missing", uptask.TaskStatusRunning))
+	assert.Error(t, store.UpdateTaskSnoozedTask(ctx, "missing", time.Now()))
+	assert.Error(t, store.AddTaskError(ctx, "missing", uptask.TaskError{Message: "boom"}))
+	assert.Error(t, store.DeleteTaskExecution(ctx, "missing"))
+}
+
+func testTransitions(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	require.NoError(t, store.CreateTaskExecution(ctx, newTask("task-1")))
+
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusRunning))
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusRunning, got.Status)
+	assert.WithinDuration(t, time.Now(), got.AttemptedAt, time.Minute)
+	assert.True(t, got.ScheduledAt.IsZero())
+	assert.True(t, got.FinalizedAt.IsZero())
+	assert.Equal(t, 0, got.Retried)
+
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusPending))
+	got, err = store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusPending, got.Status)
+	assert.Equal(t, 1, got.Retried, "a transition to PENDING is a retry")
+
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusSuccess))
+	got, err = store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusSuccess, got.Status)
+	assert.WithinDuration(t, time.Now(), got.FinalizedAt, time.Minute)
+	assert.Equal(t, 1, got.Retried)
+
+	require.NoError(t, store.CreateTaskExecution(ctx, newTask("task-2")))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-2", uptask.TaskStatusFailed))
+	got, err = store.GetTaskExecution(ctx, "task-2")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusFailed, got.Status)
+	assert.False(t, got.FinalizedAt.IsZero())
+	assert.True(t, got.ScheduledAt.IsZero())
+
+	require.NoError(t, store.CreateTaskExecution(ctx, newTask("task-3")))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-3", uptask.TaskStatusCancelled))
+	got, err = store.GetTaskExecution(ctx, "task-3")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusCancelled, got.Status)
+	assert.False(t, got.FinalizedAt.IsZero())
+	assert.True(t, got.ScheduledAt.IsZero())
+
+	for status, want := range map[uptask.TaskStatus][]string{
+		uptask.TaskStatusPending:   nil,
+		uptask.TaskStatusRunning:   nil,
+		uptask.TaskStatusSuccess:   {"task-1"},
+		uptask.TaskStatusFailed:    {"task-2"},
+		uptask.TaskStatusCancelled: {"task-3"},
+	} {
+		tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(status)})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, want, ids(tasks), "tasks with status %s", status)
+	}
+}
+
+func testAddTaskError(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	require.NoError(t, store.CreateTaskExecution(ctx, newTask("task-1")))
+
+	timestamp := time.Now().Add(-time.Minute)
+	require.NoError(t, store.AddTaskError(ctx, "task-1", uptask.TaskError{
+		Message:   "first",
+		Details:   map[string]interface{}{"code": "E1"},
+		Timestamp: timestamp,
+	}))
+	require.NoError(t, store.AddTaskError(ctx, "task-1", uptask.TaskError{Message: "second"}))
+
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	require.Len(t, got.Errors, 2)
+	assert.Equal(t, "first", got.Errors[0].Message)
+	assert.Equal(t, map[string]interface{}{"code": "E1"}, got.Errors[0].Details)
+	assert.True(t, timestamp.Equal(got.Errors[0].Timestamp))
+	assert.Equal(t, "second", got.Errors[1].Message)
+	assert.WithinDuration(t, time.Now(), got.Errors[1].Timestamp, time.Minute, "Timestamp is set if zero")
+	assert.Equal(t, uptask.TaskStatusPending, got.Status, "errors do not change the status")
+}
+
+func testSnooze(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	require.NoError(t, store.CreateTaskExecution(ctx, newTask("task-1")))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusRunning))
+
+	scheduledAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, store.UpdateTaskSnoozedTask(ctx, "task-1", scheduledAt))
+
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusPending, got.Status)
+	assert.True(t, scheduledAt.Equal(got.ScheduledAt))
+	assert.Equal(t, 1, got.Retried)
+	assert.Equal(t, 4, got.MaxRetries, "snoozing does not use up a retry")
+
+	running, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusRunning)})
+	require.NoError(t, err)
+	assert.Empty(t, running)
+	pending, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusPending)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-1"}, ids(pending))
+}
+
+func testDelete(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2")
+	require.NoError(t, store.AddTaskError(ctx, "task-1", uptask.TaskError{Message: "boom"}))
+
+	require.NoError(t, store.DeleteTaskExecution(ctx, "task-1"))
+	exists, err := store.TaskExists(ctx, "task-1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2"}, ids(tasks))
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusPending)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2"}, ids(tasks))
+}
+
+func testFilterByStatus(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2", "task-3", "task-4")
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-2", uptask.TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-4", uptask.TaskStatusRunning))
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusRunning)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4", "task-2"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(uptask.TaskStatusFailed)})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func testFilterByQueue(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	for i, queue := range []string{"a", "b", "a", "b", "a"} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.Queue = queue
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Queue: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-5", "task-3", "task-1"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Queue: "b", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Queue: "c"})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+}
+
+func testFilterByDate(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2", "task-3", "task-4")
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{
+		FromDate: baseTime.Add(30 * time.Second),
+		ToDate:   baseTime.Add(150 * time.Second),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-3", "task-2"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{FromDate: baseTime.Add(90 * time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4", "task-3"}, ids(tasks), "a zero ToDate is unbounded")
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{ToDate: baseTime.Add(90 * time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2", "task-1"}, ids(tasks), "a zero FromDate is unbounded")
+}
+
+func testFilterByKind(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	for i, kind := range []string{"a", "b", "a", "b"} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.TaskKind = kind
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+	require.NoError(t, store.DeleteTaskExecution(ctx, "task-3"))
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Kind: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-1"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Kind: "b", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Kinds: []string{"a", "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4", "task-2", "task-1"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Kinds: []string{"b"}, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-4"}, ids(tasks))
+}
+
+func testFilterByTags(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	for i, tags := range [][]string{{"x"}, {"x", "y"}, nil, {"y"}} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.Tags = tags
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Tags: []string{"x"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2", "task-1"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Tags: []string{"x", "y"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2"}, ids(tasks), "tasks must have every tag")
+
+	got, err := store.GetTaskExecution(ctx, "task-2")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"x", "y"}, got.Tags)
+
+	// Replacing a task drops its previous tags
+	task := newTask("task-1")
+	task.Tags = []string{"z"}
+	task.CreatedAt = baseTime
+	require.NoError(t, store.CreateTaskExecution(ctx, task))
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Tags: []string{"x"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2"}, ids(tasks))
+}
+
+func testFilterByScheduleID(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	for i, scheduleID := range []string{"s1", "", "s1", "s2"} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.ScheduleID = scheduleID
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{ScheduleID: "s1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-3", "task-1"}, ids(tasks))
+}
+
+func testCombinedFilters(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	for i, queue := range []string{"a", "a", "b", "a", "a"} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.Queue = queue
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+	for _, id := range []string{"task-1", "task-2", "task-3", "task-5"} {
+		require.NoError(t, store.UpdateTaskStatus(ctx, id, uptask.TaskStatusSuccess))
+	}
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{
+		Status:   statusPtr(uptask.TaskStatusSuccess),
+		Queue:    "a",
+		FromDate: baseTime.Add(30 * time.Second),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-5", "task-2"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{
+		Status: statusPtr(uptask.TaskStatusSuccess),
+		ToDate: baseTime.Add(90 * time.Second),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2", "task-1"}, ids(tasks), "the date range applies along with the status")
+}
+
+func testLimitAndOrdering(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	// Created out of order
+	for _, i := range []int{3, 1, 4, 2, 5} {
+		task := newTask(fmt.Sprintf("task-%d", i))
+		task.CreatedAt = baseTime.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-5", "task-4", "task-3", "task-2", "task-1"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-5", "task-4"}, ids(tasks))
+
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 5)
+}
+
+func testCursorPaging(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	// Pairs of tasks created within the same second
+	var want []string
+	for i := 0; i < 7; i++ {
+		task := newTask(fmt.Sprintf("task-%d", i))
+		task.CreatedAt = baseTime.Add(time.Duration(i/2) * time.Minute).Add(time.Duration(i%2) * time.Millisecond)
+		task.Queue = []string{"a", "b"}[i%2]
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+		want = append([]string{task.ID}, want...)
+	}
+	// Within a second, tasks are ordered by descending ID
+	assert.Equal(t, []string{"task-6", "task-5", "task-4", "task-3", "task-2", "task-1", "task-0"}, want)
+
+	var got []string
+	filter := uptask.TaskFilter{Limit: 3}
+	for page := 0; ; page++ {
+		require.Less(t, page, 5, "paging does not terminate")
+		tasks, err := store.ListTaskExecutions(ctx, filter)
+		require.NoError(t, err)
+		got = append(got, ids(tasks)...)
+		if len(tasks) < filter.Limit {
+			break
+		}
+		filter.Cursor = uptask.NextTaskCursor(tasks)
+	}
+	assert.Equal(t, want, got)
+
+	// Paging combines with filters
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Queue: "a", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-6", "task-4"}, ids(tasks))
+	tasks, err = store.ListTaskExecutions(ctx, uptask.TaskFilter{Queue: "a", Limit: 2, Cursor: uptask.NextTaskCursor(tasks)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-2", "task-0"}, ids(tasks))
+
+	assert.Empty(t, uptask.NextTaskCursor(nil))
+}
+
+func testInvalidCursor(t *testing.T, store uptask.TaskStore) {
+	createTasks(t, store, "task-1")
+	_, err := store.ListTaskExecutions(context.Background(), uptask.TaskFilter{Cursor: "not a cursor"})
+	assert.Error(t, err)
+}
+
+func testMostRecent(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2", "task-3")
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-3", uptask.TaskStatusSuccess))
+
+	tasks, err := store.GetMostRecentTaskExecutions(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-3", "task-2"}, ids(tasks))
+}
+
+func testCleanup(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	now := time.Now()
+	for i, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Minute} {
+		task := newTask(fmt.Sprintf("task-%d", i+1))
+		task.CreatedAt = now.Add(-age)
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusSuccess))
+
+	require.NoError(t, store.CleanupOldTaskExecutions(ctx, time.Hour))
+
+	tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"task-3"}, ids(tasks))
+	for _, status := range []uptask.TaskStatus{uptask.TaskStatusPending, uptask.TaskStatusSuccess} {
+		tasks, err := store.ListTaskExecutions(ctx, uptask.TaskFilter{Status: statusPtr(status)})
+		require.NoError(t, err)
+		for _, task := range tasks {
+			assert.Equal(t, "task-3", task.ID, "cleaned up tasks are removed from status %s", status)
+		}
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, store uptask.TaskStore) {
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2")
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.AddTaskError(ctx, "task-1", uptask.TaskError{Message: fmt.Sprintf("error %d", i)}))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.UpdateTaskStatus(ctx, "task-2", uptask.TaskStatusPending))
+		}()
+	}
+	wg.Wait()
+
+	got, err := store.GetTaskExecution(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Len(t, got.Errors, n, "concurrent updates are not lost")
+
+	got, err = store.GetTaskExecution(ctx, "task-2")
+	require.NoError(t, err)
+	assert.Equal(t, n, got.Retried)
+}
+
+func testStats(t *testing.T, store uptask.TaskStore) {
+	statsStore, ok := store.(uptask.StatsStore)
+	if !ok {
+		t.Skip("store does not implement uptask.StatsStore")
+	}
+	ctx := context.Background()
+	createTasks(t, store, "task-1", "task-2", "task-3", "task-4")
+	other := newTask("task-5")
+	other.TaskKind = "OtherTask"
+	other.Queue = "other"
+	require.NoError(t, store.CreateTaskExecution(ctx, other))
+
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusSuccess))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-2", uptask.TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-2", uptask.TaskStatusFailed))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-3", uptask.TaskStatusRunning))
+	require.NoError(t, store.DeleteTaskExecution(ctx, "task-4"))
+
+	stats, err := statsStore.Stats(ctx, uptask.StatsQuery{
+		FromDate:   baseTime.Add(-time.Hour),
+		BucketSize: time.Hour,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[uptask.TaskStatus]int64{
+		uptask.TaskStatusSuccess: 1,
+		uptask.TaskStatusFailed:  1,
+		uptask.TaskStatusRunning: 1,
+		uptask.TaskStatusPending: 1,
+	}, stats.ByStatus)
+	assert.Equal(t, map[string]int64{"TestTask": 3, "OtherTask": 1}, stats.ByKind)
+	assert.Equal(t, map[string]int64{"default": 3, "other": 1}, stats.ByQueue)
+	assert.Equal(t, int64(1), stats.Succeeded)
+	assert.Equal(t, int64(1), stats.Failed)
+	assert.Equal(t, 0.5, stats.SuccessRate)
+	assert.Equal(t, 0.5, stats.FailureRate)
+	// Tasks became ready at their scheduled time, about 23 hours ago
+	assert.Greater(t, stats.QueueLag.P50, 20*time.Hour)
+	assert.Less(t, stats.Duration.P99, time.Minute)
+
+	var created int64
+	for _, bucket := range stats.Buckets {
+		created += bucket.Created
+	}
+	assert.Equal(t, int64(5), created, "deleted tasks still count as created")
+	last := stats.Buckets[len(stats.Buckets)-1]
+	assert.Equal(t, int64(1), last.Succeeded)
+	assert.Equal(t, int64(1), last.Failed)
+	assert.Equal(t, 0.5, last.SuccessRate)
+}
+
+func testWatch(t *testing.T, store uptask.TaskStore) {
+	watcher, ok := store.(uptask.Watcher)
+	if !ok {
+		t.Skip("store does not implement uptask.Watcher")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := uptask.TaskStatusRunning
+	all := watcher.Watch(ctx, uptask.TaskFilter{})
+	filtered := watcher.Watch(ctx, uptask.TaskFilter{Status: &running})
+
+	createTasks(t, store, "task-1")
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", uptask.TaskStatusSuccess))
+	require.NoError(t, store.DeleteTaskExecution(ctx, "task-1"))
+
+	next := func(changes <-chan uptask.TaskChange) uptask.TaskChange {
+		t.Helper()
+		select {
+		case change := <-changes:
+			assert.Equal(t, "task-1", change.TaskID)
+			require.NotNil(t, change.Task)
+			return change
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a change")
+			return uptask.TaskChange{}
+		}
+	}
+	for _, want := range []struct {
+		old, status uptask.TaskStatus
+		deleted     bool
+	}{
+		{"", uptask.TaskStatusPending, false},
+		{uptask.TaskStatusPending, uptask.TaskStatusRunning, false},
+		{uptask.TaskStatusRunning, uptask.TaskStatusSuccess, false},
+		{uptask.TaskStatusSuccess, uptask.TaskStatusSuccess, true},
+	} {
+		change := next(all)
+		assert.Equal(t, want.old, change.OldStatus)
+		assert.Equal(t, want.status, change.Status)
+		assert.Equal(t, want.deleted, change.Deleted)
+		assert.Equal(t, want.status, change.Task.Status)
+	}
+
+	assert.Equal(t, uptask.TaskStatusRunning, next(filtered).Status)
+	assert.Equal(t, uptask.TaskStatusSuccess, next(filtered).Status)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-filtered
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
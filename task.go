@@ -22,7 +22,11 @@ type Container[T any] struct {
 	InsertOpts      InsertOpts
 	Retried         int
 	Scheduled       bool
-	Args            T
+	// EventKind is the kind of the published event, set for tasks processed by
+	// event handlers. It differs from the handler's own event kind when the handler
+	// subscribes with patterns.
+	EventKind string
+	Args      T
 }
 
 type AnyTask struct {
@@ -39,7 +43,7 @@ type AnyTask struct {
 	Args            interface{}
 }
 
-func unmarshalTask[T any](ce cloudevents.Event) (*Container[T], error) {
+func unmarshalTask[T any](ce cloudevents.Event, upcasters map[int]Upcaster) (*Container[T], error) {
 	// Create a new task with the event ID and time.
 	var task = Container[T]{
 		Id:        ce.ID(),
@@ -79,6 +83,13 @@ func unmarshalTask[T any](ce cloudevents.Event) (*Container[T], error) {
 	}
 
 	task.InsertOpts = opts
+	task.EventKind = events.GetEventKind(&ce)
+
+	// Migrate payloads serialized by older versions of the args before decoding.
+	err = upcast[T](&ce, upcasters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upcast task: %w", err)
+	}
 
 	err = events.Deserialize(ce, &task.Args)
 	if err != nil {
@@ -0,0 +1,179 @@
+package uptask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrTaskNotRetryable is returned when retrying a task that neither failed nor was
+	// cancelled.
+	ErrTaskNotRetryable = errors.New("only failed or cancelled tasks can be retried")
+	// ErrTaskNotCancellable is returned when cancelling a task that is not pending.
+	ErrTaskNotCancellable = errors.New("only pending tasks can be cancelled")
+)
+
+// retryBatchSize is the number of executions listed at once by RetryTasks.
+const retryBatchSize = 1000
+
+// storedArgs re-enqueues the args of a stored execution as they were stored.
+type storedArgs struct {
+	kind    string
+	args    any
+	version int
+}
+
+func (a storedArgs) Kind() string                 { return a.kind }
+func (a storedArgs) Payload() any                 { return a.args }
+func (a storedArgs) Version() int                 { return a.version }
+func (a storedArgs) MarshalJSON() ([]byte, error) { return json.Marshal(a.args) }
+
+// retryArgs returns the args to start a copy of task with. Executions of event handlers
+// started by this client store the whole TaskEvent, which is restored so the copy
+// keeps the kind of the published event.
+func (c *TaskClient) retryArgs(task *TaskExecution) TaskArgs {
+	if fields, ok := task.Args.(map[string]any); ok && fields["EventType"] == task.TaskKind {
+		if _, ok := fields["PayloadData"]; ok {
+			argsJSON, err := json.Marshal(fields)
+			var event TaskEvent
+			if err == nil && json.Unmarshal(argsJSON, &event) == nil {
+				return event
+			}
+		}
+	}
+	c.mux.Lock()
+	version := c.versions[task.TaskKind]
+	c.mux.Unlock()
+	return storedArgs{kind: task.TaskKind, args: task.Args, version: version}
+}
+
+// setKindVersion records the version of the args of kind, which is sent along with
+// retried tasks of that kind.
+func (c *TaskClient) setKindVersion(kind string, version int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.versions == nil {
+		c.versions = make(map[string]int)
+	}
+	c.versions[kind] = version
+}
+
+// RetryTask starts a copy of a failed or cancelled task, with the same kind, args,
+// queue, tags and retries, and returns the ID of the copy. The original execution is
+// kept as it is.
+//
+// Args are sent as they were stored. The version of versioned args is known for the
+// kinds registered with the TaskService of the client; other kinds are sent as
+// version 1.
+func (c *TaskClient) RetryTask(ctx context.Context, taskID string) (string, error) {
+	if !c.storeEnabled {
+		return "", fmt.Errorf("no task store configured")
+	}
+	task, err := c.store.GetTaskExecution(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	return c.retry(ctx, task)
+}
+
+func (c *TaskClient) retry(ctx context.Context, task *TaskExecution) (string, error) {
+	if task.Status != TaskStatusFailed && task.Status != TaskStatusCancelled {
+		return "", fmt.Errorf("failed to retry task %s in status %s: %w", task.ID, task.Status, ErrTaskNotRetryable)
+	}
+	return c.StartTask(ctx, c.retryArgs(task), &InsertOpts{
+		MaxRetries: task.MaxRetries,
+		Queue:      task.Queue,
+		Tags:       task.Tags,
+	})
+}
+
+// RetryTasks starts a copy of every failed or cancelled task matching filter, and
+// returns the IDs of the copies. Matching tasks in other statuses are skipped. A
+// filter Limit bounds the number of tasks retried, and the Cursor is ignored.
+func (c *TaskClient) RetryTasks(ctx context.Context, filter TaskFilter) ([]string, error) {
+	if !c.storeEnabled {
+		return nil, fmt.Errorf("no task store configured")
+	}
+	if filter.Status != nil && *filter.Status != TaskStatusFailed && *filter.Status != TaskStatusCancelled {
+		return nil, fmt.Errorf("failed to retry %s tasks: %w", *filter.Status, ErrTaskNotRetryable)
+	}
+
+	limit := filter.Limit
+	filter.Limit = retryBatchSize
+	filter.Cursor = ""
+	var ids []string
+	for {
+		// Copies are created now, before the listed tasks, so they are not listed again
+		tasks, err := c.store.ListTaskExecutions(ctx, filter)
+		if err != nil {
+			return ids, err
+		}
+		for _, task := range tasks {
+			if task.Status != TaskStatusFailed && task.Status != TaskStatusCancelled {
+				continue
+			}
+			id, err := c.retry(ctx, task)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+			if limit > 0 && len(ids) == limit {
+				return ids, nil
+			}
+		}
+		if len(tasks) < filter.Limit {
+			return ids, nil
+		}
+		filter.Cursor = NextTaskCursor(tasks)
+	}
+}
+
+// CancelTask cancels a pending task, including scheduled and snoozed ones. Its
+// messages are acknowledged without running the handler once delivered. Running tasks
+// cannot be cancelled.
+func (c *TaskClient) CancelTask(ctx context.Context, taskID string) error {
+	if !c.storeEnabled {
+		return fmt.Errorf("no task store configured")
+	}
+	task, err := c.store.GetTaskExecution(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status != TaskStatusPending {
+		return fmt.Errorf("failed to cancel task %s in status %s: %w", taskID, task.Status, ErrTaskNotCancellable)
+	}
+	return c.store.UpdateTaskStatus(ctx, taskID, TaskStatusCancelled)
+}
+
+// RegisteredKind describes a task kind handled by a TaskService.
+type RegisteredKind struct {
+	Kind    string   `json:"kind"`
+	Aliases []string `json:"aliases,omitempty"`
+	Version int      `json:"version"`
+}
+
+// RegisteredKinds returns the kinds of the registered handlers, sorted by kind.
+func (c *TaskService) RegisteredKinds() []RegisteredKind {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	kinds := make([]RegisteredKind, 0, len(c.handlersMap))
+	for kind, info := range c.handlersMap {
+		kinds = append(kinds, RegisteredKind{
+			Kind:    kind,
+			Aliases: info.config.aliases,
+			Version: argsVersion(info.taskArgs),
+		})
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].Kind < kinds[j].Kind
+	})
+	return kinds
+}
+
+// Client returns the client the service starts tasks with.
+func (c *TaskService) Client() *TaskClient {
+	return c.client
+}
@@ -0,0 +1,130 @@
+package uptask
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTask(t *testing.T) {
+	ctx := context.Background()
+	transport := &captureTransport{}
+	store := NewMemoryTaskStore()
+	tsvc := NewTaskService(transport, WithStore(store))
+	handler := &emailHandler{}
+	AddTaskHandler(tsvc, handler)
+
+	id, err := tsvc.StartTask(ctx, emailArgsV2{Recipients: []string{"a@example.com"}, Subject: "hi"}, &InsertOpts{
+		MaxRetries: 5,
+		Queue:      "mail",
+		Tags:       []string{"customer:42"},
+	})
+	require.NoError(t, err)
+	transport.take()
+
+	_, err = tsvc.Client().RetryTask(ctx, id)
+	assert.ErrorIs(t, err, ErrTaskNotRetryable)
+
+	require.NoError(t, store.UpdateTaskStatus(ctx, id, TaskStatusFailed))
+	retryID, err := tsvc.Client().RetryTask(ctx, id)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, retryID)
+
+	original, err := store.GetTaskExecution(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusFailed, original.Status)
+
+	retry, err := store.GetTaskExecution(ctx, retryID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusPending, retry.Status)
+	assert.Equal(t, "SendEmail", retry.TaskKind)
+	assert.Equal(t, original.Args, retry.Args)
+	assert.Equal(t, 5, retry.MaxRetries)
+	assert.Equal(t, "mail", retry.Queue)
+	assert.Equal(t, []string{"customer:42"}, retry.Tags)
+
+	sent := transport.take()
+	require.Len(t, sent, 1)
+	version, ok := events.GetVersion(&sent[0].ce)
+	require.True(t, ok)
+	assert.Equal(t, 3, version)
+
+	require.NoError(t, tsvc.HandleEvent(ctx, received(sent[0].ce)))
+	assert.Equal(t, []emailArgsV2{{Recipients: []string{"a@example.com"}, Subject: "hi"}}, handler.received)
+}
+
+func TestRetryTasks(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	client := NewTaskClient(&captureTransport{}, WithClientStore(store))
+
+	statuses := map[string]TaskStatus{
+		"failed-1":  TaskStatusFailed,
+		"failed-2":  TaskStatusFailed,
+		"cancelled": TaskStatusCancelled,
+		"succeeded": TaskStatusSuccess,
+	}
+	for id, status := range statuses {
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: id, TaskKind: "SendEmail", Status: status}))
+	}
+
+	failed := TaskStatusFailed
+	ids, err := client.RetryTasks(ctx, TaskFilter{Status: &failed, Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, ids, 1)
+
+	ids, err = client.RetryTasks(ctx, TaskFilter{Kind: "SendEmail"})
+	require.NoError(t, err)
+	assert.Len(t, ids, 3)
+	assert.Equal(t, 8, store.Len())
+
+	succeeded := TaskStatusSuccess
+	_, err = client.RetryTasks(ctx, TaskFilter{Status: &succeeded})
+	assert.ErrorIs(t, err, ErrTaskNotRetryable)
+}
+
+func TestCancelTask(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	tsvc := NewTaskService(&captureTransport{}, WithStore(store))
+	handler := &emailHandler{}
+	AddTaskHandler(tsvc, handler)
+
+	ce, err := events.Serialize(ctx, emailArgsV2{Recipients: []string{"a@example.com"}})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: ce.ID(), TaskKind: "SendEmail", Status: TaskStatusPending}))
+
+	require.NoError(t, tsvc.Client().CancelTask(ctx, ce.ID()))
+	task, err := store.GetTaskExecution(ctx, ce.ID())
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCancelled, task.Status)
+	assert.False(t, task.FinalizedAt.IsZero())
+
+	// The message of the cancelled task is acknowledged without running the handler
+	require.NoError(t, tsvc.HandleEvent(ctx, received(ce)))
+	assert.Empty(t, handler.received)
+	task, err = store.GetTaskExecution(ctx, ce.ID())
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCancelled, task.Status)
+
+	assert.ErrorIs(t, tsvc.Client().CancelTask(ctx, ce.ID()), ErrTaskNotCancellable)
+}
+
+func TestRegisteredKinds(t *testing.T) {
+	tsvc := NewTaskService(dummyTransport())
+	AddTaskHandler(tsvc, &emailHandler{}, WithKindAliases("LegacyEmail"))
+
+	kinds := tsvc.RegisteredKinds()
+	var email *RegisteredKind
+	for i := range kinds {
+		if kinds[i].Kind == "SendEmail" {
+			email = &kinds[i]
+		}
+	}
+	require.NotNil(t, email)
+	assert.Equal(t, []string{"LegacyEmail"}, email.Aliases)
+	assert.Equal(t, 3, email.Version)
+}
@@ -0,0 +1,180 @@
+package uptask
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Archiver stores task executions before the retention janitor deletes them.
+type Archiver interface {
+	Archive(ctx context.Context, records []ArchiveRecord) error
+}
+
+// ArchiveRecord is an archived task execution, with its errors and, if the store keeps
+// them, its attempts.
+type ArchiveRecord struct {
+	TaskExecution
+	Attempts []TaskAttempt `json:"attempts,omitempty"`
+}
+
+// attemptLister is implemented by stores that keep the attempts of each execution.
+type attemptLister interface {
+	ListTaskAttempts(ctx context.Context, taskID string) ([]TaskAttempt, error)
+}
+
+// archiveRecords builds the archive records of tasks, loading their attempts from
+// store when it keeps them.
+func archiveRecords(ctx context.Context, store TaskStore, tasks []*TaskExecution) ([]ArchiveRecord, error) {
+	lister, _ := baseStore(store).(attemptLister)
+	records := make([]ArchiveRecord, 0, len(tasks))
+	for _, task := range tasks {
+		record := ArchiveRecord{TaskExecution: *task}
+		if lister != nil {
+			attempts, err := lister.ListTaskAttempts(ctx, task.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list attempts of task %s: %w", task.ID, err)
+			}
+			record.Attempts = attempts
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// archiveExt is the extension of the files written by FileArchiver.
+const archiveExt = ".jsonl.gz"
+
+// FileArchiver writes archive records as gzip compressed JSON lines to a local or
+// mounted directory, partitioned by the creation date and kind of the tasks:
+//
+//	<dir>/date=2024-05-01/kind=SendEmail/<timestamp>-<id>.jsonl.gz
+//
+// Every call to Archive writes new files, so archives are never rewritten.
+type FileArchiver struct {
+	dir string
+}
+
+func NewFileArchiver(dir string) *FileArchiver {
+	return &FileArchiver{dir: dir}
+}
+
+func (a *FileArchiver) Archive(ctx context.Context, records []ArchiveRecord) error {
+	partitions := make(map[string][]ArchiveRecord)
+	for _, record := range records {
+		partition := filepath.Join(
+			"date="+record.CreatedAt.UTC().Format(time.DateOnly),
+			"kind="+url.PathEscape(record.TaskKind),
+		)
+		partitions[partition] = append(partitions[partition], record)
+	}
+
+	for partition, records := range partitions {
+		if err := a.write(filepath.Join(a.dir, partition), records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes records to a new file in dir. The file is written under a temporary
+// name and renamed once complete, so readers never see partial archives.
+func (a *FileArchiver) write(dir string, records []ArchiveRecord) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	name := fmt.Sprintf("%d-%s%s", time.Now().UnixNano(), uuid.NewString(), archiveExt)
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(zw)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write archive record: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	return nil
+}
+
+// ReadArchive calls fn with every record archived by FileArchiver under path, which is
+// either an archive file or a directory searched recursively for them.
+func ReadArchive(path string, fn func(record ArchiveRecord) error) error {
+	return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, archiveExt) {
+			return nil
+		}
+		return readArchiveFile(path, fn)
+	})
+}
+
+func readArchiveFile(path string, fn func(record ArchiveRecord) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read archive file %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(zr)
+	for {
+		var record ArchiveRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read archive file %s: %w", path, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportArchive loads the records archived under path back into store, replacing
+// executions with the same ID, and returns the number of records imported. Attempts
+// are kept in the archive but not restored.
+func ImportArchive(ctx context.Context, store TaskStore, path string) (int, error) {
+	imported := 0
+	err := ReadArchive(path, func(record ArchiveRecord) error {
+		task := record.TaskExecution
+		if err := store.CreateTaskExecution(ctx, &task); err != nil {
+			return fmt.Errorf("failed to import task %s: %w", task.ID, err)
+		}
+		imported++
+		return nil
+	})
+	return imported, err
+}
@@ -0,0 +1,87 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileArchiver(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	archiver := NewFileArchiver(dir)
+	var records []ArchiveRecord
+	for i, kind := range []string{"SendEmail", "SendEmail", "pkg/Task"} {
+		task := createTestTask(fmt.Sprintf("task-%d", i))
+		task.TaskKind = kind
+		task.CreatedAt = created
+		task.Errors = []TaskError{{Message: "boom", Timestamp: created}}
+		records = append(records, ArchiveRecord{
+			TaskExecution: *task,
+			Attempts:      []TaskAttempt{{Attempt: 1, Status: TaskStatusFailed, StartedAt: created}},
+		})
+	}
+	require.NoError(t, archiver.Archive(ctx, records))
+
+	files, err := filepath.Glob(filepath.Join(dir, "date=2024-05-01", "kind=*", "*"+archiveExt))
+	require.NoError(t, err)
+	require.Len(t, files, 2, "one file per kind")
+	_, err = os.Stat(filepath.Join(dir, "date=2024-05-01", "kind=pkg%2FTask"))
+	assert.NoError(t, err, "kinds are escaped")
+
+	var read []ArchiveRecord
+	require.NoError(t, ReadArchive(dir, func(record ArchiveRecord) error {
+		read = append(read, record)
+		return nil
+	}))
+	require.Len(t, read, 3)
+	for _, record := range read {
+		assert.Equal(t, "boom", record.Errors[0].Message)
+		assert.Len(t, record.Attempts, 1)
+	}
+
+	store := NewMemoryTaskStore()
+	imported, err := ImportArchive(ctx, store, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, imported)
+	assert.Equal(t, 3, store.Len())
+}
+
+func TestRetentionArchives(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestSQLite(t)
+	task := createTestTask("task-1")
+	task.CreatedAt = time.Now().Add(-48 * time.Hour)
+	require.NoError(t, store.CreateTaskExecution(ctx, task))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusRunning))
+	require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusFailed))
+
+	dir := t.TempDir()
+	tsvc := NewTaskService(&captureTransport{}, WithStore(store), WithRetentionPolicy(RetentionPolicy{
+		TTLs:     map[TaskStatus]time.Duration{TaskStatusFailed: 0},
+		Archiver: NewFileArchiver(dir),
+	}))
+	_, err := tsvc.SweepRetention(ctx)
+	require.NoError(t, err)
+
+	exists, err := store.TaskExists(ctx, "task-1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	var read []ArchiveRecord
+	require.NoError(t, ReadArchive(dir, func(record ArchiveRecord) error {
+		read = append(read, record)
+		return nil
+	}))
+	require.Len(t, read, 1)
+	assert.Equal(t, TaskStatusFailed, read[0].Status)
+	assert.NotEmpty(t, read[0].Attempts, "attempts are loaded from stores that keep them")
+}
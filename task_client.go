@@ -33,6 +33,8 @@ type TaskClient struct {
 	middlewares  []Middleware
 	log          Logger
 	transport    Transport
+	versions     map[string]int // task kind -> args version, for retries
+	hooks        Hooks
 }
 
 func NewTaskClient(transport Transport, opts ...ClientOption) *TaskClient {
@@ -45,6 +47,8 @@ func NewTaskClient(transport Transport, opts ...ClientOption) *TaskClient {
 	for _, opt := range opts {
 		opt(client)
 	}
+	client.transport = observeTransport(client.transport, client.hooks)
+	client.store = observeStore(client.store, client.hooks)
 
 	return client
 }
@@ -62,10 +66,17 @@ func (c *TaskClient) StartTask(ctx context.Context, args TaskArgs, opts *InsertO
 	if opts.MaxRetries == 0 {
 		opts.MaxRetries = 3
 	}
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
 	ce, err := events.SerializeWithExt(ctx, args, events.TaskRetriedExtension, "0")
 	if err != nil {
 		return "", fmt.Errorf("failed to serialize task: %v", err)
 	}
+	if opts.id != "" {
+		ce.SetID(opts.id)
+	}
+	events.SetTags(&ce, opts.Tags)
 
 	// Apply all middleware to the base handler
 	//handler := baseHandler
@@ -89,6 +100,8 @@ func (c *TaskClient) StartTask(ctx context.Context, args TaskArgs, opts *InsertO
 			FinalizedAt:     time.Time{},
 			Errors:          nil,
 			Queue:           opts.Queue,
+			ParentID:        opts.parentID,
+			Tags:            opts.Tags,
 		})
 		if err != nil {
 			return "", fmt.Errorf("failed to create task execution: %w", err)
@@ -99,13 +112,13 @@ func (c *TaskClient) StartTask(ctx context.Context, args TaskArgs, opts *InsertO
 		err = c.transport.Send(ctx, ce, opts)
 		if err != nil {
 			if c.storeEnabled {
-				go func() {
-					c.log.Debug("cleaning up and deleting task", "task", ce.ID())
-					err := c.store.DeleteTaskExecution(context.Background(), ce.ID())
-					if err != nil {
-						c.log.Error("failed to cleanup and delete task", "task", ce.ID(), "error", err)
-					}
-				}()
+				// Delete before returning, so that a retried fan-out task does not
+				// mistake the task for already dispatched.
+				c.log.Debug("cleaning up and deleting task", "task", ce.ID())
+				err := c.store.DeleteTaskExecution(context.WithoutCancel(ctx), ce.ID())
+				if err != nil {
+					c.log.Error("failed to cleanup and delete task", "task", ce.ID(), "error", err)
+				}
 			}
 			return err
 		}
@@ -117,6 +130,7 @@ func (c *TaskClient) StartTask(ctx context.Context, args TaskArgs, opts *InsertO
 	}
 
 	err = publishFunc(ctx, ce)
+	c.hooks.enqueued(ce.Type(), opts.Queue, err)
 	if err != nil {
 		return "", fmt.Errorf("failed to send task: %w", err)
 	}
@@ -0,0 +1,165 @@
+package uptask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/mscno/uptask/internal/httputil"
+)
+
+// ErrTaskNotDeadLettered is returned when replaying a task that was not moved to the
+// dead letter queue.
+var ErrTaskNotDeadLettered = errors.New("only dead-lettered tasks can be replayed")
+
+// DeadLetter is the failure callback QStash sends for a task that used all its
+// retries.
+type DeadLetter struct {
+	DlqID     string `json:"dlq_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	// ResponseStatus and ResponseBody are the last response of the task endpoint.
+	ResponseStatus int    `json:"response_status"`
+	ResponseBody   string `json:"response_body,omitempty"`
+	Retried        int    `json:"retried"`
+	MaxRetries     int    `json:"max_retries"`
+	// Raw is the callback body as sent by QStash, including the task event.
+	Raw        json.RawMessage `json:"raw"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// Event returns the task event QStash failed to deliver.
+func (d *DeadLetter) Event() (cloudevents.Event, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal(d.Raw, &v); err != nil {
+		return cloudevents.Event{}, fmt.Errorf("failed to parse dead letter: %w", err)
+	}
+	return httputil.DecodeDlqSourceBody(v)
+}
+
+// DlqStore stores the dead letters of QStash in a TaskStore. It implements
+// uptaskhttp.DlqStorer.
+type DlqStore struct {
+	store TaskStore
+}
+
+func NewDlqStore(store TaskStore) *DlqStore {
+	return &DlqStore{store: store}
+}
+
+// StoreDlqEvent marks the execution of ce as failed and dead-lettered, keeping
+// letter. Executions missing from the store, such as those of tasks started by another
+// service, are created from ce.
+func (s *DlqStore) StoreDlqEvent(ctx context.Context, ce cloudevents.Event, letter DeadLetter) error {
+	exists, err := s.store.TaskExists(ctx, ce.ID())
+	if err != nil {
+		return fmt.Errorf("failed to store dead letter: %w", err)
+	}
+	var task *TaskExecution
+	if exists {
+		task, err = s.store.GetTaskExecution(ctx, ce.ID())
+		if err != nil {
+			return fmt.Errorf("failed to store dead letter: %w", err)
+		}
+	} else {
+		task, err = newDeadTaskExecution(ce)
+		if err != nil {
+			return fmt.Errorf("failed to store dead letter: %w", err)
+		}
+	}
+
+	if letter.ReceivedAt.IsZero() {
+		letter.ReceivedAt = time.Now()
+	}
+	task.Status = TaskStatusFailed
+	task.Retried = letter.Retried
+	if task.FinalizedAt.IsZero() {
+		task.FinalizedAt = letter.ReceivedAt
+	}
+	task.Errors = append(task.Errors, TaskError{
+		Message:   fmt.Sprintf("moved to dead letter queue after %d retries, last response status %d", letter.Retried, letter.ResponseStatus),
+		Timestamp: letter.ReceivedAt,
+	})
+	task.DeadLetter = &letter
+	if err := s.store.CreateTaskExecution(ctx, task); err != nil {
+		return fmt.Errorf("failed to store dead letter: %w", err)
+	}
+	return nil
+}
+
+// newDeadTaskExecution returns an execution for a task event without one.
+func newDeadTaskExecution(ce cloudevents.Event) (*TaskExecution, error) {
+	var args any
+	if len(ce.Data()) > 0 {
+		if err := json.Unmarshal(ce.Data(), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task args: %w", err)
+		}
+	}
+	opts, err := insertInsertOptsFromEvent(ce)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskExecution{
+		ID:              ce.ID(),
+		TaskKind:        ce.Type(),
+		Args:            args,
+		MaxRetries:      opts.MaxRetries,
+		QstashMessageID: events.GetQstashMessageID(&ce),
+		ScheduleID:      events.GetScheduleID(&ce),
+		CreatedAt:       ce.Time(),
+		ScheduledAt:     opts.ScheduledAt,
+		Queue:           opts.Queue,
+		Tags:            opts.Tags,
+	}, nil
+}
+
+// ReplayDeadLetter publishes a dead-lettered task again with a fresh retry budget.
+// Unlike RetryTask, the event is sent as QStash last delivered it, under the same
+// task ID, and the execution is reset to pending.
+func (c *TaskClient) ReplayDeadLetter(ctx context.Context, taskID string) error {
+	if !c.storeEnabled {
+		return fmt.Errorf("no task store configured")
+	}
+	task, err := c.store.GetTaskExecution(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task.DeadLetter == nil {
+		return fmt.Errorf("failed to replay task %s: %w", taskID, ErrTaskNotDeadLettered)
+	}
+	ce, err := task.DeadLetter.Event()
+	if err != nil {
+		return fmt.Errorf("failed to replay task %s: %w", taskID, err)
+	}
+	ce.SetID(task.ID)
+	events.SetRetried(&ce, 0)
+	events.SetMaxRetries(&ce, task.MaxRetries)
+
+	dead := *task
+	task.Status = TaskStatusPending
+	task.Retried = 0
+	task.ScheduledAt = time.Time{}
+	task.FinalizedAt = time.Time{}
+	task.DeadLetter = nil
+	if err := c.store.CreateTaskExecution(ctx, task); err != nil {
+		return fmt.Errorf("failed to replay task %s: %w", taskID, err)
+	}
+
+	c.log.Info("replaying dead letter", "task", ce.Type(), "id", ce.ID())
+	err = c.transport.Send(ctx, ce, &InsertOpts{
+		MaxRetries: task.MaxRetries,
+		Queue:      task.Queue,
+		Tags:       task.Tags,
+	})
+	if err != nil {
+		// Keep the dead letter, so the task can be replayed again.
+		if err := c.store.CreateTaskExecution(context.WithoutCancel(ctx), &dead); err != nil {
+			c.log.Error("failed to restore dead-lettered task", "task", taskID, "error", err)
+		}
+		return fmt.Errorf("failed to replay task %s: %w", taskID, err)
+	}
+	return nil
+}
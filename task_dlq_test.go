@@ -0,0 +1,102 @@
+package uptask
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadLetterOf returns the failure callback of QStash for ce.
+func deadLetterOf(t *testing.T, ce cloudevents.Event) DeadLetter {
+	body, err := ce.MarshalJSON()
+	require.NoError(t, err)
+	raw, err := json.Marshal(map[string]any{
+		"dlqId":           "dlq-1",
+		"sourceMessageId": "msg-1",
+		"status":          489,
+		"body":            base64.StdEncoding.EncodeToString([]byte("boom")),
+		"retried":         3,
+		"maxRetries":      3,
+		"sourceBody":      base64.StdEncoding.EncodeToString(body),
+	})
+	require.NoError(t, err)
+	return DeadLetter{DlqID: "dlq-1", MessageID: "msg-1", ResponseStatus: 489, ResponseBody: "boom", Retried: 3, MaxRetries: 3, Raw: raw}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	sqliteStore, err := NewSQLiteTaskStore(filepath.Join(t.TempDir(), "tasks.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqliteStore.Close() })
+
+	for name, store := range map[string]TaskStore{"memory": NewMemoryTaskStore(), "sqlite": sqliteStore} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			transport := &captureTransport{}
+			client := NewTaskClient(transport, WithClientStore(store))
+
+			id, err := client.StartTask(ctx, emailArgsV2{Recipients: []string{"a@example.com"}}, &InsertOpts{MaxRetries: 3, Queue: "mail"})
+			require.NoError(t, err)
+			sent := transport.take()
+			require.Len(t, sent, 1)
+
+			assert.ErrorIs(t, client.ReplayDeadLetter(ctx, id), ErrTaskNotDeadLettered)
+
+			ce := received(sent[0].ce)
+			events.SetRetried(&ce, 3)
+			require.NoError(t, NewDlqStore(store).StoreDlqEvent(ctx, ce, deadLetterOf(t, sent[0].ce)))
+
+			dead, err := store.GetTaskExecution(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, TaskStatusFailed, dead.Status)
+			assert.Equal(t, 3, dead.Retried)
+			assert.False(t, dead.FinalizedAt.IsZero())
+			require.NotNil(t, dead.DeadLetter)
+			assert.Equal(t, 489, dead.DeadLetter.ResponseStatus)
+			assert.Equal(t, "boom", dead.DeadLetter.ResponseBody)
+			assert.Len(t, dead.Errors, 1)
+
+			require.NoError(t, client.ReplayDeadLetter(ctx, id))
+			sent = transport.take()
+			require.Len(t, sent, 1)
+			assert.Equal(t, id, sent[0].ce.ID())
+			assert.Equal(t, "SendEmail", sent[0].ce.Type())
+			retried, _ := events.GetRetried(&sent[0].ce)
+			assert.Equal(t, 0, retried)
+			assert.Equal(t, 3, sent[0].opts.MaxRetries)
+			assert.Equal(t, "mail", sent[0].opts.Queue)
+
+			replayed, err := store.GetTaskExecution(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, TaskStatusPending, replayed.Status)
+			assert.Equal(t, 0, replayed.Retried)
+			assert.Nil(t, replayed.DeadLetter)
+			assert.True(t, replayed.FinalizedAt.IsZero())
+		})
+	}
+}
+
+func TestDlqStoreCreatesMissingExecution(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	ce, err := events.Serialize(ctx, emailArgsV2{Recipients: []string{"a@example.com"}})
+	require.NoError(t, err)
+	ce = received(ce)
+	events.SetMaxRetries(&ce, 3)
+
+	require.NoError(t, NewDlqStore(store).StoreDlqEvent(ctx, ce, deadLetterOf(t, ce)))
+
+	task, err := store.GetTaskExecution(ctx, ce.ID())
+	require.NoError(t, err)
+	assert.Equal(t, "SendEmail", task.TaskKind)
+	assert.Equal(t, TaskStatusFailed, task.Status)
+	assert.Equal(t, 3, task.MaxRetries)
+	assert.NotNil(t, task.DeadLetter)
+	assert.Equal(t, map[string]any{"recipients": []any{"a@example.com"}, "subject": ""}, task.Args)
+}
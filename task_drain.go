@@ -0,0 +1,118 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServiceDraining is returned by HandleEvent once Shutdown was called. The task
+	// should be delivered again later, possibly to another instance.
+	ErrServiceDraining = errors.New("task service is shutting down")
+	// ErrServiceOverloaded is returned by HandleEvent when the service already handles
+	// the maximum number of tasks set with WithMaxConcurrency.
+	ErrServiceOverloaded = errors.New("task service is overloaded")
+)
+
+// rejectedDelay is the time the runners of the SQLite and Redis Streams transports wait
+// before delivering a task rejected by a draining or overloaded service again.
+const rejectedDelay = time.Second
+
+// rejected reports whether err is the rejection of a task that HandleEvent did not
+// process, which should be delivered again without using one of its retries.
+func rejected(err error) bool {
+	return errors.Is(err, ErrServiceDraining) || errors.Is(err, ErrServiceOverloaded)
+}
+
+// TaskFailedError is returned by HandleEvent when the handler of a task failed. The
+// failure is recorded in the store, if any, before it is returned.
+type TaskFailedError struct {
+	TaskID string
+	// Final is true when the task will not be retried, because it used all its
+	// retries.
+	Final bool
+	Err   error
+}
+
+func (e *TaskFailedError) Error() string {
+	return "failed to process task: " + e.Err.Error()
+}
+
+func (e *TaskFailedError) Unwrap() error {
+	return e.Err
+}
+
+// WithMaxConcurrency bounds the number of tasks handled at once. HandleEvent rejects
+// tasks beyond it with ErrServiceOverloaded, so they are delivered again later.
+func WithMaxConcurrency(n int) ServiceOption {
+	return func(t *TaskService) {
+		t.admission.max = n
+	}
+}
+
+// admission tracks the tasks being handled, to reject those beyond the maximum
+// concurrency and to drain them on shutdown.
+type admission struct {
+	mux      sync.Mutex
+	max      int
+	active   int
+	draining bool
+	idle     chan struct{} // Closed once draining and no task is active
+}
+
+// enter admits a task, which must leave once handled.
+func (a *admission) enter() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.draining {
+		return ErrServiceDraining
+	}
+	if a.max > 0 && a.active >= a.max {
+		return ErrServiceOverloaded
+	}
+	a.active++
+	return nil
+}
+
+func (a *admission) leave() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.active--
+	if a.draining && a.active == 0 {
+		close(a.idle)
+	}
+}
+
+// drain stops admitting tasks, and returns a channel closed once no task is active.
+func (a *admission) drain() <-chan struct{} {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if !a.draining {
+		a.draining = true
+		a.idle = make(chan struct{})
+		if a.active == 0 {
+			close(a.idle)
+		}
+	}
+	return a.idle
+}
+
+// Shutdown stops accepting tasks, which HandleEvent then rejects with
+// ErrServiceDraining, and waits until the tasks being handled finish or ctx is done.
+func (c *TaskService) Shutdown(ctx context.Context) error {
+	select {
+	case <-c.admission.drain():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining reports whether Shutdown was called.
+func (c *TaskService) Draining() bool {
+	c.admission.mux.Lock()
+	defer c.admission.mux.Unlock()
+	return c.admission.draining
+}
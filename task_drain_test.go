@@ -0,0 +1,105 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingArgs struct{}
+
+func (blockingArgs) Kind() string { return "Blocking" }
+
+type blockingHandler struct {
+	TaskHandlerDefaults[blockingArgs]
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (h *blockingHandler) ProcessTask(ctx context.Context, task *Container[blockingArgs]) error {
+	h.started <- struct{}{}
+	<-h.release
+	return h.err
+}
+
+func TestShutdownDrainsTasks(t *testing.T) {
+	ctx := context.Background()
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	tsvc := NewTaskService(dummyTransport(), WithMaxConcurrency(1))
+	AddTaskHandler(tsvc, handler)
+
+	ce, err := events.Serialize(ctx, blockingArgs{})
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- tsvc.HandleEvent(ctx, received(ce)) }()
+	<-handler.started
+
+	assert.ErrorIs(t, tsvc.HandleEvent(ctx, received(ce)), ErrServiceOverloaded)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tsvc.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	assert.True(t, tsvc.Draining())
+	assert.ErrorIs(t, tsvc.HandleEvent(ctx, received(ce)), ErrServiceDraining)
+
+	close(handler.release)
+	require.NoError(t, <-done)
+	require.NoError(t, tsvc.Shutdown(ctx))
+}
+
+func TestTaskFailedError(t *testing.T) {
+	ctx := context.Background()
+	handlerErr := errors.New("boom")
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{}), err: handlerErr}
+	close(handler.release)
+	tsvc := NewTaskService(dummyTransport(), WithStore(NewMemoryTaskStore()))
+	AddTaskHandler(tsvc, handler)
+
+	for _, tt := range []struct {
+		retried int
+		final   bool
+	}{
+		{retried: 0, final: false},
+		{retried: 3, final: true},
+	} {
+		ce, err := events.Serialize(ctx, blockingArgs{})
+		require.NoError(t, err)
+		require.NoError(t, tsvc.store.CreateTaskExecution(ctx, &TaskExecution{ID: ce.ID(), TaskKind: ce.Type(), Status: TaskStatusPending}))
+		ce = received(ce)
+		events.SetRetried(&ce, tt.retried)
+		events.SetMaxRetries(&ce, 3)
+
+		err = tsvc.HandleEvent(ctx, ce)
+		<-handler.started
+		var failed *TaskFailedError
+		require.ErrorAs(t, err, &failed)
+		assert.Equal(t, ce.ID(), failed.TaskID)
+		assert.Equal(t, tt.final, failed.Final)
+		assert.ErrorIs(t, err, handlerErr)
+	}
+}
+
+func TestSnoozeWithoutDurationFails(t *testing.T) {
+	ctx := context.Background()
+	transport := &captureTransport{}
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{}), err: JobSnooze(0)}
+	close(handler.release)
+	tsvc := NewTaskService(transport)
+	AddTaskHandler(tsvc, handler)
+
+	// The transport delivers the task again with its own backoff and retry budget
+	ce, err := events.Serialize(ctx, blockingArgs{})
+	require.NoError(t, err)
+	err = tsvc.HandleEvent(ctx, received(ce))
+	<-handler.started
+	var failed *TaskFailedError
+	require.ErrorAs(t, err, &failed)
+	assert.False(t, failed.Final)
+	assert.Empty(t, transport.take())
+}
@@ -0,0 +1,108 @@
+package uptask
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TaskFilter provides options for filtering task lists. All set fields must match.
+//
+// Tasks are listed by creation time, newest first, at a resolution of one second, and
+// tasks created within the same second by descending ID. To page through a listing,
+// pass the cursor of the previous page, obtained with NextTaskCursor:
+//
+//	filter := uptask.TaskFilter{Kind: "send_email", Limit: 100}
+//	for {
+//		tasks, err := store.ListTaskExecutions(ctx, filter)
+//		if err != nil || len(tasks) < filter.Limit {
+//			break
+//		}
+//		filter.Cursor = uptask.NextTaskCursor(tasks)
+//	}
+type TaskFilter struct {
+	Status     *TaskStatus
+	Kind       string
+	Kinds      []string // Tasks must have one of the kinds, such as a kind and its aliases
+	Queue      string
+	Tags       []string // Tasks must have every tag
+	ScheduleID string
+	FromDate   time.Time
+	ToDate     time.Time
+	Limit      int
+	Cursor     string
+}
+
+// taskCursor is the position of a task in a listing.
+type taskCursor struct {
+	Created int64  `json:"c"`
+	ID      string `json:"i"`
+}
+
+// NextTaskCursor returns the cursor listing the tasks that follow the last of tasks,
+// which must be a page returned by ListTaskExecutions. It returns an empty cursor if
+// tasks is empty.
+func NextTaskCursor(tasks []*TaskExecution) string {
+	if len(tasks) == 0 {
+		return ""
+	}
+	last := tasks[len(tasks)-1]
+	cursorJSON, _ := json.Marshal(taskCursor{Created: last.CreatedAt.Unix(), ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+// decodeTaskCursor decodes cursor, returning nil for an empty cursor.
+func decodeTaskCursor(cursor string) (*taskCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var c taskCursor
+	if err := json.Unmarshal(cursorJSON, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return &c, nil
+}
+
+// follows reports whether task is listed after the cursor.
+func (c *taskCursor) follows(task *TaskExecution) bool {
+	created := task.CreatedAt.Unix()
+	return created < c.Created || (created == c.Created && task.ID < c.ID)
+}
+
+// matches reports whether task matches every field of the filter except Limit.
+func (f TaskFilter) matches(task *TaskExecution, cursor *taskCursor) bool {
+	if f.Status != nil && task.Status != *f.Status {
+		return false
+	}
+	if f.Kind != "" && task.TaskKind != f.Kind {
+		return false
+	}
+	if len(f.Kinds) > 0 && !slices.Contains(f.Kinds, task.TaskKind) {
+		return false
+	}
+	if f.Queue != "" && task.Queue != f.Queue {
+		return false
+	}
+	if f.ScheduleID != "" && task.ScheduleID != f.ScheduleID {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(task.Tags, tag) {
+			return false
+		}
+	}
+	created := task.CreatedAt.Unix()
+	if !f.FromDate.IsZero() && created < f.FromDate.Unix() {
+		return false
+	}
+	if !f.ToDate.IsZero() && created > f.ToDate.Unix() {
+		return false
+	}
+	return cursor == nil || cursor.follows(task)
+}
@@ -0,0 +1,68 @@
+package uptask
+
+import "context"
+
+// HealthChecker is implemented by the stores, transports and other dependencies of a
+// TaskService that can tell whether they are usable.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// HealthCheckFunc adapts a function to a HealthChecker.
+type HealthCheckFunc func(ctx context.Context) error
+
+func (f HealthCheckFunc) CheckHealth(ctx context.Context) error {
+	return f(ctx)
+}
+
+// WithHealthCheck adds a check to the readiness of the service, next to those of its
+// store and transport.
+func WithHealthCheck(name string, checker HealthChecker) ServiceOption {
+	return func(t *TaskService) {
+		if t.healthChecks == nil {
+			t.healthChecks = make(map[string]HealthChecker)
+		}
+		t.healthChecks[name] = checker
+	}
+}
+
+// Readiness reports whether a TaskService can handle tasks.
+type Readiness struct {
+	Ready    bool `json:"ready"`
+	Draining bool `json:"draining"`
+	// Checks has the result of each check by name, "ok" or the error.
+	Checks map[string]string `json:"checks"`
+	Kinds  []RegisteredKind  `json:"kinds"`
+}
+
+// CheckReadiness runs the health checks of the store and transport of the service,
+// when they implement HealthChecker, and those added with WithHealthCheck. The service
+// is not ready when a check fails or once Shutdown was called.
+func (c *TaskService) CheckReadiness(ctx context.Context) Readiness {
+	checks := map[string]HealthChecker{}
+	if checker, ok := baseStore(c.store).(HealthChecker); ok && c.storeEnabled {
+		checks["store"] = checker
+	}
+	if checker, ok := baseTransport(c.client.transport).(HealthChecker); ok {
+		checks["transport"] = checker
+	}
+	for name, checker := range c.healthChecks {
+		checks[name] = checker
+	}
+
+	readiness := Readiness{
+		Ready:    !c.Draining(),
+		Draining: c.Draining(),
+		Checks:   make(map[string]string, len(checks)),
+		Kinds:    c.RegisteredKinds(),
+	}
+	for name, checker := range checks {
+		if err := checker.CheckHealth(ctx); err != nil {
+			readiness.Ready = false
+			readiness.Checks[name] = err.Error()
+			continue
+		}
+		readiness.Checks[name] = "ok"
+	}
+	return readiness
+}
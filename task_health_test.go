@@ -0,0 +1,54 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	ctx := context.Background()
+	var queueErr error
+	tsvc := NewTaskService(dummyTransport(), WithStore(NewMemoryTaskStore()),
+		WithHealthCheck("queue", HealthCheckFunc(func(ctx context.Context) error { return queueErr })))
+	AddTaskHandler(tsvc, &emailHandler{})
+
+	readiness := tsvc.CheckReadiness(ctx)
+	assert.True(t, readiness.Ready)
+	assert.False(t, readiness.Draining)
+	assert.Equal(t, map[string]string{"store": "ok", "queue": "ok"}, readiness.Checks)
+	var kinds []string
+	for _, kind := range readiness.Kinds {
+		kinds = append(kinds, kind.Kind)
+	}
+	assert.Contains(t, kinds, "SendEmail")
+
+	queueErr = errors.New("queue unreachable")
+	readiness = tsvc.CheckReadiness(ctx)
+	assert.False(t, readiness.Ready)
+	assert.Equal(t, "queue unreachable", readiness.Checks["queue"])
+
+	queueErr = nil
+	require.NoError(t, tsvc.Shutdown(ctx))
+	readiness = tsvc.CheckReadiness(ctx)
+	assert.False(t, readiness.Ready)
+	assert.True(t, readiness.Draining)
+}
+
+func TestUpstashTransportCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	transport, err := NewUpstashTransport("token", "https://example.com")
+	require.NoError(t, err)
+	assert.NoError(t, transport.CheckHealth(ctx))
+
+	transport, err = NewUpstashTransport("", "https://example.com")
+	require.NoError(t, err)
+	assert.Error(t, transport.CheckHealth(ctx))
+
+	transport, err = NewUpstashTransport("token", "https:///tasks")
+	require.NoError(t, err)
+	assert.Error(t, transport.CheckHealth(ctx))
+}
@@ -0,0 +1,204 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// TaskOutcome is the outcome of processing a task.
+type TaskOutcome string
+
+const (
+	TaskSucceeded TaskOutcome = "succeeded"
+	TaskFailed    TaskOutcome = "failed"
+	TaskSnoozed   TaskOutcome = "snoozed"
+)
+
+func taskOutcome(err error) TaskOutcome {
+	switch {
+	case err == nil:
+		return TaskSucceeded
+	case errors.Is(err, &jobSnoozeError{}):
+		return TaskSnoozed
+	default:
+		return TaskFailed
+	}
+}
+
+// Hooks observe a TaskService and its client, such as to record metrics. Hooks left
+// nil are skipped. They are called synchronously, so they must return quickly.
+type Hooks struct {
+	// OnEnqueue is called once StartTask sent a task, or failed to.
+	OnEnqueue func(kind, queue string, err error)
+	// OnSend is called after every send of the transport, including those of snoozed,
+	// fanned-out and replayed tasks.
+	OnSend func(kind, queue string, d time.Duration, err error)
+	// OnTaskStart is called before a handler processes a task. lag is the time since the
+	// task was created, or scheduled to run if later.
+	OnTaskStart func(kind, queue string, lag time.Duration)
+	// OnTaskDone is called after a handler processed a task, with the time it took.
+	OnTaskDone func(kind, queue string, d time.Duration, outcome TaskOutcome)
+	// OnStoreOp is called after every call to the task store, with the name of the
+	// operation, such as "create" or "update_status".
+	OnStoreOp func(op string, d time.Duration, err error)
+}
+
+// WithHooks observes the service and its client with hooks.
+func WithHooks(hooks Hooks) ServiceOption {
+	return func(t *TaskService) {
+		t.hooks = hooks
+	}
+}
+
+// WithClientHooks observes the client with hooks. Only OnEnqueue, OnSend and OnStoreOp
+// apply to a client.
+func WithClientHooks(hooks Hooks) ClientOption {
+	return func(c *TaskClient) {
+		c.hooks = hooks
+	}
+}
+
+func (h Hooks) enqueued(kind, queue string, err error) {
+	if h.OnEnqueue != nil {
+		h.OnEnqueue(kind, queue, err)
+	}
+}
+
+func (h Hooks) taskStarted(kind, queue string, lag time.Duration) {
+	if h.OnTaskStart != nil {
+		h.OnTaskStart(kind, queue, lag)
+	}
+}
+
+func (h Hooks) taskDone(kind, queue string, d time.Duration, err error) {
+	if h.OnTaskDone != nil {
+		h.OnTaskDone(kind, queue, d, taskOutcome(err))
+	}
+}
+
+// queueLag returns the time between receipt and the creation of a task, or the time
+// it was scheduled to run if later.
+func queueLag(received time.Time, ce cloudevents.Event, scheduledAt time.Time) time.Duration {
+	since := ce.Time()
+	if scheduledAt.After(since) {
+		since = scheduledAt
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return received.Sub(since)
+}
+
+// observedTransport calls the OnSend hook after each send.
+type observedTransport struct {
+	Transport
+	onSend func(kind, queue string, d time.Duration, err error)
+}
+
+func observeTransport(transport Transport, hooks Hooks) Transport {
+	if _, ok := transport.(*observedTransport); ok || hooks.OnSend == nil {
+		return transport
+	}
+	return &observedTransport{Transport: transport, onSend: hooks.OnSend}
+}
+
+func (t *observedTransport) Send(ctx context.Context, ce cloudevents.Event, opts *InsertOpts) error {
+	start := time.Now()
+	err := t.Transport.Send(ctx, ce, opts)
+	queue := ""
+	if opts != nil {
+		queue = opts.Queue
+	}
+	t.onSend(ce.Type(), queue, time.Since(start), err)
+	return err
+}
+
+// baseTransport returns the transport observed by transport, if any, to check the
+// interfaces it implements.
+func baseTransport(transport Transport) Transport {
+	if observed, ok := transport.(*observedTransport); ok {
+		return observed.Transport
+	}
+	return transport
+}
+
+// observedStore calls the OnStoreOp hook after each operation.
+type observedStore struct {
+	store TaskStore
+	onOp  func(op string, d time.Duration, err error)
+}
+
+func observeStore(store TaskStore, hooks Hooks) TaskStore {
+	if _, ok := store.(*observedStore); ok || store == nil || hooks.OnStoreOp == nil {
+		return store
+	}
+	return &observedStore{store: store, onOp: hooks.OnStoreOp}
+}
+
+// baseStore returns the store observed by store, if any, to check the interfaces it
+// implements.
+func baseStore(store TaskStore) TaskStore {
+	if observed, ok := store.(*observedStore); ok {
+		return observed.store
+	}
+	return store
+}
+
+// observe calls the OnStoreOp hook with the time since start. Deferred with the named
+// error result, so that it sees the returned error.
+func (s *observedStore) observe(op string, start time.Time, err *error) {
+	s.onOp(op, time.Since(start), *err)
+}
+
+func (s *observedStore) TaskExists(ctx context.Context, taskID string) (_ bool, err error) {
+	defer s.observe("exists", time.Now(), &err)
+	return s.store.TaskExists(ctx, taskID)
+}
+
+func (s *observedStore) CreateTaskExecution(ctx context.Context, task *TaskExecution) (err error) {
+	defer s.observe("create", time.Now(), &err)
+	return s.store.CreateTaskExecution(ctx, task)
+}
+
+func (s *observedStore) GetTaskExecution(ctx context.Context, taskID string) (_ *TaskExecution, err error) {
+	defer s.observe("get", time.Now(), &err)
+	return s.store.GetTaskExecution(ctx, taskID)
+}
+
+func (s *observedStore) DeleteTaskExecution(ctx context.Context, taskID string) (err error) {
+	defer s.observe("delete", time.Now(), &err)
+	return s.store.DeleteTaskExecution(ctx, taskID)
+}
+
+func (s *observedStore) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus) (err error) {
+	defer s.observe("update_status", time.Now(), &err)
+	return s.store.UpdateTaskStatus(ctx, taskID, status)
+}
+
+func (s *observedStore) UpdateTaskSnoozedTask(ctx context.Context, taskID string, scheduledAt time.Time) (err error) {
+	defer s.observe("update_snoozed", time.Now(), &err)
+	return s.store.UpdateTaskSnoozedTask(ctx, taskID, scheduledAt)
+}
+
+func (s *observedStore) AddTaskError(ctx context.Context, taskID string, taskErr TaskError) (err error) {
+	defer s.observe("add_error", time.Now(), &err)
+	return s.store.AddTaskError(ctx, taskID, taskErr)
+}
+
+func (s *observedStore) ListTaskExecutions(ctx context.Context, filter TaskFilter) (_ []*TaskExecution, err error) {
+	defer s.observe("list", time.Now(), &err)
+	return s.store.ListTaskExecutions(ctx, filter)
+}
+
+func (s *observedStore) GetMostRecentTaskExecutions(ctx context.Context, limit int) (_ []*TaskExecution, err error) {
+	defer s.observe("list_recent", time.Now(), &err)
+	return s.store.GetMostRecentTaskExecutions(ctx, limit)
+}
+
+func (s *observedStore) CleanupOldTaskExecutions(ctx context.Context, olderThan time.Duration) (err error) {
+	defer s.observe("cleanup", time.Now(), &err)
+	return s.store.CleanupOldTaskExecutions(ctx, olderThan)
+}
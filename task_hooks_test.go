@@ -0,0 +1,45 @@
+package uptask
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	var (
+		outcomes []TaskOutcome
+		storeOps []string
+	)
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{}), err: JobSnooze(time.Minute)}
+	close(handler.release)
+	tsvc := NewTaskService(&captureTransport{}, WithStore(NewMemoryTaskStore()), WithHooks(Hooks{
+		OnTaskDone: func(kind, queue string, d time.Duration, outcome TaskOutcome) {
+			outcomes = append(outcomes, outcome)
+		},
+		OnStoreOp: func(op string, d time.Duration, err error) {
+			storeOps = append(storeOps, op)
+		},
+	}))
+	AddTaskHandler(tsvc, handler)
+
+	ce, err := events.Serialize(ctx, blockingArgs{})
+	require.NoError(t, err)
+	require.NoError(t, tsvc.store.CreateTaskExecution(ctx, &TaskExecution{ID: ce.ID(), TaskKind: ce.Type(), Status: TaskStatusPending}))
+	require.NoError(t, tsvc.HandleEvent(ctx, received(ce)))
+	<-handler.started
+	assert.Equal(t, []TaskOutcome{TaskSnoozed}, outcomes)
+	assert.Contains(t, storeOps, "update_snoozed")
+
+	// The observed store still exposes the interfaces of the memory store
+	assert.True(t, tsvc.CheckReadiness(ctx).Ready)
+	watchCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = tsvc.WaitForResult(watchCtx, ce.ID())
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -1,18 +1,64 @@
 package uptask
 
 import (
+	"errors"
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/mscno/uptask/internal/events"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// ErrInvalidTag is returned when starting a task with an empty tag or a tag containing
+// a comma, as the tags are sent joined with commas.
+var ErrInvalidTag = errors.New("tags must not be empty or contain commas")
+
 type InsertOpts struct {
 	MaxRetries  int
 	Queue       string
 	ScheduledAt time.Time
 	Tags        []string
+
+	// targetUrl overrides the transport's target URL, used to deliver event tasks
+	// to subscribers registered by other services.
+	targetUrl string
+	// id overrides the generated task ID, used to give the tasks started by the
+	// fan-out worker deterministic IDs.
+	id string
+	// parentID is the ID of the fan-out task that started the task.
+	parentID string
+}
+
+// validate returns an error if the options cannot be sent with a task.
+func (o *InsertOpts) validate() error {
+	for _, tag := range o.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("invalid tag %q: %w", tag, ErrInvalidTag)
+		}
+	}
+	return nil
+}
+
+// merge returns a copy of o with the non-zero fields of override applied.
+func (o *InsertOpts) merge(override *InsertOpts) *InsertOpts {
+	merged := *o
+	if override == nil {
+		return &merged
+	}
+	if override.MaxRetries != 0 {
+		merged.MaxRetries = override.MaxRetries
+	}
+	if override.Queue != "" {
+		merged.Queue = override.Queue
+	}
+	if !override.ScheduledAt.IsZero() {
+		merged.ScheduledAt = override.ScheduledAt
+	}
+	if override.Tags != nil {
+		merged.Tags = override.Tags
+	}
+	return &merged
 }
 
 func (o *InsertOpts) FromCloudEvent(ce cloudevents.Event) error {
@@ -37,6 +83,8 @@ func insertInsertOptsFromEvent(ce cloudevents.Event) (InsertOpts, error) {
 		opts.MaxRetries = maxRetries
 	}
 
+	opts.Tags = events.GetTags(&ce)
+
 	return opts, nil
 }
 
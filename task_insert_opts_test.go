@@ -1,8 +1,10 @@
 package uptask
 
 import (
+	"context"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
@@ -23,3 +25,25 @@ func TestInsertOpts(t *testing.T) {
 	require.Equal(t, "2021-03-15", opts.ScheduledAt.Format("2006-01-02"))
 
 }
+
+func TestInsertOptsTagsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	transport := &captureTransport{}
+	client := NewTaskClient(transport)
+
+	tags := []string{"customer:42", "region eu", "a=b;c"}
+	_, err := client.StartTask(ctx, DummyTask{}, &InsertOpts{Tags: tags})
+	require.NoError(t, err)
+	sent := transport.take()
+	require.Len(t, sent, 1)
+
+	var opts InsertOpts
+	require.NoError(t, opts.FromCloudEvent(sent[0].ce))
+	assert.Equal(t, tags, opts.Tags)
+
+	for _, tag := range []string{"billing,eu", ""} {
+		_, err := client.StartTask(ctx, DummyTask{}, &InsertOpts{Tags: []string{"ok", tag}})
+		assert.ErrorIs(t, err, ErrInvalidTag, tag)
+	}
+	assert.Empty(t, transport.take())
+}
@@ -93,8 +93,8 @@ func (w TaskHandlerDefaults[T]) Timeout(*Container[T]) time.Duration { return ti
 // probably makes sense for most applications because you wouldn't want to start
 // an application with invalid hardcoded runtime configuration. If you want to
 // avoid panics, use AddTaskHandlerSafely instead.
-func AddTaskHandler[T TaskArgs](service *TaskService, handler TaskHandler[T]) {
-	if err := AddTaskHandlerSafely[T](service, handler); err != nil {
+func AddTaskHandler[T TaskArgs](service *TaskService, handler TaskHandler[T], opts ...HandlerOption) {
+	if err := AddTaskHandlerSafely[T](service, handler, opts...); err != nil {
 		panic(err)
 	}
 }
@@ -107,9 +107,10 @@ func AddTaskHandler[T TaskArgs](service *TaskService, handler TaskHandler[T]) {
 // task handler for the same type:
 //
 //	taskservice.AddTaskHandlerSafely[SortArgs](service, &SortTaskHandler{}).
-func AddTaskHandlerSafely[T TaskArgs](service *TaskService, handler TaskHandler[T]) error {
+func AddTaskHandlerSafely[T TaskArgs](service *TaskService, handler TaskHandler[T], opts ...HandlerOption) error {
 	var taskArgs T
-	return service.addTask(taskArgs, "", &taskUnitFactoryWrapper[T]{tasker: handler})
+	cfg := newHandlerConfig(opts)
+	return service.addTask(taskArgs, "", &taskUnitFactoryWrapper[T]{tasker: handler, upcasters: cfg.upcasters}, cfg)
 }
 
 type tasker[T TaskArgs] interface {
@@ -147,18 +148,20 @@ func ProcessTaskFunc[T TaskArgs](f func(context.Context, *Container[T]) error) T
 
 // workUnitFactoryWrapper wraps a Worker to implement workUnitFactory.
 type taskUnitFactoryWrapper[T TaskArgs] struct {
-	tasker tasker[T]
+	tasker    tasker[T]
+	upcasters map[int]Upcaster
 }
 
 func (w *taskUnitFactoryWrapper[T]) MakeUnit(ce cloudevents.Event) taskUnit {
-	return &wrapperTaskUnit[T]{ce: ce, tasker: w.tasker}
+	return &wrapperTaskUnit[T]{ce: ce, tasker: w.tasker, upcasters: w.upcasters}
 }
 
 // wrapperTaskUnit implements taskUnit for a task and Worker.
 type wrapperTaskUnit[T TaskArgs] struct {
-	ce     cloudevents.Event
-	task   *Container[T] // not set until after UnmarshalJob is invoked
-	tasker tasker[T]
+	ce        cloudevents.Event
+	task      *Container[T] // not set until after UnmarshalJob is invoked
+	tasker    tasker[T]
+	upcasters map[int]Upcaster
 }
 
 func (w *wrapperTaskUnit[T]) Timeout() time.Duration { return w.tasker.Timeout(w.task) }
@@ -202,7 +205,7 @@ func executeWithTimeout[T TaskArgs](ctx context.Context, handler TaskHandler[T],
 
 func (w *wrapperTaskUnit[T]) UnmarshalTask() (*AnyTask, *InsertOpts, error) {
 	var err error
-	w.task, err = unmarshalTask[T](w.ce)
+	w.task, err = unmarshalTask[T](w.ce, w.upcasters)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to unmarshal task: %w", err)
 	}
@@ -338,3 +338,41 @@ func TestPublishEventWithHandlers(t *testing.T) {
 	_, err := tsvc.PublishEvent(context.Background(), DummyTask{}, nil)
 	require.NoError(t, err)
 }
+
+func TestKindAliases(t *testing.T) {
+	store, mr := setupTestRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	tsvc := NewTaskService(dummyTransport(), WithStore(store))
+	worker := &DummyTaskProcessor{}
+	AddTaskHandler(tsvc, worker, WithKindAliases("LegacyDummyTask"))
+	require.Equal(t, "DummyTask", tsvc.CanonicalKind("LegacyDummyTask"))
+	require.Equal(t, "Other", tsvc.CanonicalKind("Other"))
+
+	// A task enqueued before the rename, stored under the old kind.
+	ce, err := events.SerializeWithExt(ctx, DummyTask{Name: "legacy"}, events.TaskRetriedExtension, "0")
+	require.NoError(t, err)
+	ce.SetType("LegacyDummyTask")
+	require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{
+		ID:       ce.ID(),
+		TaskKind: "LegacyDummyTask",
+		Status:   TaskStatusPending,
+	}))
+
+	ce.SetExtension(events.ScheduledTaskExtension, "false")
+	ce.SetExtension(events.QstashMessageIdExtension, "123")
+	require.NoError(t, tsvc.HandleEvent(ctx, ce))
+	require.Len(t, worker.Tasks, 1)
+	require.Equal(t, "legacy", worker.Tasks[0].DummyTask.Name)
+
+	execution, err := store.GetTaskExecution(ctx, ce.ID())
+	require.NoError(t, err)
+	require.Equal(t, "DummyTask", execution.TaskKind)
+	require.Equal(t, TaskStatusSuccess, execution.Status)
+
+	t.Run("alias conflicts with registered kind", func(t *testing.T) {
+		err := AddEventHandlerSafely(tsvc, "handler", &DummyEventProcessor{}, WithKindAliases("DummyTask"))
+		require.Error(t, err)
+	})
+}
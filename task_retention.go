@@ -0,0 +1,155 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy configures how long task executions are kept in the store. An
+// execution expires once the TTL of its status has passed since it was finalized, or
+// since it was created if it never was.
+type RetentionPolicy struct {
+	// TTLs maps statuses to how long executions in them are kept, for example a day
+	// for TaskStatusSuccess and 30 days for TaskStatusFailed. Executions in other
+	// statuses are kept forever.
+	TTLs map[TaskStatus]time.Duration
+	// Interval is the time between sweeps of RunJanitor. Defaults to an hour.
+	Interval time.Duration
+	// BatchSize is the number of executions listed and deleted at once. Defaults to
+	// 1000.
+	BatchSize int
+	// Archiver, if set, archives expired executions before they are deleted. Executions
+	// that failed to be archived are kept.
+	Archiver Archiver
+	// OnSweep, if set, is called with the result of every sweep, for example to export
+	// metrics.
+	OnSweep func(RetentionSweep)
+}
+
+// RetentionSweep is the result of a sweep of expired executions.
+type RetentionSweep struct {
+	Deleted  map[TaskStatus]int
+	Duration time.Duration
+	Err      error
+}
+
+// WithRetentionPolicy configures the retention policy applied by RunJanitor and
+// SweepRetention.
+func WithRetentionPolicy(policy RetentionPolicy) ServiceOption {
+	return func(t *TaskService) {
+		if policy.Interval <= 0 {
+			policy.Interval = time.Hour
+		}
+		if policy.BatchSize <= 0 {
+			policy.BatchSize = 1000
+		}
+		t.retention = &policy
+	}
+}
+
+// RunJanitor sweeps expired executions from the store every interval of the retention
+// policy until ctx is cancelled. Failed sweeps are logged and retried at the next
+// interval.
+func (c *TaskService) RunJanitor(ctx context.Context) error {
+	if c.retention == nil {
+		return fmt.Errorf("no retention policy configured")
+	}
+	if !c.storeEnabled {
+		return fmt.Errorf("no task store configured")
+	}
+
+	ticker := time.NewTicker(c.retention.Interval)
+	defer ticker.Stop()
+	for {
+		_, _ = c.SweepRetention(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepRetention deletes every execution that expired under the retention policy, in
+// batches until none is left.
+func (c *TaskService) SweepRetention(ctx context.Context) (RetentionSweep, error) {
+	if c.retention == nil {
+		return RetentionSweep{}, fmt.Errorf("no retention policy configured")
+	}
+	if !c.storeEnabled {
+		return RetentionSweep{}, fmt.Errorf("no task store configured")
+	}
+
+	start := time.Now()
+	sweep := RetentionSweep{Deleted: make(map[TaskStatus]int)}
+	for status, ttl := range c.retention.TTLs {
+		deleted, err := c.sweepStatus(ctx, status, start.Add(-ttl))
+		if deleted > 0 {
+			sweep.Deleted[status] = deleted
+		}
+		if err != nil {
+			sweep.Err = fmt.Errorf("failed to sweep %s tasks: %w", status, err)
+			break
+		}
+	}
+	sweep.Duration = time.Since(start)
+
+	if sweep.Err != nil {
+		c.log.Error("retention sweep failed", "deleted", sweep.Deleted, "duration", sweep.Duration, "error", sweep.Err)
+	} else {
+		c.log.Info("retention sweep completed", "deleted", sweep.Deleted, "duration", sweep.Duration)
+	}
+	if c.retention.OnSweep != nil {
+		c.retention.OnSweep(sweep)
+	}
+	return sweep, sweep.Err
+}
+
+// sweepStatus pages through the executions in status created up to cutoff, and
+// archives and deletes those that also finalized before it.
+func (c *TaskService) sweepStatus(ctx context.Context, status TaskStatus, cutoff time.Time) (int, error) {
+	deleted := 0
+	filter := TaskFilter{
+		Status: &status,
+		ToDate: cutoff,
+		Limit:  c.retention.BatchSize,
+	}
+	for {
+		tasks, err := c.store.ListTaskExecutions(ctx, filter)
+		if err != nil {
+			return deleted, err
+		}
+		expired := make([]*TaskExecution, 0, len(tasks))
+		for _, task := range tasks {
+			expiresFrom := task.FinalizedAt
+			if expiresFrom.IsZero() {
+				expiresFrom = task.CreatedAt
+			}
+			if !expiresFrom.After(cutoff) {
+				expired = append(expired, task)
+			}
+		}
+
+		if c.retention.Archiver != nil && len(expired) > 0 {
+			records, err := archiveRecords(ctx, c.store, expired)
+			if err != nil {
+				return deleted, err
+			}
+			if err := c.retention.Archiver.Archive(ctx, records); err != nil {
+				return deleted, fmt.Errorf("failed to archive tasks: %w", err)
+			}
+		}
+
+		for _, task := range expired {
+			if err := c.store.DeleteTaskExecution(ctx, task.ID); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(tasks) < filter.Limit {
+			return deleted, nil
+		}
+		filter.Cursor = NextTaskCursor(tasks)
+	}
+}
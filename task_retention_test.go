@@ -0,0 +1,75 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store := NewMemoryTaskStore()
+	add := func(id string, status TaskStatus, created, finalized time.Time) {
+		task := createTestTask(id)
+		task.Status = status
+		task.CreatedAt = created
+		task.FinalizedAt = finalized
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("old-success-%d", i), TaskStatusSuccess, now.Add(-48*time.Hour), now.Add(-47*time.Hour))
+	}
+	add("new-success", TaskStatusSuccess, now.Add(-time.Hour), now)
+	// Created long ago, but finalized within its TTL
+	add("late-success", TaskStatusSuccess, now.Add(-48*time.Hour), now.Add(-time.Hour))
+	add("old-failed", TaskStatusFailed, now.Add(-48*time.Hour), now.Add(-47*time.Hour))
+	add("old-cancelled", TaskStatusCancelled, now.Add(-10*24*time.Hour), now.Add(-8*24*time.Hour))
+	add("old-pending", TaskStatusPending, now.Add(-48*time.Hour), time.Time{})
+
+	var sweeps []RetentionSweep
+	tsvc := NewTaskService(&captureTransport{}, WithStore(store), WithRetentionPolicy(RetentionPolicy{
+		TTLs: map[TaskStatus]time.Duration{
+			TaskStatusSuccess:   24 * time.Hour,
+			TaskStatusFailed:    30 * 24 * time.Hour,
+			TaskStatusCancelled: 7 * 24 * time.Hour,
+		},
+		BatchSize: 2,
+		OnSweep:   func(sweep RetentionSweep) { sweeps = append(sweeps, sweep) },
+	}))
+
+	sweep, err := tsvc.SweepRetention(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[TaskStatus]int{TaskStatusSuccess: 5, TaskStatusCancelled: 1}, sweep.Deleted)
+	require.Len(t, sweeps, 1)
+	assert.Equal(t, sweep.Deleted, sweeps[0].Deleted)
+
+	var left []string
+	for _, task := range store.Snapshot() {
+		left = append(left, task.ID)
+	}
+	assert.ElementsMatch(t, []string{"new-success", "late-success", "old-failed", "old-pending"}, left)
+
+	t.Run("janitor stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- tsvc.RunJanitor(ctx) }()
+		cancel()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("janitor did not stop")
+		}
+	})
+
+	t.Run("requires a policy", func(t *testing.T) {
+		_, err := NewTaskService(&captureTransport{}, WithStore(store)).SweepRetention(ctx)
+		assert.Error(t, err)
+	})
+}
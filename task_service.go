@@ -6,14 +6,16 @@ import (
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/samber/oops"
-	"golang.org/x/sync/errgroup"
 	"log/slog"
 	"os"
-	"strings"
 	"sync"
 	"time"
 )
 
+// ErrNoHandler is returned by HandleEvent for events of a kind without a registered
+// handler. Delivering them again cannot succeed.
+var ErrNoHandler = errors.New("no handler registered for task type")
+
 type Handler interface {
 	HandleEvent(context.Context, cloudevents.Event) error
 }
@@ -31,13 +33,20 @@ type TaskService struct {
 	addSystemHandlers bool
 	client            *TaskClient
 	log               Logger
-	mux               sync.Mutex
+	mux               sync.RWMutex
 	handlersAdded     bool
 	store             TaskStore
 	storeEnabled      bool
 	middlewares       []Middleware
 	handlersMap       map[string]handlerInfo // task kind -> handler info
-
+	aliases           map[string]string      // alias kind -> canonical task kind
+	registry          SubscriptionRegistry
+	targetUrl         string
+	subscriptions     []Subscription // event handlers added to this service
+	retention         *RetentionPolicy
+	admission         admission
+	healthChecks      map[string]HealthChecker // added with WithHealthCheck
+	hooks             Hooks
 }
 
 type ServiceOption func(*TaskService)
@@ -62,6 +71,7 @@ func WithStore(s TaskStore) ServiceOption {
 func NewTaskService(transport Transport, opts ...ServiceOption) *TaskService {
 	svc := &TaskService{
 		handlersMap: make(map[string]handlerInfo),
+		aliases:     make(map[string]string),
 		middlewares: make([]Middleware, 0),
 	}
 	if svc.log == nil {
@@ -71,8 +81,9 @@ func NewTaskService(transport Transport, opts ...ServiceOption) *TaskService {
 	for _, opt := range opts {
 		opt(svc)
 	}
+	svc.store = observeStore(svc.store, svc.hooks)
 
-	var clientsopts []ClientOption
+	clientsopts := []ClientOption{WithClientHooks(svc.hooks)}
 	if svc.storeEnabled {
 		clientsopts = append(clientsopts, WithClientStore(svc.store))
 	}
@@ -89,9 +100,10 @@ func NewTaskService(transport Transport, opts ...ServiceOption) *TaskService {
 type handlerInfo struct {
 	taskArgs TaskArgs
 	handler  HandlerFunc
+	config   *handlerConfig
 }
 
-func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFactory taskUnitFactory) error {
+func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFactory taskUnitFactory, cfg *handlerConfig) error {
 	kind := taskArgs.Kind()
 	if kind == "" {
 		return fmt.Errorf("taskKind cannot be empty")
@@ -99,20 +111,23 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 	if taskUnitFactory == nil {
 		return fmt.Errorf("taskUnitFactory cannot be nil")
 	}
-	if !w.addSystemHandlers {
-		w.addSystemHandlers = true
-		AddTaskHandler[EventFanoutArgs](w, &EventFanoutWorker{c: w.client})
-	}
+	w.ensureSystemHandlers()
 
 	w.mux.Lock()
 	defer w.mux.Unlock()
 
-	if _, ok := w.handlersMap[kind]; ok {
-		return fmt.Errorf("handler for kind %q is already registered", kind)
+	for _, k := range append([]string{kind}, cfg.aliases...) {
+		if _, ok := w.handlersMap[k]; ok {
+			return fmt.Errorf("handler for kind %q is already registered", k)
+		}
+		if _, ok := w.aliases[k]; ok {
+			return fmt.Errorf("kind %q is already registered as an alias of %q", k, w.aliases[k])
+		}
 	}
 
 	// Create the base handler for this task type
 	baseHandler := func(ctx context.Context, ce cloudevents.Event) error {
+		received := time.Now()
 		taskUnit := taskUnitFactory.MakeUnit(ce)
 		anyTask, insertOpts, err := taskUnit.UnmarshalTask()
 		if err != nil {
@@ -120,16 +135,23 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 		}
 
 		if w.storeEnabled {
-			// Check if task is first attempt and scheduled
-			// If so, we need to create a new task execution
-			// and update the task status to running
-			alreadyExists, _ := w.store.TaskExists(context.WithoutCancel(ctx), anyTask.Id)
-			if anyTask.Scheduled && !alreadyExists {
+			// Check if the task has no execution yet, either because it originates
+			// from a cron source or because it is an event published by another
+			// service, whose fan-out created the execution in its own store. If so,
+			// we need to create a new task execution and update the task status to
+			// running. Other tasks without an execution fail to start.
+			existing, err := w.store.GetTaskExecution(context.WithoutCancel(ctx), anyTask.Id)
+			alreadyExists := err == nil
+			if alreadyExists && existing.Status == TaskStatusCancelled {
+				w.log.Info("skipping cancelled task", "kind", kind, "id", anyTask.Id)
+				return nil
+			}
+			if !alreadyExists && (anyTask.Scheduled || cfg.event) {
 				if insertOpts.MaxRetries == 0 {
 					w.log.Warn("max retries not set, defaulting to 3", "kind", kind, "id", anyTask.Id)
 					insertOpts.MaxRetries = 3
 				}
-				w.log.Debug("creating new task execution from cron source", "kind", kind, "id", anyTask.Id, "args", anyTask.Args, "insertOpts", insertOpts)
+				w.log.Debug("creating new task execution from external source", "kind", kind, "id", anyTask.Id, "args", anyTask.Args, "insertOpts", insertOpts)
 				err = w.store.CreateTaskExecution(context.WithoutCancel(ctx), &TaskExecution{
 					ID:              ce.ID(),
 					TaskKind:        ce.Type(),
@@ -146,6 +168,7 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 					FinalizedAt:     time.Time{},
 					Errors:          nil,
 					Queue:           insertOpts.Queue,
+					Tags:            insertOpts.Tags,
 				})
 				if err != nil {
 					return fmt.Errorf("failed to create task execution: %w", err)
@@ -160,7 +183,10 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 		}
 
 		w.log.Info("processing task", "kind", kind, "id", anyTask.Id, "retried", anyTask.Retried, "retried", anyTask.Retried, "maxRetries", insertOpts.MaxRetries)
+		w.hooks.taskStarted(kind, insertOpts.Queue, queueLag(received, ce, insertOpts.ScheduledAt))
+		start := time.Now()
 		err = taskUnit.ProcessTask(ctx)
+		w.hooks.taskDone(kind, insertOpts.Queue, time.Since(start), err)
 		err = oops.With("taskArgs", taskArgs, "task", anyTask).Wrap(err)
 
 		if err != nil {
@@ -170,12 +196,20 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 				Details:   nil,
 				Timestamp: time.Now(),
 			}
+			var detailer errorDetailer
+			if errors.As(err, &detailer) {
+				taskErr.Details = detailer.Details()
+			}
 			if w.storeEnabled {
 				if err := w.handleTaskError(context.WithoutCancel(ctx), anyTask.Id, err, taskErr, insertOpts, anyTask.Retried); err != nil {
 					return err
 				}
 			}
-			return fmt.Errorf("failed to process task: %w", err)
+			return &TaskFailedError{
+				TaskID: anyTask.Id,
+				Final:  !errors.Is(err, &jobSnoozeError{}) && !(insertOpts.MaxRetries > 0 && anyTask.Retried < insertOpts.MaxRetries),
+				Err:    err,
+			}
 		}
 
 		if w.storeEnabled {
@@ -201,14 +235,36 @@ func (w *TaskService) addTask(taskArgs TaskArgs, handlerName string, taskUnitFac
 	w.handlersMap[kind] = handlerInfo{
 		taskArgs: taskArgs,
 		handler:  handler,
+		config:   cfg,
+	}
+
+	for _, alias := range cfg.aliases {
+		w.aliases[alias] = kind
 	}
+	w.client.setKindVersion(kind, argsVersion(taskArgs))
 
 	w.handlersAdded = true
-	w.log.Info("task handler registered", "kind", kind)
+	w.log.Info("task handler registered", "kind", kind, "aliases", cfg.aliases)
 
 	return nil
 }
 
+// errorDetailer is implemented by errors that carry details worth recording on the
+// task execution next to the error message.
+type errorDetailer interface {
+	Details() map[string]interface{}
+}
+
+// ensureSystemHandlers registers the handlers the service relies on internally, such
+// as the event fan-out worker, the first time it is called.
+func (w *TaskService) ensureSystemHandlers() {
+	if w.addSystemHandlers {
+		return
+	}
+	w.addSystemHandlers = true
+	AddTaskHandler[EventFanoutArgs](w, &EventFanoutWorker{c: w.client})
+}
+
 func (w *TaskService) handleTaskError(ctx context.Context, taskID string, err error, taskErr TaskError, opts *InsertOpts, retries int) error {
 	//slog.Error("handleTaskError", "taskID", taskID, "err", err, "taskErr", taskErr, "attempt", attempt, "opts", opts)
 	var retryErr *jobSnoozeError
@@ -268,86 +324,53 @@ func (t *TaskService) UseSend(middlewares ...Middleware) {
 // HandleEvent processes a CloudEvent with all registered middleware
 func (w *TaskService) HandleEvent(ctx context.Context, ce cloudevents.Event) error {
 	w.log.Debug("handling event", "type", ce.Type(), "source", ce.Source(), "id", ce.ID())
-	h, ok := w.handlersMap[ce.Type()]
+	if err := w.admission.enter(); err != nil {
+		return err
+	}
+	defer w.admission.leave()
+	w.mux.RLock()
+	kind, aliased := w.aliases[ce.Type()]
+	if !aliased {
+		kind = ce.Type()
+	}
+	h, ok := w.handlersMap[kind]
+	w.mux.RUnlock()
+	if aliased {
+		// Route tasks enqueued under an old kind to the renamed handler, as if
+		// they had been enqueued under the new kind.
+		w.log.Debug("routing aliased task kind", "alias", ce.Type(), "kind", kind, "id", ce.ID())
+		ce.SetType(kind)
+		if w.storeEnabled {
+			w.canonicalizeExecution(context.WithoutCancel(ctx), ce.ID(), kind)
+		}
+	}
 	if !ok {
-		return fmt.Errorf("no handler registered for task type: %s", ce.Type())
+		return fmt.Errorf("%w: %s", ErrNoHandler, ce.Type())
 	}
 	return h.handler(ctx, ce)
 }
 
-type EventFanoutArgs struct {
-	Handlers  []string
-	EventType string
-	Payload   any
-}
-
-func (e EventFanoutArgs) Kind() string {
-	return "_UptaskFanoutTask"
-}
-
-type EventFanoutWorker struct {
-	c *TaskClient
-	TaskHandlerDefaults[EventFanoutArgs]
-}
-
-type TaskEvent struct {
-	PayloadData any
-	EventType   string
-}
-
-func (e TaskEvent) Kind() string {
-	return e.EventType
-}
-
-func (e TaskEvent) Payload() any {
-	return e.PayloadData
-}
-
-type TaskEventGen[T Event] struct {
-	Event       T
-	HandlerName string
-}
-
-func (e TaskEventGen[T]) Kind() string {
-	return fmt.Sprintf("%s/%s", e.HandlerName, e.Event.Kind())
-}
-
-func (w *EventFanoutWorker) ProcessTask(ctx context.Context, task *Container[EventFanoutArgs]) error {
-	var errGroup errgroup.Group
-	for _, handlerKind := range task.Args.Handlers {
-		errGroup.Go(func() error {
-			eventTask := TaskEvent{task.Args.Payload, handlerKind}
-			_, err := w.c.StartTask(ctx, eventTask, &InsertOpts{
-				MaxRetries:  task.InsertOpts.MaxRetries,
-				Queue:       task.InsertOpts.Queue,
-				ScheduledAt: task.InsertOpts.ScheduledAt,
-				Tags:        task.InsertOpts.Tags,
-			})
-			return err
-		})
+// CanonicalKind returns the kind of the handler registered for kind, resolving kind
+// aliases registered with WithKindAliases.
+func (w *TaskService) CanonicalKind(kind string) string {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	if canonical, ok := w.aliases[kind]; ok {
+		return canonical
 	}
-
-	return errGroup.Wait()
+	return kind
 }
 
-func (c *TaskService) PublishEvent(ctx context.Context, event Event, opts *InsertOpts) (string, error) {
-	var handlers []string
-	for k, _ := range c.handlersMap {
-		parts := strings.SplitN(k, "/", 2)
-		if len(parts) > 1 {
-			if event.Kind() == parts[1] {
-				handlers = append(handlers, k)
-			}
-		}
+// canonicalizeExecution moves an execution stored under an alias kind to kind.
+func (w *TaskService) canonicalizeExecution(ctx context.Context, taskID string, kind string) {
+	task, err := w.store.GetTaskExecution(ctx, taskID)
+	if err != nil || task.TaskKind == kind {
+		return
 	}
-	if handlers == nil {
-		return "", fmt.Errorf("no handler registered for event: %s", event.Kind())
+	task.TaskKind = kind
+	if err := w.store.CreateTaskExecution(ctx, task); err != nil {
+		w.log.Warn("failed to store task execution under canonical kind", "id", taskID, "kind", kind, "error", err)
 	}
-	return c.client.StartTask(ctx, EventFanoutArgs{
-		Handlers:  handlers,
-		EventType: event.Kind(),
-		Payload:   event,
-	}, opts)
 }
 
 func (c *TaskService) StartTask(ctx context.Context, args TaskArgs, opts *InsertOpts) (string, error) {
@@ -0,0 +1,328 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsStore is implemented by task stores that can aggregate statistics over task
+// executions without listing them.
+//
+// Implemented by RedisTaskStore and MemoryTaskStore.
+type StatsStore interface {
+	Stats(ctx context.Context, query StatsQuery) (*TaskStats, error)
+}
+
+// MaxStatsBuckets is the maximum number of buckets a stats query may span.
+const MaxStatsBuckets = 1000
+
+// ErrInvalidStatsQuery is returned by Stats for a query whose range is reversed or
+// spans more than MaxStatsBuckets buckets.
+var ErrInvalidStatsQuery = errors.New("invalid stats query")
+
+// defaultStatsRetention is how long the per minute activity counters are queried for,
+// unless the store is configured otherwise.
+const defaultStatsRetention = 7 * 24 * time.Hour
+
+// StatsQuery selects the time range the statistics are bucketed over. The range is
+// clamped to now and to the retention of the store.
+type StatsQuery struct {
+	FromDate time.Time // Defaults to a day before ToDate
+	ToDate   time.Time // Defaults to now
+	// BucketSize is rounded up to a whole minute and defaults to an hour.
+	BucketSize time.Duration
+}
+
+// TaskStats holds the counts of the stored executions and the activity over the
+// queried time range.
+type TaskStats struct {
+	// Counts of the currently stored executions
+	ByStatus map[TaskStatus]int64 `json:"by_status"`
+	ByKind   map[string]int64     `json:"by_kind"`
+	ByQueue  map[string]int64     `json:"by_queue"`
+
+	// Activity over the whole range
+	Succeeded   int64       `json:"succeeded"`
+	Failed      int64       `json:"failed"`
+	SuccessRate float64     `json:"success_rate"`
+	FailureRate float64     `json:"failure_rate"`
+	Duration    Percentiles `json:"duration"`
+	QueueLag    Percentiles `json:"queue_lag"`
+
+	Buckets []StatsBucket `json:"buckets"`
+}
+
+// StatsBucket holds the activity of a time bucket. Executions are counted as created,
+// finalized and started in the buckets of their CreatedAt, FinalizedAt and first
+// AttemptedAt respectively.
+type StatsBucket struct {
+	Start       time.Time   `json:"start"`
+	Created     int64       `json:"created"`
+	Succeeded   int64       `json:"succeeded"`
+	Failed      int64       `json:"failed"`
+	SuccessRate float64     `json:"success_rate"`
+	FailureRate float64     `json:"failure_rate"`
+	Duration    Percentiles `json:"duration"`
+	QueueLag    Percentiles `json:"queue_lag"`
+}
+
+// Percentiles of a duration distribution. Durations are recorded in logarithmic
+// buckets, so each percentile is an upper bound within about 20% of the exact value.
+type Percentiles struct {
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+}
+
+// statsResolution is the granularity at which activity is counted. Query buckets are
+// whole multiples of it.
+const statsResolution = time.Minute
+
+// Fields of the counters kept for the stored executions and for each minute of
+// activity.
+const (
+	statsStatusField    = "status:"
+	statsKindField      = "kind:"
+	statsQueueField     = "queue:"
+	statsCreatedField   = "created"
+	statsSucceededField = "succeeded"
+	statsFailedField    = "failed"
+	statsDurationField  = "duration:" // followed by a histogram bucket
+	statsLagField       = "lag:"      // followed by a histogram bucket
+)
+
+// statsChange is an increment of a counter. Minute is zero for the counters of the
+// stored executions, otherwise it is the unix minute of the activity counted.
+type statsChange struct {
+	minute int64
+	field  string
+	delta  int64
+}
+
+// statsChanges returns the counter increments of replacing old with task, either of
+// which is nil when the execution is created or deleted.
+//
+// Queue lag is the time from when a task could first run, its creation or scheduled
+// time, to its first attempt. Duration is the time from the last attempt to
+// finalization.
+func statsChanges(old, task *TaskExecution) []statsChange {
+	var changes []statsChange
+	count := func(t *TaskExecution, delta int64) {
+		changes = append(changes,
+			statsChange{field: statsStatusField + string(t.Status), delta: delta},
+			statsChange{field: statsKindField + t.TaskKind, delta: delta},
+			statsChange{field: statsQueueField + t.Queue, delta: delta},
+		)
+	}
+	if old != nil {
+		count(old, -1)
+	}
+	if task == nil {
+		return changes
+	}
+	count(task, 1)
+
+	if old == nil {
+		changes = append(changes, statsChange{minute: statsMinute(task.CreatedAt), field: statsCreatedField, delta: 1})
+	}
+
+	if !task.AttemptedAt.IsZero() && (old == nil || old.AttemptedAt.IsZero()) {
+		ready := task.CreatedAt
+		if old != nil && old.ScheduledAt.After(ready) {
+			ready = old.ScheduledAt
+		}
+		lag := max(task.AttemptedAt.Sub(ready), 0)
+		changes = append(changes, statsChange{minute: statsMinute(task.AttemptedAt), field: statsLagField + strconv.Itoa(histogramBucket(lag)), delta: 1})
+	}
+
+	if isFinal(task.Status) && !task.FinalizedAt.IsZero() && (old == nil || !isFinal(old.Status)) {
+		minute := statsMinute(task.FinalizedAt)
+		field := statsSucceededField
+		if task.Status == TaskStatusFailed {
+			field = statsFailedField
+		}
+		changes = append(changes, statsChange{minute: minute, field: field, delta: 1})
+		if !task.AttemptedAt.IsZero() {
+			duration := max(task.FinalizedAt.Sub(task.AttemptedAt), 0)
+			changes = append(changes, statsChange{minute: minute, field: statsDurationField + strconv.Itoa(histogramBucket(duration)), delta: 1})
+		}
+	}
+	return changes
+}
+
+func isFinal(status TaskStatus) bool {
+	return status == TaskStatusSuccess || status == TaskStatusFailed
+}
+
+func statsMinute(t time.Time) int64 {
+	return t.Unix() / int64(statsResolution/time.Second)
+}
+
+// histogramBucket returns the logarithmic bucket of d, four buckets per doubling of
+// milliseconds.
+func histogramBucket(d time.Duration) int {
+	ms := float64(d) / float64(time.Millisecond)
+	return int(math.Floor(4 * math.Log2(ms+1)))
+}
+
+// histogramBound returns the upper bound of a logarithmic bucket.
+func histogramBound(bucket int) time.Duration {
+	ms := math.Exp2(float64(bucket+1)/4) - 1
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// percentiles computes the percentiles of a histogram of bucket counts.
+func percentiles(histogram map[int]int64) Percentiles {
+	var total int64
+	buckets := make([]int, 0, len(histogram))
+	for bucket, n := range histogram {
+		buckets = append(buckets, bucket)
+		total += n
+	}
+	if total == 0 {
+		return Percentiles{}
+	}
+	sort.Ints(buckets)
+	at := func(p float64) time.Duration {
+		rank := int64(math.Ceil(p * float64(total)))
+		var seen int64
+		for _, bucket := range buckets {
+			seen += histogram[bucket]
+			if seen >= rank {
+				return histogramBound(bucket)
+			}
+		}
+		return histogramBound(buckets[len(buckets)-1])
+	}
+	return Percentiles{P50: at(0.50), P95: at(0.95), P99: at(0.99)}
+}
+
+// normalize fills in the defaults of q, clamps its range to now and to retention, if
+// positive, and aligns it to its buckets.
+func (q StatsQuery) normalize(retention time.Duration) (StatsQuery, error) {
+	if !q.FromDate.IsZero() && !q.ToDate.IsZero() && q.FromDate.After(q.ToDate) {
+		return q, fmt.Errorf("%w: from is after to", ErrInvalidStatsQuery)
+	}
+	now := time.Now()
+	if q.ToDate.IsZero() || q.ToDate.After(now) {
+		q.ToDate = now
+	}
+	if q.FromDate.IsZero() {
+		q.FromDate = q.ToDate.Add(-24 * time.Hour)
+	}
+	if oldest := now.Add(-retention); retention > 0 && q.FromDate.Before(oldest) {
+		q.FromDate = oldest
+	}
+	if q.FromDate.After(q.ToDate) {
+		// The range lies entirely in the future or past the retention
+		q.FromDate = q.ToDate
+	}
+	if q.BucketSize <= 0 {
+		q.BucketSize = time.Hour
+	}
+	q.BucketSize = (q.BucketSize + statsResolution - 1).Truncate(statsResolution)
+	q.FromDate = q.FromDate.Truncate(q.BucketSize)
+
+	minutesPerBucket := int64(q.BucketSize / statsResolution)
+	if n := (statsMinute(q.ToDate)-statsMinute(q.FromDate))/minutesPerBucket + 1; n > MaxStatsBuckets {
+		return q, fmt.Errorf("%w: spans %d buckets, more than %d", ErrInvalidStatsQuery, n, MaxStatsBuckets)
+	}
+	return q, nil
+}
+
+// minutes returns the unix minutes covered by q, which must be normalized.
+func (q StatsQuery) minutes() []int64 {
+	var minutes []int64
+	for m := statsMinute(q.FromDate); m <= statsMinute(q.ToDate); m++ {
+		minutes = append(minutes, m)
+	}
+	return minutes
+}
+
+// buildStats aggregates the counters of the stored executions and the per minute
+// activity counters into the statistics answering q, which must be normalized.
+func buildStats(q StatsQuery, totals map[string]int64, activity map[int64]map[string]int64) *TaskStats {
+	stats := &TaskStats{
+		ByStatus: make(map[TaskStatus]int64),
+		ByKind:   make(map[string]int64),
+		ByQueue:  make(map[string]int64),
+	}
+	for field, n := range totals {
+		if n <= 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(field, statsStatusField):
+			stats.ByStatus[TaskStatus(strings.TrimPrefix(field, statsStatusField))] = n
+		case strings.HasPrefix(field, statsKindField):
+			stats.ByKind[strings.TrimPrefix(field, statsKindField)] = n
+		case strings.HasPrefix(field, statsQueueField):
+			stats.ByQueue[strings.TrimPrefix(field, statsQueueField)] = n
+		}
+	}
+
+	durations, lags := make(map[int]int64), make(map[int]int64)
+	minutesPerBucket := int64(q.BucketSize / statsResolution)
+	first := statsMinute(q.FromDate)
+	var bucket *StatsBucket
+	var bucketDurations, bucketLags map[int]int64
+	closeBucket := func() {
+		if bucket == nil {
+			return
+		}
+		bucket.SuccessRate, bucket.FailureRate = rates(bucket.Succeeded, bucket.Failed)
+		bucket.Duration = percentiles(bucketDurations)
+		bucket.QueueLag = percentiles(bucketLags)
+		stats.Buckets = append(stats.Buckets, *bucket)
+	}
+	for _, minute := range q.minutes() {
+		if (minute-first)%minutesPerBucket == 0 {
+			closeBucket()
+			start := time.Unix(minute*int64(statsResolution/time.Second), 0)
+			bucket = &StatsBucket{Start: start}
+			bucketDurations, bucketLags = make(map[int]int64), make(map[int]int64)
+		}
+		for field, n := range activity[minute] {
+			switch {
+			case field == statsCreatedField:
+				bucket.Created += n
+			case field == statsSucceededField:
+				bucket.Succeeded += n
+				stats.Succeeded += n
+			case field == statsFailedField:
+				bucket.Failed += n
+				stats.Failed += n
+			case strings.HasPrefix(field, statsDurationField):
+				if b, err := strconv.Atoi(strings.TrimPrefix(field, statsDurationField)); err == nil {
+					bucketDurations[b] += n
+					durations[b] += n
+				}
+			case strings.HasPrefix(field, statsLagField):
+				if b, err := strconv.Atoi(strings.TrimPrefix(field, statsLagField)); err == nil {
+					bucketLags[b] += n
+					lags[b] += n
+				}
+			}
+		}
+	}
+	closeBucket()
+
+	stats.SuccessRate, stats.FailureRate = rates(stats.Succeeded, stats.Failed)
+	stats.Duration = percentiles(durations)
+	stats.QueueLag = percentiles(lags)
+	return stats
+}
+
+func rates(succeeded, failed int64) (float64, float64) {
+	finalized := succeeded + failed
+	if finalized == 0 {
+		return 0, 0
+	}
+	return float64(succeeded) / float64(finalized), float64(failed) / float64(finalized)
+}
@@ -0,0 +1,64 @@
+package uptask
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentiles(t *testing.T) {
+	histogram := make(map[int]int64)
+	for i := 1; i <= 100; i++ {
+		histogram[histogramBucket(time.Duration(i)*time.Second)]++
+	}
+	p := percentiles(histogram)
+
+	// Each percentile is an upper bound within about 20% of the exact value
+	for _, tc := range []struct {
+		got, want time.Duration
+	}{{p.P50, 50 * time.Second}, {p.P95, 95 * time.Second}, {p.P99, 99 * time.Second}} {
+		assert.GreaterOrEqual(t, tc.got, tc.want)
+		assert.Less(t, tc.got, tc.want*6/5)
+	}
+	assert.Equal(t, Percentiles{}, percentiles(nil))
+}
+
+func TestStatsQueryNormalize(t *testing.T) {
+	to := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	q, err := StatsQuery{ToDate: to, BucketSize: 90 * time.Second}.normalize(0)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, q.BucketSize)
+	assert.Equal(t, to.Add(-24*time.Hour), q.FromDate)
+
+	q, err = StatsQuery{FromDate: to.Add(-time.Hour), ToDate: to}.normalize(0)
+	require.NoError(t, err)
+	stats := buildStats(q, nil, map[int64]map[string]int64{
+		statsMinute(to): {statsCreatedField: 2},
+	})
+	if assert.Len(t, stats.Buckets, 2) {
+		assert.Equal(t, to.Truncate(time.Hour), stats.Buckets[1].Start.UTC())
+		assert.Equal(t, int64(2), stats.Buckets[1].Created)
+	}
+}
+
+func TestStatsQueryBounds(t *testing.T) {
+	now := time.Now()
+
+	// The range is clamped to now and to the retention
+	q, err := StatsQuery{FromDate: now.Add(-30 * 24 * time.Hour), ToDate: now.Add(time.Hour)}.normalize(48 * time.Hour)
+	require.NoError(t, err)
+	assert.False(t, q.ToDate.After(time.Now()))
+	assert.False(t, q.FromDate.Before(now.Add(-49*time.Hour)))
+
+	_, err = StatsQuery{FromDate: now, ToDate: now.Add(-time.Hour)}.normalize(0)
+	assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+
+	_, err = StatsQuery{FromDate: now.Add(-24 * time.Hour), BucketSize: time.Minute}.normalize(0)
+	assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+
+	_, err = NewMemoryTaskStore().Stats(context.Background(), StatsQuery{FromDate: now.Add(-365 * 24 * time.Hour), BucketSize: time.Minute})
+	assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+}
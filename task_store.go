@@ -13,6 +13,8 @@ const (
 	TaskStatusRunning TaskStatus = "RUNNING"
 	TaskStatusSuccess TaskStatus = "SUCCESS"
 	TaskStatusFailed  TaskStatus = "FAILED"
+	// TaskStatusCancelled marks a task that was stopped before it finished.
+	TaskStatusCancelled TaskStatus = "CANCELLED"
 )
 
 // TaskExecution represents a single execution attempt of a task
@@ -42,6 +44,18 @@ type TaskExecution struct {
 	// Error tracking
 	Errors []TaskError `json:"errors,omitempty"`
 	Queue  string      `json:"queue"`
+	Tags   []string    `json:"tags,omitempty"`
+
+	// ParentID is the ID of the fan-out task that started this task, if any.
+	ParentID string `json:"parent_id,omitempty"`
+
+	// DeadLetter is the failure callback of QStash, set once the task used all its
+	// retries and was moved to the dead letter queue.
+	DeadLetter *DeadLetter `json:"dead_letter,omitempty"`
+
+	// Dispatches are the tasks a fan-out task started for the subscribers of its event,
+	// with the outcome of its last attempt for each of them.
+	Dispatches []FanoutDispatch `json:"dispatches,omitempty"`
 }
 
 // TaskError represents an error that occurred during task execution
@@ -51,15 +65,6 @@ type TaskError struct {
 	Timestamp time.Time              `json:"timestamp"`
 }
 
-// TaskFilter provides options for filtering task lists
-type TaskFilter struct {
-	Status   *TaskStatus
-	Queue    string
-	FromDate time.Time
-	ToDate   time.Time
-	Limit    int
-}
-
 // TaskStore defines the interface for task storage operations
 type TaskStore interface {
 	// Core operations
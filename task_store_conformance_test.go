@@ -0,0 +1,45 @@
+package uptask_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/storetest"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisTaskStoreConformance(t *testing.T) {
+	storetest.Run(t, func() uptask.TaskStore {
+		mr := miniredis.RunT(t)
+		store, err := uptask.NewRedisTaskStore(uptask.RedisConfig{Addr: mr.Addr()})
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestMemoryTaskStoreConformance(t *testing.T) {
+	storetest.Run(t, func() uptask.TaskStore {
+		return uptask.NewMemoryTaskStore()
+	})
+}
+
+func TestSQLiteTaskStoreConformance(t *testing.T) {
+	storetest.Run(t, func() uptask.TaskStore {
+		store, err := uptask.NewSQLiteTaskStore(filepath.Join(t.TempDir(), "tasks.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+func TestRedisClusterTaskStoreConformance(t *testing.T) {
+	storetest.Run(t, func() uptask.TaskStore {
+		mr := miniredis.RunT(t)
+		client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+		t.Cleanup(func() { _ = client.Close() })
+		return uptask.NewRedisTaskStoreFromClient(client)
+	})
+}
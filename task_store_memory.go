@@ -0,0 +1,358 @@
+package uptask
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryTaskStore is a thread-safe in-memory TaskStore for tests and local
+// development. It has the same semantics as RedisTaskStore: executions are stored as
+// JSON, so Args read back are decoded into generic JSON values, and lists are ordered
+// by creation time, newest first.
+type MemoryTaskStore struct {
+	mux      sync.RWMutex
+	tasks    map[string][]byte
+	statuses map[TaskStatus]map[string]struct{}
+
+	// Counters of the stored executions and of the activity per unix minute
+	totals   map[string]int64
+	activity map[int64]map[string]int64
+
+	watchers map[chan TaskChange]TaskFilter
+}
+
+func NewMemoryTaskStore() *MemoryTaskStore {
+	s := &MemoryTaskStore{watchers: make(map[chan TaskChange]TaskFilter)}
+	s.Reset()
+	return s
+}
+
+// get decodes the execution stored under taskID. The caller must hold the lock.
+func (s *MemoryTaskStore) get(taskID string) (*TaskExecution, error) {
+	taskJSON, ok := s.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("task not found: %s", taskID)
+	}
+	var task TaskExecution
+	if err := json.Unmarshal(taskJSON, &task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+	return &task, nil
+}
+
+// put stores task in place of old, which is nil if the task is new, and moves it to
+// the index of its status. The caller must hold the lock.
+func (s *MemoryTaskStore) put(task *TaskExecution, old *TaskExecution) error {
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+	s.tasks[task.ID] = taskJSON
+	if old != nil {
+		delete(s.statuses[old.Status], task.ID)
+	}
+	if s.statuses[task.Status] == nil {
+		s.statuses[task.Status] = make(map[string]struct{})
+	}
+	s.statuses[task.Status][task.ID] = struct{}{}
+	s.count(old, task)
+	s.notify(old, task)
+	return nil
+}
+
+// remove deletes task. The caller must hold the lock.
+func (s *MemoryTaskStore) remove(task *TaskExecution) {
+	delete(s.tasks, task.ID)
+	delete(s.statuses[task.Status], task.ID)
+	s.count(task, nil)
+	s.notify(task, nil)
+}
+
+// notify sends the change of replacing old with task to the matching watchers,
+// dropping it for those that fell behind. The caller must hold the lock.
+func (s *MemoryTaskStore) notify(old, task *TaskExecution) {
+	if len(s.watchers) == 0 {
+		return
+	}
+	if task != nil {
+		// Send a copy, so that watchers do not share the caller's execution
+		stored, err := s.get(task.ID)
+		if err != nil {
+			return
+		}
+		task = stored
+	}
+	change := newTaskChange(old, task)
+	for ch, filter := range s.watchers {
+		if !change.matches(filter) {
+			continue
+		}
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// count applies the statistics counter changes of replacing old with task. The caller
+// must hold the lock.
+func (s *MemoryTaskStore) count(old, task *TaskExecution) {
+	for _, change := range statsChanges(old, task) {
+		if change.minute == 0 {
+			s.totals[change.field] += change.delta
+			continue
+		}
+		if s.activity[change.minute] == nil {
+			s.activity[change.minute] = make(map[string]int64)
+		}
+		s.activity[change.minute][change.field] += change.delta
+	}
+}
+
+func (s *MemoryTaskStore) CreateTaskExecution(ctx context.Context, task *TaskExecution) error {
+	// Set created time if not set
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	old, err := s.get(task.ID)
+	if err != nil {
+		old = nil
+	}
+	return s.put(task, old)
+}
+
+func (s *MemoryTaskStore) GetTaskExecution(ctx context.Context, taskID string) (*TaskExecution, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.get(taskID)
+}
+
+func (s *MemoryTaskStore) TaskExists(ctx context.Context, taskID string) (bool, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	_, ok := s.tasks[taskID]
+	return ok, nil
+}
+
+func (s *MemoryTaskStore) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	task, err := s.get(taskID)
+	if err != nil {
+		return err
+	}
+
+	old := *task
+	task.Status = status
+	if status == TaskStatusRunning {
+		task.AttemptedAt = time.Now()
+		task.ScheduledAt = time.Time{}
+	}
+	if status == TaskStatusSuccess || status == TaskStatusFailed || status == TaskStatusCancelled {
+		task.FinalizedAt = time.Now()
+		task.ScheduledAt = time.Time{}
+	}
+	if status == TaskStatusPending {
+		task.Retried++
+	}
+	return s.put(task, &old)
+}
+
+func (s *MemoryTaskStore) UpdateTaskSnoozedTask(ctx context.Context, taskID string, scheduledAt time.Time) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	task, err := s.get(taskID)
+	if err != nil {
+		return err
+	}
+
+	old := *task
+	task.Status = TaskStatusPending
+	task.ScheduledAt = scheduledAt
+	task.Retried++
+	task.MaxRetries++
+	return s.put(task, &old)
+}
+
+func (s *MemoryTaskStore) DeleteTaskExecution(ctx context.Context, taskID string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	task, err := s.get(taskID)
+	if err != nil {
+		return fmt.Errorf("failed to get task for deletion: %w", err)
+	}
+	s.remove(task)
+	return nil
+}
+
+func (s *MemoryTaskStore) AddTaskError(ctx context.Context, taskID string, taskError TaskError) error {
+	// Set error timestamp if not set
+	if taskError.Timestamp.IsZero() {
+		taskError.Timestamp = time.Now()
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	task, err := s.get(taskID)
+	if err != nil {
+		return err
+	}
+	old := *task
+	task.Errors = append(task.Errors, taskError)
+	return s.put(task, &old)
+}
+
+// sortTasks orders tasks by creation time in seconds, newest first, breaking ties by
+// descending ID as a Redis sorted set does.
+func sortTasks(tasks []*TaskExecution) {
+	sort.Slice(tasks, func(i, j int) bool {
+		ci, cj := tasks[i].CreatedAt.Unix(), tasks[j].CreatedAt.Unix()
+		if ci != cj {
+			return ci > cj
+		}
+		return tasks[i].ID > tasks[j].ID
+	})
+}
+
+func (s *MemoryTaskStore) ListTaskExecutions(ctx context.Context, filter TaskFilter) ([]*TaskExecution, error) {
+	cursor, err := decodeTaskCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	var ids []string
+	if filter.Status != nil {
+		for id := range s.statuses[*filter.Status] {
+			ids = append(ids, id)
+		}
+	} else {
+		for id := range s.tasks {
+			ids = append(ids, id)
+		}
+	}
+
+	tasks := make([]*TaskExecution, 0, len(ids))
+	for _, id := range ids {
+		task, err := s.get(id)
+		if err != nil {
+			continue // Skip invalid JSON
+		}
+		if filter.matches(task, cursor) {
+			tasks = append(tasks, task)
+		}
+	}
+
+	sortTasks(tasks)
+	if filter.Limit > 0 && len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks, nil
+}
+
+func (s *MemoryTaskStore) GetMostRecentTaskExecutions(ctx context.Context, limit int) ([]*TaskExecution, error) {
+	return s.ListTaskExecutions(ctx, TaskFilter{
+		Limit: limit,
+	})
+}
+
+func (s *MemoryTaskStore) CleanupOldTaskExecutions(ctx context.Context, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan).Unix()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for id := range s.tasks {
+		task, err := s.get(id)
+		if err != nil || task.CreatedAt.Unix() > cutoff {
+			continue
+		}
+		s.remove(task)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of every stored execution, newest first. Modifying the
+// returned executions does not affect the store.
+func (s *MemoryTaskStore) Snapshot() []*TaskExecution {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	tasks := make([]*TaskExecution, 0, len(s.tasks))
+	for id := range s.tasks {
+		if task, err := s.get(id); err == nil {
+			tasks = append(tasks, task)
+		}
+	}
+	sortTasks(tasks)
+	return tasks
+}
+
+// Counts returns the number of stored executions per status.
+func (s *MemoryTaskStore) Counts() map[TaskStatus]int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	counts := make(map[TaskStatus]int)
+	for status, ids := range s.statuses {
+		if len(ids) > 0 {
+			counts[status] = len(ids)
+		}
+	}
+	return counts
+}
+
+// Len returns the number of stored executions.
+func (s *MemoryTaskStore) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.tasks)
+}
+
+// Reset removes every stored execution and clears the statistics.
+func (s *MemoryTaskStore) Reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.tasks = make(map[string][]byte)
+	s.statuses = make(map[TaskStatus]map[string]struct{})
+	s.totals = make(map[string]int64)
+	s.activity = make(map[int64]map[string]int64)
+}
+
+// Stats aggregates the counters kept in memory, over at most the last 7 days.
+func (s *MemoryTaskStore) Stats(ctx context.Context, query StatsQuery) (*TaskStats, error) {
+	query, err := query.normalize(defaultStatsRetention)
+	if err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return buildStats(query, s.totals, s.activity), nil
+}
+
+func (s *MemoryTaskStore) Watch(ctx context.Context, filter TaskFilter) <-chan TaskChange {
+	changes := make(chan TaskChange, watchBuffer)
+	s.mux.Lock()
+	s.watchers[changes] = filter
+	s.mux.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		delete(s.watchers, changes)
+		close(changes)
+	}()
+	return changes
+}
+
+// CheckHealth always succeeds, as the store lives in memory.
+func (s *MemoryTaskStore) CheckHealth(ctx context.Context) error {
+	return nil
+}
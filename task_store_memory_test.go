@@ -0,0 +1,126 @@
+package uptask
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTaskStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("tracks executions of a service", func(t *testing.T) {
+		store := NewMemoryTaskStore()
+		transport := &captureTransport{}
+		tsvc := NewTaskService(transport, WithStore(store))
+		AddTaskHandler(tsvc, &DummyTaskProcessor{})
+
+		id, err := tsvc.StartTask(ctx, DummyTask{Name: "ok"}, nil)
+		require.NoError(t, err)
+		_, err = tsvc.StartTask(ctx, DummyTask{Name: "flaky", FailFirst: true}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[TaskStatus]int{TaskStatusPending: 2}, store.Counts())
+
+		for _, sent := range transport.take() {
+			events.SetMaxRetries(&sent.ce, sent.opts.MaxRetries)
+			_ = tsvc.HandleEvent(ctx, received(sent.ce))
+		}
+		assert.Equal(t, map[TaskStatus]int{TaskStatusSuccess: 1, TaskStatusPending: 1}, store.Counts())
+
+		task, err := store.GetTaskExecution(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Name": "ok", "Snooze": false, "FailFirst": false}, task.Args)
+	})
+
+	t.Run("carries tags to the execution", func(t *testing.T) {
+		store := NewMemoryTaskStore()
+		transport := &captureTransport{}
+		tsvc := NewTaskService(transport, WithStore(store))
+		AddTaskHandler(tsvc, &DummyTaskProcessor{})
+
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "ok"}, &InsertOpts{Tags: []string{"billing", "eu"}})
+		require.NoError(t, err)
+		sent := transport.take()
+		require.Len(t, sent, 1)
+
+		// A service without the execution, as for scheduled tasks, restores the tags
+		// from the event
+		other := NewMemoryTaskStore()
+		osvc := NewTaskService(&captureTransport{}, WithStore(other))
+		AddTaskHandler(osvc, &DummyTaskProcessor{})
+		scheduled := received(sent[0].ce)
+		events.SetScheduled(&scheduled, true)
+		require.NoError(t, osvc.HandleEvent(ctx, scheduled))
+
+		for _, s := range []*MemoryTaskStore{store, other} {
+			tasks, err := s.ListTaskExecutions(ctx, TaskFilter{Tags: []string{"eu"}})
+			require.NoError(t, err)
+			require.Len(t, tasks, 1)
+			assert.Equal(t, []string{"billing", "eu"}, tasks[0].Tags)
+		}
+	})
+
+	t.Run("snapshot is a copy", func(t *testing.T) {
+		store := NewMemoryTaskStore()
+		require.NoError(t, store.CreateTaskExecution(ctx, createTestTask("task-1")))
+
+		snapshot := store.Snapshot()
+		require.Len(t, snapshot, 1)
+		snapshot[0].Status = TaskStatusFailed
+
+		task, err := store.GetTaskExecution(ctx, "task-1")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusPending, task.Status)
+
+		store.Reset()
+		assert.Zero(t, store.Len())
+	})
+
+	t.Run("lists newest first", func(t *testing.T) {
+		store := NewMemoryTaskStore()
+		now := time.Now()
+		for i, id := range []string{"a", "b", "c"} {
+			task := createTestTask(id)
+			task.CreatedAt = now.Add(-time.Duration(i) * time.Minute)
+			require.NoError(t, store.CreateTaskExecution(ctx, task))
+		}
+		require.NoError(t, store.UpdateTaskStatus(ctx, "b", TaskStatusRunning))
+
+		tasks, err := store.GetMostRecentTaskExecutions(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "a", tasks[0].ID)
+		assert.Equal(t, "b", tasks[1].ID)
+
+		pending := TaskStatusPending
+		tasks, err = store.ListTaskExecutions(ctx, TaskFilter{Status: &pending})
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "a", tasks[0].ID)
+		assert.Equal(t, "c", tasks[1].ID)
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		store := NewMemoryTaskStore()
+		require.NoError(t, store.CreateTaskExecution(ctx, createTestTask("task-1")))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, store.AddTaskError(ctx, "task-1", TaskError{Message: "boom"}))
+			}()
+		}
+		wg.Wait()
+
+		task, err := store.GetTaskExecution(ctx, "task-1")
+		require.NoError(t, err)
+		assert.Len(t, task.Errors, 50)
+	})
+}
@@ -2,9 +2,14 @@ package uptask
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,10 +18,21 @@ const (
 	taskPrefix   = "task:"          // Hash sets storing task details
 	timelineKey  = "tasks:timeline" // Sorted set for time-based queries
 	statusPrefix = "tasks:status:"  // Sorted sets for status-based queries
+	kindPrefix   = "tasks:kind:"    // Sorted sets for kind-based queries
+	queuePrefix  = "tasks:queue:"   // Sorted sets for queue-based queries
+	tagPrefix    = "tasks:tag:"     // Sorted sets for tag-based queries
+	statsKey     = "tasks:stats"    // Hash of counters of the stored tasks, and prefix of the per minute activity hashes
+	changesKey   = "tasks:changes"  // Pub/sub channel of task changes
+
+	subscriptionsKey = "tasks:subscriptions" // Hash of event subscriptions across services
 )
 
 type RedisTaskStore struct {
-	client *redis.Client
+	client         redis.UniversalClient
+	namespace      string
+	hashTag        string
+	prefix         string // Prepended to every key, built from the hash tag and namespace
+	statsRetention time.Duration
 }
 
 // RedisConfig holds configuration for Redis-based task store
@@ -26,9 +42,47 @@ type RedisConfig struct {
 	Password string
 	DB       int
 	Secure   bool
+	// StatsRetention is how long per minute activity counters are kept for Stats.
+	// Defaults to 7 days.
+	StatsRetention time.Duration
+	// Namespace isolates the keys of the store from those of other stores sharing the
+	// Redis instance.
+	Namespace string
 	// Add any other Redis-specific config you need
 }
 
+// RedisStoreOption configures a RedisTaskStore.
+type RedisStoreOption func(*RedisTaskStore)
+
+// WithRedisStatsRetention sets how long per minute activity counters are kept for
+// Stats. Defaults to 7 days.
+func WithRedisStatsRetention(d time.Duration) RedisStoreOption {
+	return func(s *RedisTaskStore) {
+		if d > 0 {
+			s.statsRetention = d
+		}
+	}
+}
+
+// WithRedisHashTag wraps the keys of the store in the hash tag {tag}, so that they all
+// map to the same Redis Cluster slot and can be updated together. Stores created from
+// a cluster client use their namespace as tag, or "uptask" without one, unless set
+// otherwise.
+func WithRedisHashTag(tag string) RedisStoreOption {
+	return func(s *RedisTaskStore) {
+		s.hashTag = tag
+	}
+}
+
+// WithRedisNamespace prefixes the keys of the store with namespace, so that apps or
+// environments sharing a Redis instance do not see each other's tasks. Use
+// MigrateToNamespace to move the keys of a store created without a namespace.
+func WithRedisNamespace(namespace string) RedisStoreOption {
+	return func(s *RedisTaskStore) {
+		s.namespace = namespace
+	}
+}
+
 func NewRedisTaskStore(cfg RedisConfig) (*RedisTaskStore, error) {
 
 	protocol := "redis"
@@ -42,16 +96,138 @@ func NewRedisTaskStore(cfg RedisConfig) (*RedisTaskStore, error) {
 	}
 
 	client := redis.NewClient(opts)
+	if err := pingRedis(client); err != nil {
+		return nil, err
+	}
+	return NewRedisTaskStoreFromClient(client,
+		WithRedisStatsRetention(cfg.StatsRetention),
+		WithRedisNamespace(cfg.Namespace),
+	), nil
+}
+
+// NewRedisTaskStoreFromClient creates a store using client, which may be a single node,
+// Sentinel failover or Cluster client, configured with any TLS settings. The client is
+// used as is; its connection is not checked.
+func NewRedisTaskStoreFromClient(client redis.UniversalClient, opts ...RedisStoreOption) *RedisTaskStore {
+	s := &RedisTaskStore{
+		client:         client,
+		statsRetention: defaultStatsRetention,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if _, ok := client.(*redis.ClusterClient); ok && s.hashTag == "" {
+		s.hashTag = "uptask"
+		if s.namespace != "" {
+			s.hashTag = s.namespace
+		}
+	}
+
+	// A namespace used as hash tag is not repeated
+	if s.hashTag != "" {
+		s.prefix = "{" + s.hashTag + "}:"
+	}
+	if s.namespace != "" && s.namespace != s.hashTag {
+		s.prefix += s.namespace + ":"
+	}
+	return s
+}
+
+// NewRedisTaskStoreFromURL connects to the Redis deployment described by rawURL and
+// creates a store using it. The scheme selects the kind of deployment:
+//
+//	redis://[user:password@]host:port[/db]                              single node
+//	redis+cluster://[user:password@]host:port?addr=host:port            Cluster
+//	redis+sentinel://[user:password@]host:port[,host:port]/master[/db]  Sentinel
+//
+// Each scheme has a rediss variant, such as rediss+cluster, that connects over TLS.
+func NewRedisTaskStoreFromURL(rawURL string, opts ...RedisStoreOption) (*RedisTaskStore, error) {
+	client, err := newRedisClientFromURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := pingRedis(client); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return NewRedisTaskStoreFromClient(client, opts...), nil
+}
+
+func newRedisClientFromURL(rawURL string) (redis.UniversalClient, error) {
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	base, deployment, _ := strings.Cut(scheme, "+")
+	if base != "redis" && base != "rediss" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme: %s", scheme)
+	}
+	plainURL := base + strings.TrimPrefix(rawURL, scheme)
+
+	switch deployment {
+	case "":
+		opts, err := redis.ParseURL(plainURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		return redis.NewClient(opts), nil
+	case "cluster":
+		opts, err := redis.ParseClusterURL(plainURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		return redis.NewClusterClient(opts), nil
+	case "sentinel":
+		opts, err := parseSentinelURL(plainURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		return redis.NewFailoverClient(opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported Redis URL scheme: %s", scheme)
+	}
+}
 
+// parseSentinelURL parses redis://[user:password@]host:port[,host:port]/master[/db],
+// where the hosts are the sentinels and the credentials are those of the master.
+func parseSentinelURL(rawURL string) (*redis.FailoverOptions, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if path[0] == "" || len(path) > 2 {
+		return nil, fmt.Errorf("expected the master name and an optional database in the path: %s", u.Path)
+	}
+
+	opts := &redis.FailoverOptions{
+		MasterName:    path[0],
+		SentinelAddrs: strings.Split(u.Host, ","),
+		Username:      u.User.Username(),
+	}
+	opts.Password, _ = u.User.Password()
+	if len(path) == 2 {
+		if opts.DB, err = strconv.Atoi(path[1]); err != nil {
+			return nil, fmt.Errorf("invalid database: %s", path[1])
+		}
+	}
+	if u.Scheme == "rediss" {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return opts, nil
+}
+
+func pingRedis(client redis.UniversalClient) error {
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("redis connection failed: %w", err)
+		return fmt.Errorf("redis connection failed: %w", err)
 	}
+	return nil
+}
 
-	return &RedisTaskStore{client: client}, nil
+// key returns the key of the store built from parts.
+func (s *RedisTaskStore) key(parts ...string) string {
+	return s.prefix + strings.Join(parts, "")
 }
 
 func (s *RedisTaskStore) CreateTaskExecution(ctx context.Context, task *TaskExecution) error {
@@ -66,30 +242,32 @@ func (s *RedisTaskStore) CreateTaskExecution(ctx context.Context, task *TaskExec
 		return fmt.Errorf("failed to marshal task: %w", err)
 	}
 
+	// Creating an existing task replaces it, so drop it from its previous indexes
+	old, err := s.GetTaskExecution(ctx, task.ID)
+	if err != nil {
+		old = nil
+	}
+
 	// Create pipeline for atomic operations
 	pipe := s.client.Pipeline()
 
+	if old != nil {
+		s.removeFromIndexes(ctx, pipe, old)
+	}
+
 	// Store task details in hash
-	taskKey := taskPrefix + task.ID
+	taskKey := s.key(taskPrefix, task.ID)
 	pipe.HSet(ctx, taskKey, map[string]interface{}{
 		"data":    string(taskJSON),
 		"status":  string(task.Status),
+		"kind":    task.TaskKind,
 		"queue":   task.Queue,
 		"created": task.CreatedAt.Unix(),
 	})
 
-	// Add to timeline sorted set
-	pipe.ZAdd(ctx, timelineKey, redis.Z{
-		Score:  float64(task.CreatedAt.Unix()),
-		Member: task.ID,
-	})
-
-	// Add to status sorted set
-	statusKey := statusPrefix + string(task.Status)
-	pipe.ZAdd(ctx, statusKey, redis.Z{
-		Score:  float64(task.CreatedAt.Unix()),
-		Member: task.ID,
-	})
+	s.addToIndexes(ctx, pipe, task)
+	s.recordStats(ctx, pipe, old, task)
+	s.publishChange(ctx, pipe, old, task)
 
 	// Execute pipeline
 	_, err = pipe.Exec(ctx)
@@ -100,8 +278,63 @@ func (s *RedisTaskStore) CreateTaskExecution(ctx context.Context, task *TaskExec
 	return nil
 }
 
+// addToIndexes adds task to the timeline and to the sorted sets of its status, kind,
+// queue and tags, all scored by creation time.
+func (s *RedisTaskStore) addToIndexes(ctx context.Context, pipe redis.Pipeliner, task *TaskExecution) {
+	z := redis.Z{
+		Score:  float64(task.CreatedAt.Unix()),
+		Member: task.ID,
+	}
+	pipe.ZAdd(ctx, s.key(timelineKey), z)
+	pipe.ZAdd(ctx, s.key(statusPrefix, string(task.Status)), z)
+	pipe.ZAdd(ctx, s.key(kindPrefix, task.TaskKind), z)
+	pipe.ZAdd(ctx, s.key(queuePrefix, task.Queue), z)
+	for _, tag := range task.Tags {
+		pipe.ZAdd(ctx, s.key(tagPrefix, tag), z)
+	}
+}
+
+// recordStats increments the counters read by Stats for replacing old with task,
+// either of which is nil when the task is created or deleted.
+func (s *RedisTaskStore) recordStats(ctx context.Context, pipe redis.Pipeliner, old, task *TaskExecution) {
+	for _, change := range statsChanges(old, task) {
+		if change.minute == 0 {
+			pipe.HIncrBy(ctx, s.key(statsKey), change.field, change.delta)
+			continue
+		}
+		key := s.statsActivityKey(change.minute)
+		pipe.HIncrBy(ctx, key, change.field, change.delta)
+		pipe.ExpireAt(ctx, key, time.Unix(change.minute*int64(statsResolution/time.Second), 0).Add(s.statsRetention))
+	}
+}
+
+// publishChange publishes the change of replacing old with task to watchers, either
+// of which is nil when the task is created or deleted.
+func (s *RedisTaskStore) publishChange(ctx context.Context, pipe redis.Pipeliner, old, task *TaskExecution) {
+	changeJSON, err := json.Marshal(newTaskChange(old, task))
+	if err != nil {
+		return
+	}
+	pipe.Publish(ctx, s.key(changesKey), changeJSON)
+}
+
+func (s *RedisTaskStore) statsActivityKey(minute int64) string {
+	return s.key(statsKey, ":", strconv.FormatInt(minute, 10))
+}
+
+// removeFromIndexes removes task from every sorted set it was added to.
+func (s *RedisTaskStore) removeFromIndexes(ctx context.Context, pipe redis.Pipeliner, task *TaskExecution) {
+	pipe.ZRem(ctx, s.key(timelineKey), task.ID)
+	pipe.ZRem(ctx, s.key(statusPrefix, string(task.Status)), task.ID)
+	pipe.ZRem(ctx, s.key(kindPrefix, task.TaskKind), task.ID)
+	pipe.ZRem(ctx, s.key(queuePrefix, task.Queue), task.ID)
+	for _, tag := range task.Tags {
+		pipe.ZRem(ctx, s.key(tagPrefix, tag), task.ID)
+	}
+}
+
 func (s *RedisTaskStore) GetTaskExecution(ctx context.Context, taskID string) (*TaskExecution, error) {
-	taskKey := taskPrefix + taskID
+	taskKey := s.key(taskPrefix, taskID)
 
 	// Get task JSON from hash
 	taskJSON, err := s.client.HGet(ctx, taskKey, "data").Result()
@@ -121,7 +354,7 @@ func (s *RedisTaskStore) GetTaskExecution(ctx context.Context, taskID string) (*
 }
 
 func (s *RedisTaskStore) TaskExists(ctx context.Context, taskID string) (bool, error) {
-	taskKey := taskPrefix + taskID
+	taskKey := s.key(taskPrefix, taskID)
 	keys, err := s.client.Exists(ctx, taskKey).Result()
 	if err != nil {
 		return false, err
@@ -129,110 +362,99 @@ func (s *RedisTaskStore) TaskExists(ctx context.Context, taskID string) (bool, e
 	return keys == 1, nil
 }
 
-func (s *RedisTaskStore) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus) error {
-	task, err := s.GetTaskExecution(ctx, taskID)
-	if err != nil {
-		return err
-	}
+// maxUpdateAttempts bounds the retries of an update that lost an optimistic lock.
+const maxUpdateAttempts = 100
 
-	// Update task status and timing
-	oldStatus := task.Status
-	task.Status = status
-	if status == TaskStatusRunning {
-		task.AttemptedAt = time.Now()
-		task.ScheduledAt = time.Time{}
-	}
+// updateTask applies update to the task stored under taskID. The task key is watched,
+// so concurrent updates of the same task are retried instead of overwriting each
+// other.
+func (s *RedisTaskStore) updateTask(ctx context.Context, taskID string, update func(task *TaskExecution)) error {
+	taskKey := s.key(taskPrefix, taskID)
+	txf := func(tx *redis.Tx) error {
+		taskJSON, err := tx.HGet(ctx, taskKey, "data").Result()
+		if err != nil {
+			if err == redis.Nil {
+				return fmt.Errorf("task not found: %s", taskID)
+			}
+			return fmt.Errorf("failed to get task: %w", err)
+		}
+		var task TaskExecution
+		if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
+			return fmt.Errorf("failed to unmarshal task: %w", err)
+		}
 
-	if status == TaskStatusSuccess || status == TaskStatusFailed {
-		task.FinalizedAt = time.Now()
-		task.ScheduledAt = time.Time{}
-	}
+		old := task
+		update(&task)
 
-	if status == TaskStatusFailed {
-	}
+		// Marshal updated task
+		updatedJSON, err := json.Marshal(task)
+		if err != nil {
+			return fmt.Errorf("failed to marshal task: %w", err)
+		}
 
-	if status == TaskStatusPending {
-		task.Retried++
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// Update task hash
+			pipe.HSet(ctx, taskKey, map[string]interface{}{
+				"data":   string(updatedJSON),
+				"status": string(task.Status),
+			})
+
+			// Remove from old status set and add to new status set
+			if old.Status != task.Status {
+				pipe.ZRem(ctx, s.key(statusPrefix, string(old.Status)), taskID)
+				pipe.ZAdd(ctx, s.key(statusPrefix, string(task.Status)), redis.Z{
+					Score:  float64(task.CreatedAt.Unix()),
+					Member: taskID,
+				})
+			}
+			s.recordStats(ctx, pipe, &old, &task)
+			s.publishChange(ctx, pipe, &old, &task)
+			return nil
+		})
+		return err
 	}
 
-	// Marshal updated task
-	taskJSON, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to marshal task: %w", err)
+	for i := 0; i < maxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txf, taskKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
 	}
+	return fmt.Errorf("failed to update task %s: too many concurrent updates", taskID)
+}
 
-	pipe := s.client.Pipeline()
+func (s *RedisTaskStore) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus) error {
+	return s.updateTask(ctx, taskID, func(task *TaskExecution) {
+		// Update task status and timing
+		task.Status = status
+		if status == TaskStatusRunning {
+			task.AttemptedAt = time.Now()
+			task.ScheduledAt = time.Time{}
+		}
 
-	// Update task hash
-	taskKey := taskPrefix + taskID
-	pipe.HSet(ctx, taskKey, map[string]interface{}{
-		"data":   string(taskJSON),
-		"status": string(status),
-	})
+		if status == TaskStatusSuccess || status == TaskStatusFailed || status == TaskStatusCancelled {
+			task.FinalizedAt = time.Now()
+			task.ScheduledAt = time.Time{}
+		}
 
-	// Remove from old status set and add to new status set
-	oldStatusKey := statusPrefix + string(oldStatus)
-	newStatusKey := statusPrefix + string(status)
-	pipe.ZRem(ctx, oldStatusKey, taskID)
-	pipe.ZAdd(ctx, newStatusKey, redis.Z{
-		Score:  float64(task.CreatedAt.Unix()),
-		Member: taskID,
+		if status == TaskStatusPending {
+			task.Retried++
+		}
 	})
-
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to update task status: %w", err)
-	}
-
-	return nil
 }
 
 func (s *RedisTaskStore) UpdateTaskSnoozedTask(ctx context.Context, taskID string, scheduledAt time.Time) error {
-	task, err := s.GetTaskExecution(ctx, taskID)
-	if err != nil {
-		return err
-	}
-	oldStatus := task.Status
-	task.Status = TaskStatusPending
-	task.ScheduledAt = scheduledAt
-	task.Retried++
-	task.MaxRetries++
-	// Marshal updated task
-	taskJSON, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to marshal task: %w", err)
-	}
-
-	// Update task hash
-	pipe := s.client.Pipeline()
-
-	// Update task hash
-	taskKey := taskPrefix + taskID
-	pipe.HSet(ctx, taskKey, map[string]interface{}{
-		"data":   string(taskJSON),
-		"status": string(task.Status),
-	})
-
-	// Remove from old status set and add to new status set
-	oldStatusKey := statusPrefix + string(oldStatus)
-	newStatusKey := statusPrefix + string(task.Status)
-	pipe.ZRem(ctx, oldStatusKey, taskID)
-	pipe.ZAdd(ctx, newStatusKey, redis.Z{
-		Score:  float64(task.CreatedAt.Unix()),
-		Member: taskID,
+	return s.updateTask(ctx, taskID, func(task *TaskExecution) {
+		task.Status = TaskStatusPending
+		task.ScheduledAt = scheduledAt
+		task.Retried++
+		task.MaxRetries++
 	})
-
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to update task status: %w", err)
-	}
-
-	return nil
 }
 
 func (s *RedisTaskStore) DeleteTaskExecution(ctx context.Context, taskID string) error {
 	// Get the task first to check existence and get status
-	taskKey := taskPrefix + taskID
+	taskKey := s.key(taskPrefix, taskID)
 	task, err := s.GetTaskExecution(ctx, taskID)
 	if err != nil {
 		return fmt.Errorf("failed to get task for deletion: %w", err)
@@ -241,12 +463,10 @@ func (s *RedisTaskStore) DeleteTaskExecution(ctx context.Context, taskID string)
 	// Create pipeline for atomic operations
 	pipe := s.client.Pipeline()
 
-	// Remove from timeline sorted set
-	pipe.ZRem(ctx, timelineKey, taskID)
-
-	// Remove from status sorted set
-	statusKey := statusPrefix + string(task.Status)
-	pipe.ZRem(ctx, statusKey, taskID)
+	// Remove from all sorted sets
+	s.removeFromIndexes(ctx, pipe, task)
+	s.recordStats(ctx, pipe, task, nil)
+	s.publishChange(ctx, pipe, task, nil)
 
 	// Delete the hash
 	pipe.Del(ctx, taskKey)
@@ -261,65 +481,97 @@ func (s *RedisTaskStore) DeleteTaskExecution(ctx context.Context, taskID string)
 }
 
 func (s *RedisTaskStore) AddTaskError(ctx context.Context, taskID string, taskError TaskError) error {
-	task, err := s.GetTaskExecution(ctx, taskID)
-	if err != nil {
-		return err
-	}
-
 	// Set error timestamp if not set
 	if taskError.Timestamp.IsZero() {
 		taskError.Timestamp = time.Now()
 	}
 
-	// Append error to task
-	task.Errors = append(task.Errors, taskError)
-
-	// Marshal updated task
-	taskJSON, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to marshal task: %w", err)
-	}
-
-	// Update task hash
-	taskKey := taskPrefix + taskID
-	err = s.client.HSet(ctx, taskKey, "data", string(taskJSON)).Err()
-	if err != nil {
-		return fmt.Errorf("failed to set HSet error: %w", err)
-	}
-
-	return nil
+	return s.updateTask(ctx, taskID, func(task *TaskExecution) {
+		task.Errors = append(task.Errors, taskError)
+	})
 }
 
+// listBatchSize is the number of IDs read from an index at once when tasks have to be
+// filtered after being fetched.
+const listBatchSize = 100
+
+// ListTaskExecutions reads the most selective index among status, kind, tag and queue,
+// and filters the tasks read by the remaining fields. Filters on several kinds read
+// the next index, as the kind indexes cannot be merged in order.
 func (s *RedisTaskStore) ListTaskExecutions(ctx context.Context, filter TaskFilter) ([]*TaskExecution, error) {
-	var taskIDs []string
-	var err error
+	cursor, err := decodeTaskCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// All indexes are scored by creation time
+	indexKey := s.key(timelineKey)
+	switch {
+	case filter.Status != nil:
+		indexKey = s.key(statusPrefix, string(*filter.Status))
+	case filter.Kind != "":
+		indexKey = s.key(kindPrefix, filter.Kind)
+	case len(filter.Kinds) == 1:
+		indexKey = s.key(kindPrefix, filter.Kinds[0])
+	case len(filter.Tags) > 0:
+		indexKey = s.key(tagPrefix, filter.Tags[0])
+	case filter.Queue != "":
+		indexKey = s.key(queuePrefix, filter.Queue)
+	}
+	minScore, maxScore := "-inf", "+inf"
+	if !filter.FromDate.IsZero() {
+		minScore = fmt.Sprint(filter.FromDate.Unix())
+	}
+	if !filter.ToDate.IsZero() {
+		maxScore = fmt.Sprint(filter.ToDate.Unix())
+	}
+	if cursor != nil && (filter.ToDate.IsZero() || cursor.Created < filter.ToDate.Unix()) {
+		maxScore = fmt.Sprint(cursor.Created)
+	}
+
+	// Without a limit the whole range is read at once
+	count := int64(0)
+	if filter.Limit > 0 {
+		count = int64(max(filter.Limit, listBatchSize))
+	}
+
+	tasks := make([]*TaskExecution, 0)
+	for offset := int64(0); ; offset += count {
+		taskIDs, err := s.client.ZRevRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+			Min:    minScore,
+			Max:    maxScore,
+			Offset: offset,
+			Count:  count,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks: %w", err)
+		}
 
-	if filter.Status != nil {
-		// If status is specified, get from status set
-		statusKey := statusPrefix + string(*filter.Status)
-		opt := &redis.ZRangeBy{
-			Min:    "-inf",
-			Max:    "+inf",
-			Offset: 0,
-			Count:  int64(filter.Limit),
+		batch, err := s.getTasks(ctx, taskIDs)
+		if err != nil {
+			return nil, err
 		}
-		taskIDs, err = s.client.ZRevRangeByScore(ctx, statusKey, opt).Result()
-	} else {
-		if filter.ToDate.IsZero() {
-			filter.ToDate = time.Now()
+		for _, task := range batch {
+			if !filter.matches(task, cursor) {
+				continue
+			}
+			tasks = append(tasks, task)
+			if filter.Limit > 0 && len(tasks) == filter.Limit {
+				return tasks, nil
+			}
 		}
-		// Otherwise, get from timeline
-		opt := &redis.ZRangeBy{
-			Min:    fmt.Sprint(filter.FromDate.Unix()),
-			Max:    fmt.Sprint(filter.ToDate.Unix()),
-			Offset: 0,
-			Count:  int64(filter.Limit),
+
+		if count == 0 || int64(len(taskIDs)) < count {
+			return tasks, nil
 		}
-		taskIDs, err = s.client.ZRevRangeByScore(ctx, timelineKey, opt).Result()
 	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to list tasks: %w", err)
+// getTasks fetches the tasks with the given IDs in one round trip, skipping tasks that
+// no longer exist.
+func (s *RedisTaskStore) getTasks(ctx context.Context, taskIDs []string) ([]*TaskExecution, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
 	}
 
 	// Fetch tasks in parallel using pipelining
@@ -327,12 +579,12 @@ func (s *RedisTaskStore) ListTaskExecutions(ctx context.Context, filter TaskFilt
 	cmds := make(map[string]*redis.StringCmd)
 
 	for _, taskID := range taskIDs {
-		taskKey := taskPrefix + taskID
+		taskKey := s.key(taskPrefix, taskID)
 		cmds[taskID] = pipe.HGet(ctx, taskKey, "data")
 	}
 
-	_, err = pipe.Exec(ctx)
-	if err != nil {
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
 		return nil, fmt.Errorf("failed to fetch tasks: %w", err)
 	}
 
@@ -355,53 +607,349 @@ func (s *RedisTaskStore) ListTaskExecutions(ctx context.Context, filter TaskFilt
 	return tasks, nil
 }
 
+// cleanupBatchSize is the number of tasks removed at once by CleanupOldTaskExecutions.
+const cleanupBatchSize = 1000
+
 func (s *RedisTaskStore) GetMostRecentTaskExecutions(ctx context.Context, limit int) ([]*TaskExecution, error) {
 	return s.ListTaskExecutions(ctx, TaskFilter{
-		FromDate: time.Unix(0, 0),
-		ToDate:   time.Now(),
-		Limit:    limit,
+		Limit: limit,
 	})
 }
 
 func (s *RedisTaskStore) CleanupOldTaskExecutions(ctx context.Context, olderThan time.Duration) error {
 	cutoff := time.Now().Add(-olderThan).Unix()
 
-	// Get old task IDs from timeline
-	oldTaskIDs, err := s.client.ZRangeByScore(ctx, timelineKey, &redis.ZRangeBy{
-		Min:   "-inf",
-		Max:   fmt.Sprint(cutoff),
-		Count: 1000, // Process in batches
-	}).Result()
-	if err != nil {
-		return fmt.Errorf("failed to get old tasks: %w", err)
+	// Removed tasks leave the timeline, so every batch is read from its start
+	for {
+		oldTaskIDs, err := s.client.ZRangeByScore(ctx, s.key(timelineKey), &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   fmt.Sprint(cutoff),
+			Count: cleanupBatchSize,
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get old tasks: %w", err)
+		}
+
+		if len(oldTaskIDs) == 0 {
+			return nil
+		}
+
+		oldTasks, err := s.getTasks(ctx, oldTaskIDs)
+		if err != nil {
+			return err
+		}
+
+		pipe := s.client.Pipeline()
+
+		// Remove tasks from all relevant keys
+		for _, task := range oldTasks {
+			s.removeFromIndexes(ctx, pipe, task)
+			s.recordStats(ctx, pipe, task, nil)
+			s.publishChange(ctx, pipe, task, nil)
+		}
+		for _, taskID := range oldTaskIDs {
+			pipe.Del(ctx, s.key(taskPrefix, taskID))
+			pipe.ZRem(ctx, s.key(timelineKey), taskID)
+		}
+
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to cleanup old tasks: %w", err)
+		}
+
+		if len(oldTaskIDs) < cleanupBatchSize {
+			return nil
+		}
 	}
+}
+
+// RebuildIndexes adds every stored task to the sorted sets used by
+// ListTaskExecutions and recounts the stored tasks reported by Stats. Run it once
+// after upgrading from a version that did not maintain some of the indexes, while no
+// tasks are being processed.
+func (s *RedisTaskStore) RebuildIndexes(ctx context.Context) error {
+	if err := s.client.Del(ctx, s.key(statsKey)).Err(); err != nil {
+		return fmt.Errorf("failed to reset stats: %w", err)
+	}
+	var mux sync.Mutex
+	return s.scan(ctx, s.key(taskPrefix)+"*", func(keys []string) error {
+		taskIDs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			taskIDs = append(taskIDs, strings.TrimPrefix(key, s.key(taskPrefix)))
+		}
+		tasks, err := s.getTasks(ctx, taskIDs)
+		if err != nil {
+			return err
+		}
+
+		// Nodes of a cluster are scanned concurrently
+		mux.Lock()
+		defer mux.Unlock()
+		pipe := s.client.Pipeline()
+		for _, task := range tasks {
+			s.addToIndexes(ctx, pipe, task)
+			for _, change := range statsChanges(nil, task) {
+				if change.minute == 0 {
+					pipe.HIncrBy(ctx, s.key(statsKey), change.field, change.delta)
+				}
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to rebuild indexes: %w", err)
+		}
+		return nil
+	})
+}
 
-	if len(oldTaskIDs) == 0 {
+// scan calls fn with batches of the keys matching match. The master nodes of a cluster
+// are scanned concurrently.
+func (s *RedisTaskStore) scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	scanNode := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, match, 1000).Iterator()
+		keys := make([]string, 0, listBatchSize)
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+			if len(keys) == listBatchSize {
+				if err := fn(keys); err != nil {
+					return err
+				}
+				keys = keys[:0]
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to scan keys: %w", err)
+		}
+		if len(keys) > 0 {
+			return fn(keys)
+		}
 		return nil
 	}
 
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node)
+		})
+	}
+	return scanNode(ctx, s.client)
+}
+
+// Stats reads the counters maintained on every change of a task. Activity older than
+// the configured StatsRetention has expired, so the range is clamped to it.
+func (s *RedisTaskStore) Stats(ctx context.Context, query StatsQuery) (*TaskStats, error) {
+	query, err := query.normalize(s.statsRetention)
+	if err != nil {
+		return nil, err
+	}
+	minutes := query.minutes()
+
 	pipe := s.client.Pipeline()
+	totalsCmd := pipe.HGetAll(ctx, s.key(statsKey))
+	activityCmds := make([]*redis.MapStringStringCmd, len(minutes))
+	for i, minute := range minutes {
+		activityCmds[i] = pipe.HGetAll(ctx, s.statsActivityKey(minute))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	totals := parseCounters(totalsCmd.Val())
+	activity := make(map[int64]map[string]int64, len(minutes))
+	for i, minute := range minutes {
+		if counters := activityCmds[i].Val(); len(counters) > 0 {
+			activity[minute] = parseCounters(counters)
+		}
+	}
+	return buildStats(query, totals, activity), nil
+}
+
+func parseCounters(fields map[string]string) map[string]int64 {
+	counters := make(map[string]int64, len(fields))
+	for field, value := range fields {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			counters[field] = n
+		}
+	}
+	return counters
+}
+
+// Watch subscribes to the changes published by every store sharing the Redis
+// instance and namespace. Changes published before the subscription is confirmed, or
+// while no watcher is connected, are lost. The channel is returned closed if the
+// subscription fails.
+func (s *RedisTaskStore) Watch(ctx context.Context, filter TaskFilter) <-chan TaskChange {
+	changes := make(chan TaskChange, watchBuffer)
+	sub := s.client.Subscribe(ctx, s.key(changesKey))
+	// Wait for the subscription, so changes made once Watch returns are received
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		close(changes)
+		return changes
+	}
+
+	go func() {
+		defer close(changes)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var change TaskChange
+				if err := json.Unmarshal([]byte(msg.Payload), &change); err != nil || !change.matches(filter) {
+					continue
+				}
+				select {
+				case changes <- change:
+				default: // Drop changes for consumers that fall behind
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// MigrateToNamespace moves the keys written by a store without namespace or hash tag
+// to the namespace of s, and returns the number of keys moved. Run it once while no
+// tasks are being processed, before the namespace is used: keys that already exist in
+// the namespace are not overwritten and fail the migration.
+func (s *RedisTaskStore) MigrateToNamespace(ctx context.Context) (int, error) {
+	if s.prefix == "" {
+		return 0, fmt.Errorf("store has no namespace to migrate to")
+	}
+	if strings.HasPrefix(s.prefix, "task:") || strings.HasPrefix(s.prefix, "tasks:") {
+		return 0, fmt.Errorf("namespace %q cannot be told apart from keys without namespace", s.namespace)
+	}
+
+	var mux sync.Mutex
+	moved := 0
+	for _, match := range []string{"task:*", "tasks:*"} {
+		err := s.scan(ctx, match, func(keys []string) error {
+			for _, key := range keys {
+				if err := s.moveKey(ctx, key, s.prefix+key); err != nil {
+					return err
+				}
+				mux.Lock()
+				moved++
+				mux.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, fmt.Errorf("failed to migrate keys to namespace: %w", err)
+		}
+	}
+	return moved, nil
+}
+
+// moveKey renames key to dst unless dst exists. Keys in different cluster slots
+// cannot be renamed, so they are copied and deleted instead.
+func (s *RedisTaskStore) moveKey(ctx context.Context, key, dst string) error {
+	if _, ok := s.client.(*redis.ClusterClient); !ok {
+		renamed, err := s.client.RenameNX(ctx, key, dst).Result()
+		if err != nil {
+			return fmt.Errorf("failed to move %s: %w", key, err)
+		}
+		if !renamed {
+			return fmt.Errorf("failed to move %s: %s already exists", key, dst)
+		}
+		return nil
+	}
+
+	exists, err := s.client.Exists(ctx, dst).Result()
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %w", key, err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("failed to move %s: %s already exists", key, dst)
+	}
+	value, err := s.client.Dump(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %w", key, err)
+	}
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to move %s: %w", key, err)
+	}
+	if ttl < 0 {
+		ttl = 0 // No expiry
+	}
+	if err := s.client.Restore(ctx, dst, ttl, value).Err(); err != nil {
+		return fmt.Errorf("failed to move %s: %w", key, err)
+	}
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to move %s: %w", key, err)
+	}
+	return nil
+}
 
-	// Remove tasks from all relevant keys
-	for _, taskID := range oldTaskIDs {
-		taskKey := taskPrefix + taskID
+func subscriptionField(sub Subscription) string {
+	return sub.TargetUrl + "|" + sub.TaskKind()
+}
+
+func (s *RedisTaskStore) RegisterSubscriptions(ctx context.Context, targetUrl string, subs []Subscription) error {
+	existing, err := s.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
 
-		// Get task status to remove from status set
-		status, err := s.client.HGet(ctx, taskKey, "status").Result()
-		if err == nil {
-			statusKey := statusPrefix + status
-			pipe.ZRem(ctx, statusKey, taskID)
+	fields := make(map[string]interface{}, len(subs))
+	for _, sub := range subs {
+		sub.TargetUrl = targetUrl
+		subJSON, err := json.Marshal(sub)
+		if err != nil {
+			return fmt.Errorf("failed to marshal subscription: %w", err)
 		}
+		fields[subscriptionField(sub)] = string(subJSON)
+	}
+
+	pipe := s.client.TxPipeline()
 
-		// Remove task hash and timeline entry
-		pipe.Del(ctx, taskKey)
-		pipe.ZRem(ctx, timelineKey, taskID)
+	// Remove subscriptions the service no longer registers
+	for _, sub := range existing {
+		field := subscriptionField(sub)
+		if _, ok := fields[field]; sub.TargetUrl == targetUrl && !ok {
+			pipe.HDel(ctx, s.key(subscriptionsKey), field)
+		}
+	}
+
+	if len(fields) > 0 {
+		pipe.HSet(ctx, s.key(subscriptionsKey), fields)
 	}
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to cleanup old tasks: %w", err)
+		return fmt.Errorf("failed to register subscriptions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisTaskStore) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	values, err := s.client.HGetAll(ctx, s.key(subscriptionsKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	subs := make([]Subscription, 0, len(values))
+	for _, value := range values {
+		var sub Subscription
+		if err := json.Unmarshal([]byte(value), &sub); err != nil {
+			continue // Skip invalid JSON
+		}
+		subs = append(subs, sub)
 	}
 
+	return subs, nil
+}
+
+// CheckHealth pings Redis.
+func (s *RedisTaskStore) CheckHealth(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping redis: %w", err)
+	}
 	return nil
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -361,11 +363,24 @@ func TestCleanupOldTaskExecutions(t *testing.T) {
 		assert.NotNil(t, task)
 
 		// Verify timeline and status sets updated
-		members, err := store.client.ZRange(ctx, timelineKey, 0, -1).Result()
+		members, err := store.client.ZRange(ctx, store.key(timelineKey), 0, -1).Result()
 		assert.NoError(t, err)
 		assert.NotContains(t, members, "old_task")
 		assert.Contains(t, members, "new_task")
 	})
+
+	t.Run("cleanup more than a batch", func(t *testing.T) {
+		for i := 0; i < cleanupBatchSize+10; i++ {
+			task := createTestTask(fmt.Sprintf("old_%d", i))
+			task.CreatedAt = time.Now().Add(-24 * time.Hour)
+			require.NoError(t, store.CreateTaskExecution(ctx, task))
+		}
+
+		require.NoError(t, store.CleanupOldTaskExecutions(ctx, 12*time.Hour))
+		count, err := store.client.ZCard(ctx, store.key(timelineKey)).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
 }
 
 func TestConcurrentOperations(t *testing.T) {
@@ -441,18 +456,18 @@ func TestDeleteTaskExecution(t *testing.T) {
 		assert.Error(t, err)
 
 		// Verify task removed from timeline
-		members, err := store.client.ZRange(ctx, timelineKey, 0, -1).Result()
+		members, err := store.client.ZRange(ctx, store.key(timelineKey), 0, -1).Result()
 		assert.NoError(t, err)
 		assert.NotContains(t, members, "task_to_delete")
 
 		// Verify task removed from status set
-		statusKey := statusPrefix + string(TaskStatusPending)
+		statusKey := store.key(statusPrefix, string(TaskStatusPending))
 		members, err = store.client.ZRange(ctx, statusKey, 0, -1).Result()
 		assert.NoError(t, err)
 		assert.NotContains(t, members, "task_to_delete")
 
 		// Verify hash is deleted
-		exists, err := store.client.Exists(ctx, taskPrefix+"task_to_delete").Result()
+		exists, err := store.client.Exists(ctx, store.key(taskPrefix, "task_to_delete")).Result()
 		assert.NoError(t, err)
 		assert.Equal(t, int64(0), exists)
 	})
@@ -487,7 +502,7 @@ func TestDeleteTaskExecution(t *testing.T) {
 			assert.Error(t, err)
 
 			// Verify removed from status set
-			statusKey := statusPrefix + string(status)
+			statusKey := store.key(statusPrefix, string(status))
 			members, err := store.client.ZRange(ctx, statusKey, 0, -1).Result()
 			assert.NoError(t, err)
 			assert.NotContains(t, members, taskID)
@@ -527,7 +542,7 @@ func TestDeleteTaskExecution(t *testing.T) {
 		}
 
 		// Verify timeline is empty
-		count, err := store.client.ZCard(ctx, timelineKey).Result()
+		count, err := store.client.ZCard(ctx, store.key(timelineKey)).Result()
 		assert.NoError(t, err)
 		assert.Equal(t, int64(0), count)
 	})
@@ -556,3 +571,151 @@ func TestDeleteTaskExecution(t *testing.T) {
 		assert.Equal(t, map[string]interface{}{"new": "value"}, retrieved.Args)
 	})
 }
+
+func TestRebuildIndexes(t *testing.T) {
+	store, mr := setupTestRedis(t)
+	defer mr.Close()
+
+	ctx := context.Background()
+
+	for _, id := range []string{"task1", "task2"} {
+		task := createTestTask(id)
+		task.TaskKind = "Kind"
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+	}
+
+	// Simulate tasks stored before the kind and queue indexes and the stats existed
+	require.NoError(t, store.client.Del(ctx, store.key(kindPrefix, "Kind"), store.key(queuePrefix, "default"), store.key(statsKey)).Err())
+	tasks, err := store.ListTaskExecutions(ctx, TaskFilter{Kind: "Kind"})
+	require.NoError(t, err)
+	assert.Empty(t, tasks)
+
+	require.NoError(t, store.RebuildIndexes(ctx))
+
+	tasks, err = store.ListTaskExecutions(ctx, TaskFilter{Kind: "Kind"})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	tasks, err = store.ListTaskExecutions(ctx, TaskFilter{Queue: "default"})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	stats, err := store.Stats(ctx, StatsQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"Kind": 2}, stats.ByKind)
+}
+
+func TestRedisTaskStoreFromURL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	t.Run("single node", func(t *testing.T) {
+		store, err := NewRedisTaskStoreFromURL("redis://" + mr.Addr() + "/0")
+		require.NoError(t, err)
+		require.NoError(t, store.CreateTaskExecution(ctx, createTestTask("task1")))
+		assert.True(t, mr.Exists("task:task1"), "single node keys are not hash tagged")
+	})
+
+	t.Run("cluster keys share a hash tag", func(t *testing.T) {
+		mr.FlushAll()
+		store, err := NewRedisTaskStoreFromURL("redis+cluster://" + mr.Addr())
+		require.NoError(t, err)
+		require.NoError(t, store.CreateTaskExecution(ctx, createTestTask("task1")))
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task1", TaskStatusRunning))
+		for _, key := range mr.Keys() {
+			assert.True(t, strings.HasPrefix(key, "{uptask}:"), key)
+		}
+		require.NoError(t, store.RebuildIndexes(ctx))
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		client, err := newRedisClientFromURL("rediss+sentinel://user:secret@s1:26379,s2:26379/mymaster/2")
+		require.NoError(t, err)
+		defer client.Close()
+		opts, err := parseSentinelURL("rediss://user:secret@s1:26379,s2:26379/mymaster/2")
+		require.NoError(t, err)
+		assert.Equal(t, "mymaster", opts.MasterName)
+		assert.Equal(t, []string{"s1:26379", "s2:26379"}, opts.SentinelAddrs)
+		assert.Equal(t, "secret", opts.Password)
+		assert.Equal(t, 2, opts.DB)
+		assert.NotNil(t, opts.TLSConfig)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := NewRedisTaskStoreFromURL("http://" + mr.Addr())
+		assert.Error(t, err)
+		_, err = NewRedisTaskStoreFromURL("redis+unknown://" + mr.Addr())
+		assert.Error(t, err)
+	})
+}
+
+func TestRedisNamespace(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	legacy := NewRedisTaskStoreFromClient(client)
+	require.NoError(t, legacy.CreateTaskExecution(ctx, createTestTask("task1")))
+	require.NoError(t, legacy.RegisterSubscriptions(ctx, "https://a.example.com", []Subscription{{Handler: "h", EventKind: "user.created", TargetUrl: "https://a.example.com"}}))
+
+	appA := NewRedisTaskStoreFromClient(client, WithRedisNamespace("app-a"))
+	appB := NewRedisTaskStoreFromClient(client, WithRedisNamespace("app-b"))
+
+	t.Run("namespaces are isolated", func(t *testing.T) {
+		require.NoError(t, appB.CreateTaskExecution(ctx, createTestTask("task2")))
+		assert.True(t, mr.Exists("app-b:task:task2"))
+
+		tasks, err := appA.GetMostRecentTaskExecutions(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, tasks)
+		require.NoError(t, appA.CleanupOldTaskExecutions(ctx, 0))
+		exists, err := appB.TaskExists(ctx, "task2")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("migrates keys without namespace", func(t *testing.T) {
+		moved, err := appA.MigrateToNamespace(ctx)
+		require.NoError(t, err)
+		assert.Positive(t, moved)
+
+		task, err := appA.GetTaskExecution(ctx, "task1")
+		require.NoError(t, err)
+		assert.Equal(t, "task1", task.ID)
+		tasks, err := appA.ListTaskExecutions(ctx, TaskFilter{Status: &task.Status})
+		require.NoError(t, err)
+		assert.Len(t, tasks, 1)
+		subs, err := appA.ListSubscriptions(ctx)
+		require.NoError(t, err)
+		assert.Len(t, subs, 1)
+
+		for _, key := range mr.Keys() {
+			assert.True(t, strings.HasPrefix(key, "app-a:") || strings.HasPrefix(key, "app-b:"), key)
+		}
+
+		// Migrating again finds nothing left to move
+		moved, err = appA.MigrateToNamespace(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, moved)
+	})
+
+	t.Run("does not overwrite", func(t *testing.T) {
+		require.NoError(t, legacy.CreateTaskExecution(ctx, createTestTask("task2")))
+		_, err := appB.MigrateToNamespace(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("requires a namespace", func(t *testing.T) {
+		_, err := legacy.MigrateToNamespace(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("cluster namespace is the hash tag", func(t *testing.T) {
+		cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+		defer cluster.Close()
+		store := NewRedisTaskStoreFromClient(cluster, WithRedisNamespace("app-c"))
+		assert.Equal(t, "{app-c}:task:x", store.key(taskPrefix, "x"))
+		store = NewRedisTaskStoreFromClient(client, WithRedisNamespace("app-c"), WithRedisHashTag("shared"))
+		assert.Equal(t, "{shared}:app-c:task:x", store.key(taskPrefix, "x"))
+	})
+}
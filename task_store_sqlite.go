@@ -0,0 +1,613 @@
+package uptask
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// SQLiteTaskStore is a TaskStore backed by a SQLite database. Executions, their
+// attempts, errors and tags are stored in separate tables with indexed columns, so
+// they can be queried with plain SQL.
+type SQLiteTaskStore struct {
+	db *sql.DB
+}
+
+// TaskAttempt is a single attempt of a task execution recorded by SQLiteTaskStore.
+type TaskAttempt struct {
+	Attempt    int        `json:"attempt"`
+	Status     TaskStatus `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at,omitempty"`
+}
+
+// NewSQLiteTaskStore opens the SQLite database at path, creating it if needed, and
+// applies pending schema migrations.
+func NewSQLiteTaskStore(path string) (*SQLiteTaskStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLiteTaskStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLiteTaskStoreFromDB applies pending schema migrations to db. Foreign keys must
+// be enabled on db for deletes to cascade to attempts, errors and tags.
+func NewSQLiteTaskStoreFromDB(db *sql.DB) (*SQLiteTaskStore, error) {
+	if err := migrateSQLite(context.Background(), db, sqliteMigrations, "migrations/sqlite"); err != nil {
+		return nil, err
+	}
+	return &SQLiteTaskStore{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLiteTaskStore) Close() error {
+	return s.db.Close()
+}
+
+// migrateSQLite applies the migrations in dir that are not recorded in the
+// schema_migrations table yet. Migration files are named <version>_<name>.sql and are
+// applied in order of version, each in its own transaction.
+func migrateSQLite(ctx context.Context, db *sql.DB, fsys fs.FS, dir string) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT    NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	type migration struct {
+		version int
+		name    string
+	}
+	var migrations []migration
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		migrations = append(migrations, migration{version, entry.Name()})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for _, m := range migrations {
+		var applied int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", m.name, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := fs.ReadFile(fsys, dir+"/"+m.name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", m.name, err)
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now().UnixNano())
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// sqliteTime converts t to unix nanoseconds, or NULL if t is zero.
+func sqliteTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func fromSQLiteTime(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, v.Int64)
+}
+
+func (s *SQLiteTaskStore) CreateTaskExecution(ctx context.Context, task *TaskExecution) error {
+	// Set created time if not set
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+
+	argsJSON, err := json.Marshal(task.Args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task args: %w", err)
+	}
+	var deadLetter sql.NullString
+	if task.DeadLetter != nil {
+		deadLetterJSON, err := json.Marshal(task.DeadLetter)
+		if err != nil {
+			return fmt.Errorf("failed to marshal dead letter: %w", err)
+		}
+		deadLetter = sql.NullString{String: string(deadLetterJSON), Valid: true}
+	}
+	var dispatches sql.NullString
+	if task.Dispatches != nil {
+		dispatchesJSON, err := json.Marshal(task.Dispatches)
+		if err != nil {
+			return fmt.Errorf("failed to marshal dispatches: %w", err)
+		}
+		dispatches = sql.NullString{String: string(dispatchesJSON), Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Creating an existing execution replaces it, as with the Redis store.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO task_executions (
+			id, task_kind, status, args, attempt_id, retried, max_retries, qstash_message_id,
+			schedule_id, queue, parent_id, created_at, attempted_at, scheduled_at, finalized_at, dead_letter,
+			dispatches
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			task_kind = excluded.task_kind, status = excluded.status, args = excluded.args,
+			attempt_id = excluded.attempt_id, retried = excluded.retried, max_retries = excluded.max_retries,
+			qstash_message_id = excluded.qstash_message_id, schedule_id = excluded.schedule_id,
+			queue = excluded.queue, parent_id = excluded.parent_id, created_at = excluded.created_at,
+			attempted_at = excluded.attempted_at, scheduled_at = excluded.scheduled_at,
+			finalized_at = excluded.finalized_at, dead_letter = excluded.dead_letter,
+			dispatches = excluded.dispatches`,
+		task.ID, task.TaskKind, string(task.Status), string(argsJSON), task.AttemptID, task.Retried,
+		task.MaxRetries, task.QstashMessageID, task.ScheduleID, task.Queue, task.ParentID,
+		task.CreatedAt.UnixNano(), sqliteTime(task.AttemptedAt), sqliteTime(task.ScheduledAt),
+		sqliteTime(task.FinalizedAt), deadLetter, dispatches,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM task_tags WHERE task_id = ?`, task.ID); err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+	for _, tag := range task.Tags {
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO task_tags (task_id, tag) VALUES (?, ?)`, task.ID, tag)
+		if err != nil {
+			return fmt.Errorf("failed to create task tags: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM task_errors WHERE task_id = ?`, task.ID); err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+	for _, taskErr := range task.Errors {
+		if err := insertSQLiteTaskError(ctx, tx, task.ID, taskErr); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+	return nil
+}
+
+func insertSQLiteTaskError(ctx context.Context, tx *sql.Tx, taskID string, taskErr TaskError) error {
+	var details sql.NullString
+	if taskErr.Details != nil {
+		detailsJSON, err := json.Marshal(taskErr.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal error details: %w", err)
+		}
+		details = sql.NullString{String: string(detailsJSON), Valid: true}
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO task_errors (task_id, message, details, timestamp) VALUES (?, ?, ?, ?)`,
+		taskID, taskErr.Message, details, taskErr.Timestamp.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to add task error: %w", err)
+	}
+	return nil
+}
+
+const sqliteExecutionColumns = `id, task_kind, status, args, attempt_id, retried, max_retries, qstash_message_id,
+	schedule_id, queue, parent_id, created_at, attempted_at, scheduled_at, finalized_at, dead_letter, dispatches`
+
+type sqliteScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteExecution(row sqliteScanner) (*TaskExecution, error) {
+	var (
+		task                                  TaskExecution
+		status                                string
+		args, deadLetter, dispatches          sql.NullString
+		createdAt                             int64
+		attemptedAt, scheduledAt, finalizedAt sql.NullInt64
+	)
+	err := row.Scan(&task.ID, &task.TaskKind, &status, &args, &task.AttemptID, &task.Retried, &task.MaxRetries,
+		&task.QstashMessageID, &task.ScheduleID, &task.Queue, &task.ParentID, &createdAt, &attemptedAt,
+		&scheduledAt, &finalizedAt, &deadLetter, &dispatches)
+	if err != nil {
+		return nil, err
+	}
+	task.Status = TaskStatus(status)
+	if args.Valid {
+		if err := json.Unmarshal([]byte(args.String), &task.Args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task args: %w", err)
+		}
+	}
+	if deadLetter.Valid {
+		if err := json.Unmarshal([]byte(deadLetter.String), &task.DeadLetter); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+		}
+	}
+	if dispatches.Valid {
+		if err := json.Unmarshal([]byte(dispatches.String), &task.Dispatches); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dispatches: %w", err)
+		}
+	}
+	task.CreatedAt = time.Unix(0, createdAt)
+	task.AttemptedAt = fromSQLiteTime(attemptedAt)
+	task.ScheduledAt = fromSQLiteTime(scheduledAt)
+	task.FinalizedAt = fromSQLiteTime(finalizedAt)
+	return &task, nil
+}
+
+// loadRelations fills in the errors and tags of tasks.
+func (s *SQLiteTaskStore) loadRelations(ctx context.Context, tasks []*TaskExecution) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	byID := make(map[string]*TaskExecution, len(tasks))
+	placeholders := make([]string, 0, len(tasks))
+	ids := make([]any, 0, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+		placeholders = append(placeholders, "?")
+		ids = append(ids, task.ID)
+	}
+	in := strings.Join(placeholders, ", ")
+
+	rows, err := s.db.QueryContext(ctx, `SELECT task_id, message, details, timestamp FROM task_errors WHERE task_id IN (`+in+`) ORDER BY id`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to get task errors: %w", err)
+	}
+	for rows.Next() {
+		var (
+			taskID    string
+			taskErr   TaskError
+			details   sql.NullString
+			timestamp int64
+		)
+		if err := rows.Scan(&taskID, &taskErr.Message, &details, &timestamp); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to get task errors: %w", err)
+		}
+		if details.Valid {
+			_ = json.Unmarshal([]byte(details.String), &taskErr.Details)
+		}
+		taskErr.Timestamp = time.Unix(0, timestamp)
+		byID[taskID].Errors = append(byID[taskID].Errors, taskErr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get task errors: %w", err)
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT task_id, tag FROM task_tags WHERE task_id IN (`+in+`) ORDER BY tag`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to get task tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID, tag string
+		if err := rows.Scan(&taskID, &tag); err != nil {
+			return fmt.Errorf("failed to get task tags: %w", err)
+		}
+		byID[taskID].Tags = append(byID[taskID].Tags, tag)
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteTaskStore) GetTaskExecution(ctx context.Context, taskID string) (*TaskExecution, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+sqliteExecutionColumns+` FROM task_executions WHERE id = ?`, taskID)
+	task, err := scanSQLiteExecution(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("task not found: %s", taskID)
+		}
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+	if err := s.loadRelations(ctx, []*TaskExecution{task}); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *SQLiteTaskStore) TaskExists(ctx context.Context, taskID string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM task_executions WHERE id = ?`, taskID).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *SQLiteTaskStore) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update task status: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var oldStatus string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM task_executions WHERE id = ?`, taskID).Scan(&oldStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("task not found: %s", taskID)
+		}
+		return fmt.Errorf("failed to get task: %w", err)
+	}
+
+	now := time.Now().UnixNano()
+	switch status {
+	case TaskStatusRunning:
+		_, err = tx.ExecContext(ctx, `UPDATE task_executions SET status = ?, attempted_at = ?, scheduled_at = NULL WHERE id = ?`, string(status), now, taskID)
+	case TaskStatusSuccess, TaskStatusFailed, TaskStatusCancelled:
+		_, err = tx.ExecContext(ctx, `UPDATE task_executions SET status = ?, finalized_at = ?, scheduled_at = NULL WHERE id = ?`, string(status), now, taskID)
+	case TaskStatusPending:
+		_, err = tx.ExecContext(ctx, `UPDATE task_executions SET status = ?, retried = retried + 1 WHERE id = ?`, string(status), taskID)
+	default:
+		_, err = tx.ExecContext(ctx, `UPDATE task_executions SET status = ? WHERE id = ?`, string(status), taskID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update task status: %w", err)
+	}
+
+	// Record the attempt started by a transition to RUNNING, and its outcome on the
+	// next transition.
+	if TaskStatus(oldStatus) == TaskStatusRunning {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE task_attempts SET status = ?, finished_at = ?
+			WHERE task_id = ? AND attempt = (SELECT MAX(attempt) FROM task_attempts WHERE task_id = ?)`,
+			string(status), now, taskID, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to update task attempt: %w", err)
+		}
+	}
+	if status == TaskStatusRunning {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO task_attempts (task_id, attempt, status, started_at)
+			SELECT ?, COALESCE(MAX(attempt), 0) + 1, ?, ? FROM task_attempts WHERE task_id = ?`,
+			taskID, string(status), now, taskID)
+		if err != nil {
+			return fmt.Errorf("failed to record task attempt: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update task status: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteTaskStore) UpdateTaskSnoozedTask(ctx context.Context, taskID string, scheduledAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE task_executions
+		SET status = ?, scheduled_at = ?, retried = retried + 1, max_retries = max_retries + 1
+		WHERE id = ?`,
+		string(TaskStatusPending), sqliteTime(scheduledAt), taskID)
+	if err != nil {
+		return fmt.Errorf("failed to update task status: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("task not found: %s", taskID)
+	}
+	return nil
+}
+
+func (s *SQLiteTaskStore) DeleteTaskExecution(ctx context.Context, taskID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM task_executions WHERE id = ?`, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to get task for deletion: task not found: %s", taskID)
+	}
+	return nil
+}
+
+func (s *SQLiteTaskStore) AddTaskError(ctx context.Context, taskID string, taskError TaskError) error {
+	// Set error timestamp if not set
+	if taskError.Timestamp.IsZero() {
+		taskError.Timestamp = time.Now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add task error: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM task_executions WHERE id = ?`, taskID).Scan(&n); err != nil {
+		return fmt.Errorf("failed to get task: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("task not found: %s", taskID)
+	}
+	if err := insertSQLiteTaskError(ctx, tx, taskID, taskError); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to add task error: %w", err)
+	}
+	return nil
+}
+
+// ListTaskAttempts returns the attempts recorded for a task, oldest first.
+func (s *SQLiteTaskStore) ListTaskAttempts(ctx context.Context, taskID string) ([]TaskAttempt, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT attempt, status, started_at, finished_at FROM task_attempts WHERE task_id = ? ORDER BY attempt`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []TaskAttempt
+	for rows.Next() {
+		var (
+			attempt    TaskAttempt
+			status     string
+			startedAt  int64
+			finishedAt sql.NullInt64
+		)
+		if err := rows.Scan(&attempt.Attempt, &status, &startedAt, &finishedAt); err != nil {
+			return nil, fmt.Errorf("failed to list task attempts: %w", err)
+		}
+		attempt.Status = TaskStatus(status)
+		attempt.StartedAt = time.Unix(0, startedAt)
+		attempt.FinishedAt = fromSQLiteTime(finishedAt)
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *SQLiteTaskStore) ListTaskExecutions(ctx context.Context, filter TaskFilter) ([]*TaskExecution, error) {
+	cursor, err := decodeTaskCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Status != nil {
+		where = append(where, "status = ?")
+		args = append(args, string(*filter.Status))
+	}
+	if filter.Kind != "" {
+		where = append(where, "task_kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if len(filter.Kinds) > 0 {
+		where = append(where, "task_kind IN (?"+strings.Repeat(", ?", len(filter.Kinds)-1)+")")
+		for _, kind := range filter.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if filter.Queue != "" {
+		where = append(where, "queue = ?")
+		args = append(args, filter.Queue)
+	}
+	if filter.ScheduleID != "" {
+		where = append(where, "schedule_id = ?")
+		args = append(args, filter.ScheduleID)
+	}
+	for _, tag := range filter.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM task_tags WHERE task_tags.task_id = task_executions.id AND tag = ?)")
+		args = append(args, tag)
+	}
+	if !filter.FromDate.IsZero() {
+		where = append(where, "created_sec >= ?")
+		args = append(args, filter.FromDate.Unix())
+	}
+	if !filter.ToDate.IsZero() {
+		where = append(where, "created_sec <= ?")
+		args = append(args, filter.ToDate.Unix())
+	}
+	if cursor != nil {
+		where = append(where, "(created_sec < ? OR (created_sec = ? AND id < ?))")
+		args = append(args, cursor.Created, cursor.Created, cursor.ID)
+	}
+
+	query := `SELECT ` + sqliteExecutionColumns + ` FROM task_executions`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_sec DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := make([]*TaskExecution, 0)
+	for rows.Next() {
+		task, err := scanSQLiteExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	rows.Close()
+
+	if err := s.loadRelations(ctx, tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *SQLiteTaskStore) GetMostRecentTaskExecutions(ctx context.Context, limit int) ([]*TaskExecution, error) {
+	return s.ListTaskExecutions(ctx, TaskFilter{Limit: limit})
+}
+
+func (s *SQLiteTaskStore) CleanupOldTaskExecutions(ctx context.Context, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan).UnixNano()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM task_executions WHERE created_at <= ?`, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup old tasks: %w", err)
+	}
+	return nil
+}
+
+// CheckHealth pings the database.
+func (s *SQLiteTaskStore) CheckHealth(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package uptask
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestSQLite(t *testing.T) *SQLiteTaskStore {
+	store, err := NewSQLiteTaskStore(filepath.Join(t.TempDir(), "tasks.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestSQLiteTaskStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("migrations are applied once", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tasks.db")
+		store, err := NewSQLiteTaskStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		store, err = NewSQLiteTaskStore(path)
+		require.NoError(t, err)
+		defer store.Close()
+		migrations, err := fs.ReadDir(sqliteMigrations, "migrations/sqlite")
+		require.NoError(t, err)
+		var n int
+		require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&n))
+		assert.Equal(t, len(migrations), n)
+	})
+
+	t.Run("create and get round trips", func(t *testing.T) {
+		store := setupTestSQLite(t)
+		task := createTestTask("task-1")
+		task.Tags = []string{"a", "b"}
+		task.ParentID = "parent"
+		task.Errors = []TaskError{{Message: "boom", Details: map[string]interface{}{"code": float64(1)}, Timestamp: time.Now()}}
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+
+		got, err := store.GetTaskExecution(ctx, "task-1")
+		require.NoError(t, err)
+		assert.Equal(t, task.ID, got.ID)
+		assert.Equal(t, task.TaskKind, got.TaskKind)
+		assert.Equal(t, task.Args, got.Args)
+		assert.Equal(t, task.Tags, got.Tags)
+		assert.Equal(t, task.ParentID, got.ParentID)
+		assert.True(t, task.CreatedAt.Equal(got.CreatedAt))
+		require.Len(t, got.Errors, 1)
+		assert.Equal(t, task.Errors[0].Details, got.Errors[0].Details)
+
+		// Creating again replaces the execution.
+		task.Status = TaskStatusSuccess
+		task.Tags = []string{"c"}
+		task.Errors = nil
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+		got, err = store.GetTaskExecution(ctx, "task-1")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusSuccess, got.Status)
+		assert.Equal(t, []string{"c"}, got.Tags)
+		assert.Empty(t, got.Errors)
+
+		_, err = store.GetTaskExecution(ctx, "missing")
+		assert.ErrorContains(t, err, "task not found")
+	})
+
+	t.Run("status transitions record attempts", func(t *testing.T) {
+		store := setupTestSQLite(t)
+		require.NoError(t, store.CreateTaskExecution(ctx, createTestTask("task-1")))
+
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusRunning))
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusPending))
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusRunning))
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusSuccess))
+
+		got, err := store.GetTaskExecution(ctx, "task-1")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusSuccess, got.Status)
+		assert.Equal(t, 2, got.Retried)
+		assert.False(t, got.AttemptedAt.IsZero())
+		assert.False(t, got.FinalizedAt.IsZero())
+		assert.True(t, got.ScheduledAt.IsZero())
+
+		attempts, err := store.ListTaskAttempts(ctx, "task-1")
+		require.NoError(t, err)
+		require.Len(t, attempts, 2)
+		assert.Equal(t, TaskStatusPending, attempts[0].Status)
+		assert.Equal(t, TaskStatusSuccess, attempts[1].Status)
+		assert.False(t, attempts[1].FinishedAt.IsZero())
+	})
+
+	t.Run("delete cascades", func(t *testing.T) {
+		store := setupTestSQLite(t)
+		task := createTestTask("task-1")
+		task.Tags = []string{"a"}
+		require.NoError(t, store.CreateTaskExecution(ctx, task))
+		require.NoError(t, store.UpdateTaskStatus(ctx, "task-1", TaskStatusRunning))
+		require.NoError(t, store.AddTaskError(ctx, "task-1", TaskError{Message: "boom"}))
+
+		require.NoError(t, store.DeleteTaskExecution(ctx, "task-1"))
+		for _, table := range []string{"task_attempts", "task_errors", "task_tags"} {
+			var n int
+			require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&n))
+			assert.Zero(t, n, table)
+		}
+		assert.Error(t, store.DeleteTaskExecution(ctx, "task-1"))
+	})
+
+	t.Run("list filters", func(t *testing.T) {
+		store := setupTestSQLite(t)
+		now := time.Now()
+		for i, queue := range []string{"a", "b", "a"} {
+			task := createTestTask(string(rune('1' + i)))
+			task.Queue = queue
+			task.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+			require.NoError(t, store.CreateTaskExecution(ctx, task))
+		}
+		require.NoError(t, store.UpdateTaskStatus(ctx, "3", TaskStatusRunning))
+
+		tasks, err := store.ListTaskExecutions(ctx, TaskFilter{Queue: "a"})
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "3", tasks[0].ID)
+
+		pending := TaskStatusPending
+		tasks, err = store.ListTaskExecutions(ctx, TaskFilter{Status: &pending, Queue: "a"})
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "1", tasks[0].ID)
+
+		tasks, err = store.GetMostRecentTaskExecutions(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "3", tasks[0].ID)
+
+		require.NoError(t, store.CleanupOldTaskExecutions(ctx, -90*time.Second))
+		tasks, err = store.ListTaskExecutions(ctx, TaskFilter{})
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+		assert.Equal(t, "3", tasks[0].ID)
+	})
+
+	t.Run("service records executions", func(t *testing.T) {
+		store := setupTestSQLite(t)
+		tsvc := NewTaskService(dummyTransport(), WithStore(store))
+		AddTaskHandler(tsvc, &DummyTaskProcessor{})
+
+		id, err := tsvc.StartTask(ctx, DummyTask{Name: "stored"}, nil)
+		require.NoError(t, err)
+		task, err := store.GetTaskExecution(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusPending, task.Status)
+		assert.Equal(t, "DummyTask", task.TaskKind)
+	})
+}
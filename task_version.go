@@ -0,0 +1,93 @@
+package uptask
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+)
+
+// Versioned can optionally be implemented by TaskArgs and events to version their
+// payload. The version is sent along with every task, so that a handler receiving a
+// payload serialized by an older version of the args can migrate it with upcasters
+// registered through WithUpcaster.
+//
+// Args that do not implement Versioned, and payloads sent without a version, are
+// version 1.
+//
+//	type SendEmailArgs struct {
+//		Recipients []string `json:"recipients"` // was Recipient string in version 1
+//	}
+//
+//	func (SendEmailArgs) Kind() string { return "send_email" }
+//	func (SendEmailArgs) Version() int { return 2 }
+type Versioned interface {
+	Version() int
+}
+
+// Upcaster migrates a JSON payload from one version of a task's args to the next.
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// WithUpcaster registers an upcaster migrating payloads of version fromVersion to
+// version fromVersion+1. Upcasters are applied in order until the payload reaches the
+// version of the handler's args, before the args are decoded:
+//
+//	uptask.AddTaskHandler(service, &SendEmailHandler{}, uptask.WithUpcaster(1, func(data json.RawMessage) (json.RawMessage, error) {
+//		var v1 struct{ Recipient string }
+//		if err := json.Unmarshal(data, &v1); err != nil {
+//			return nil, err
+//		}
+//		return json.Marshal(SendEmailArgs{Recipients: []string{v1.Recipient}})
+//	}))
+func WithUpcaster(fromVersion int, upcaster Upcaster) HandlerOption {
+	return func(c *handlerConfig) {
+		if c.upcasters == nil {
+			c.upcasters = make(map[int]Upcaster)
+		}
+		c.upcasters[fromVersion] = upcaster
+	}
+}
+
+// argsVersion returns the version of args, defaulting to 1.
+func argsVersion(args any) int {
+	if v, ok := args.(Versioned); ok && v.Version() > 0 {
+		return v.Version()
+	}
+	return 1
+}
+
+// upcast migrates the payload of ce to the version of T using upcasters.
+func upcast[T any](ce *cloudevents.Event, upcasters map[int]Upcaster) error {
+	var args T
+	current := argsVersion(args)
+	version, ok := events.GetVersion(ce)
+	if !ok || version <= 0 {
+		version = 1
+	}
+	if version == current {
+		return nil
+	}
+	if version > current {
+		return fmt.Errorf("payload version %d is newer than the handler's version %d", version, current)
+	}
+
+	data := json.RawMessage(ce.Data())
+	for v := version; v < current; v++ {
+		upcaster, ok := upcasters[v]
+		if !ok {
+			return fmt.Errorf("no upcaster registered from version %d to %d", v, v+1)
+		}
+		var err error
+		data, err = upcaster(data)
+		if err != nil {
+			return fmt.Errorf("failed to upcast payload from version %d to %d: %w", v, v+1, err)
+		}
+	}
+
+	if err := ce.SetData(ce.DataContentType(), []byte(data)); err != nil {
+		return fmt.Errorf("failed to set upcasted payload: %w", err)
+	}
+	events.SetVersion(ce, current)
+	return nil
+}
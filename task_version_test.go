@@ -0,0 +1,103 @@
+package uptask
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type emailArgsV1 struct {
+	Recipient string `json:"recipient"`
+}
+
+func (emailArgsV1) Kind() string { return "SendEmail" }
+
+type emailArgsV2 struct {
+	Recipients []string `json:"recipients"`
+	Subject    string   `json:"subject"`
+}
+
+func (emailArgsV2) Kind() string { return "SendEmail" }
+func (emailArgsV2) Version() int { return 3 }
+
+type emailHandler struct {
+	TaskHandlerDefaults[emailArgsV2]
+	received []emailArgsV2
+}
+
+func (h *emailHandler) ProcessTask(ctx context.Context, task *Container[emailArgsV2]) error {
+	h.received = append(h.received, task.Args)
+	return nil
+}
+
+func TestUpcasters(t *testing.T) {
+	ctx := context.Background()
+
+	v1ToV2 := func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 emailArgsV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]any{"recipients": []string{v1.Recipient}})
+	}
+	v2ToV3 := func(data json.RawMessage) (json.RawMessage, error) {
+		var v2 map[string]any
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		v2["subject"] = "(no subject)"
+		return json.Marshal(v2)
+	}
+
+	t.Run("current version is not upcasted", func(t *testing.T) {
+		ce, err := events.Serialize(ctx, emailArgsV2{Recipients: []string{"a@example.com"}, Subject: "hi"})
+		require.NoError(t, err)
+		version, ok := events.GetVersion(&ce)
+		require.True(t, ok)
+		require.Equal(t, 3, version)
+
+		handler := &emailHandler{}
+		tsvc := NewTaskService(dummyTransport())
+		AddTaskHandler(tsvc, handler, WithUpcaster(1, v1ToV2), WithUpcaster(2, v2ToV3))
+		require.NoError(t, tsvc.HandleEvent(ctx, received(ce)))
+		assert.Equal(t, []emailArgsV2{{Recipients: []string{"a@example.com"}, Subject: "hi"}}, handler.received)
+	})
+
+	t.Run("old payload is upcasted in order", func(t *testing.T) {
+		ce, err := events.Serialize(ctx, emailArgsV1{Recipient: "a@example.com"})
+		require.NoError(t, err)
+
+		handler := &emailHandler{}
+		tsvc := NewTaskService(dummyTransport())
+		AddTaskHandler(tsvc, handler, WithUpcaster(1, v1ToV2), WithUpcaster(2, v2ToV3))
+		require.NoError(t, tsvc.HandleEvent(ctx, received(ce)))
+		assert.Equal(t, []emailArgsV2{{Recipients: []string{"a@example.com"}, Subject: "(no subject)"}}, handler.received)
+	})
+
+	t.Run("missing upcaster fails", func(t *testing.T) {
+		ce, err := events.Serialize(ctx, emailArgsV1{Recipient: "a@example.com"})
+		require.NoError(t, err)
+
+		handler := &emailHandler{}
+		tsvc := NewTaskService(dummyTransport())
+		AddTaskHandler(tsvc, handler, WithUpcaster(1, v1ToV2))
+		err = tsvc.HandleEvent(ctx, received(ce))
+		require.ErrorContains(t, err, "no upcaster registered from version 2 to 3")
+		assert.Empty(t, handler.received)
+	})
+
+	t.Run("newer payload fails", func(t *testing.T) {
+		ce, err := events.Serialize(ctx, emailArgsV2{})
+		require.NoError(t, err)
+		events.SetVersion(&ce, 4)
+
+		tsvc := NewTaskService(dummyTransport())
+		AddTaskHandler(tsvc, &emailHandler{})
+		err = tsvc.HandleEvent(ctx, received(ce))
+		require.ErrorContains(t, err, "newer than the handler's version")
+	})
+}
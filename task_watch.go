@@ -0,0 +1,133 @@
+package uptask
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Watcher is implemented by task stores that publish the changes of the stored
+// executions.
+//
+// Implemented by RedisTaskStore and MemoryTaskStore.
+type Watcher interface {
+	// Watch returns a channel receiving the changes of the executions matching filter,
+	// whose Limit and Cursor are ignored. The channel is closed once ctx is done, or
+	// when the store stops publishing changes, for example if it fails to subscribe.
+	// Changes are delivered at most once: a consumer that falls behind misses them.
+	Watch(ctx context.Context, filter TaskFilter) <-chan TaskChange
+}
+
+// TaskChange is a change of a stored execution.
+type TaskChange struct {
+	TaskID    string     `json:"task_id"`
+	OldStatus TaskStatus `json:"old_status,omitempty"` // Empty when the execution was created
+	Status    TaskStatus `json:"status"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	// Task is the execution after the change, or before it if it was deleted.
+	Task *TaskExecution `json:"task"`
+	At   time.Time      `json:"at"`
+}
+
+// watchBuffer is the number of changes buffered for each watcher.
+const watchBuffer = 100
+
+// waitPollInterval is how often WaitForResult re-reads the task, in case its changes
+// were dropped.
+const waitPollInterval = time.Second
+
+// newTaskChange describes replacing old with task, either of which is nil when the
+// execution is created or deleted.
+func newTaskChange(old, task *TaskExecution) TaskChange {
+	change := TaskChange{Task: task, At: time.Now()}
+	if old != nil {
+		change.OldStatus = old.Status
+	}
+	if task == nil {
+		change.Task = old
+		change.Deleted = true
+	}
+	change.TaskID = change.Task.ID
+	change.Status = change.Task.Status
+	return change
+}
+
+// matches reports whether the execution matches filter, ignoring Limit and Cursor,
+// before or after the change. Only the status changes, so watchers filtering on it
+// also see executions leaving it.
+func (c TaskChange) matches(filter TaskFilter) bool {
+	filter.Cursor = ""
+	if filter.matches(c.Task, nil) {
+		return true
+	}
+	if filter.Status == nil || *filter.Status != c.OldStatus {
+		return false
+	}
+	filter.Status = nil
+	return filter.matches(c.Task, nil)
+}
+
+// isFinished reports whether an execution in status will not run again.
+func isFinished(status TaskStatus) bool {
+	return status == TaskStatusSuccess || status == TaskStatusFailed || status == TaskStatusCancelled
+}
+
+// WaitForResult blocks until the task finishes, and returns its final execution. The
+// store of the client must implement Watcher. The task is re-read on each of its
+// changes, and every second in case changes were dropped.
+func (c *TaskClient) WaitForResult(ctx context.Context, taskID string) (*TaskExecution, error) {
+	if !c.storeEnabled {
+		return nil, fmt.Errorf("no task store configured")
+	}
+	watcher, ok := baseStore(c.store).(Watcher)
+	if !ok {
+		return nil, fmt.Errorf("task store %T does not implement Watcher", c.store)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Watch before reading the task, so that no change is missed in between
+	changes := watcher.Watch(ctx, TaskFilter{})
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		task, err := c.store.GetTaskExecution(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if isFinished(task.Status) {
+			return task, nil
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-ticker.C:
+				break wait
+			case change, ok := <-changes:
+				if !ok {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					return nil, fmt.Errorf("failed to watch task: %s", taskID)
+				}
+				if change.TaskID != taskID {
+					continue
+				}
+				if change.Deleted {
+					return nil, fmt.Errorf("task was deleted: %s", taskID)
+				}
+				break wait
+			}
+		}
+	}
+}
+
+// WaitForResult blocks until the task finishes, and returns its final execution. The
+// store of the service must implement Watcher.
+func (c *TaskService) WaitForResult(ctx context.Context, taskID string) (*TaskExecution, error) {
+	return c.client.WaitForResult(ctx, taskID)
+}
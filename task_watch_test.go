@@ -0,0 +1,95 @@
+package uptask
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentStore publishes no changes, or closes the watch channel straight away if
+// closed is set, as a store failing to subscribe does.
+type silentStore struct {
+	*MemoryTaskStore
+	closed bool
+}
+
+func (s silentStore) Watch(ctx context.Context, filter TaskFilter) <-chan TaskChange {
+	changes := make(chan TaskChange)
+	if s.closed {
+		close(changes)
+	}
+	return changes
+}
+
+func TestWaitForResult(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	client := NewTaskClient(nil, WithClientStore(store))
+
+	t.Run("returns finished tasks", func(t *testing.T) {
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: "done", Status: TaskStatusFailed}))
+		task, err := client.WaitForResult(ctx, "done")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusFailed, task.Status)
+	})
+
+	t.Run("waits for the final status", func(t *testing.T) {
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: "task", Status: TaskStatusPending}))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = store.UpdateTaskStatus(ctx, "task", TaskStatusRunning)
+			_ = store.UpdateTaskStatus(ctx, "task", TaskStatusSuccess)
+		}()
+		task, err := client.WaitForResult(ctx, "task")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusSuccess, task.Status)
+		assert.False(t, task.FinalizedAt.IsZero())
+	})
+
+	t.Run("fails when the task is deleted", func(t *testing.T) {
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: "deleted", Status: TaskStatusPending}))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = store.DeleteTaskExecution(ctx, "deleted")
+		}()
+		_, err := client.WaitForResult(ctx, "deleted")
+		assert.ErrorContains(t, err, "task was deleted")
+	})
+
+	t.Run("stops with the context", func(t *testing.T) {
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: "stuck", Status: TaskStatusRunning}))
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := client.WaitForResult(ctx, "stuck")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("polls the task when changes are dropped", func(t *testing.T) {
+		silent := silentStore{MemoryTaskStore: store}
+		require.NoError(t, store.CreateTaskExecution(ctx, &TaskExecution{ID: "dropped", Status: TaskStatusRunning}))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = store.UpdateTaskStatus(ctx, "dropped", TaskStatusSuccess)
+		}()
+		task, err := NewTaskClient(nil, WithClientStore(silent)).WaitForResult(ctx, "dropped")
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusSuccess, task.Status)
+	})
+
+	t.Run("fails when the watch is closed", func(t *testing.T) {
+		closed := silentStore{MemoryTaskStore: store, closed: true}
+		task, err := NewTaskClient(nil, WithClientStore(closed)).WaitForResult(ctx, "stuck")
+		assert.Nil(t, task)
+		assert.ErrorContains(t, err, "failed to watch task")
+	})
+
+	t.Run("requires a watcher", func(t *testing.T) {
+		sqliteStore, err := NewSQLiteTaskStore(":memory:")
+		require.NoError(t, err)
+		_, err = NewTaskClient(nil, WithClientStore(sqliteStore)).WaitForResult(ctx, "task")
+		assert.ErrorContains(t, err, "does not implement Watcher")
+	})
+}
@@ -0,0 +1,455 @@
+package uptask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStreamsPrefix = "uptask:"
+	streamEventField     = "event"
+)
+
+// RedisStreamsTransport implements Transport on top of Redis Streams, for deployments
+// that cannot reach QStash. Events are added to one stream per queue and processed by
+// a RedisStreamsRunner. Events scheduled in the future are kept in a sorted set until
+// they are due.
+type RedisStreamsTransport struct {
+	client *redis.Client
+	prefix string
+}
+
+type RedisStreamsOption func(*RedisStreamsTransport)
+
+// WithStreamsPrefix sets the prefix of the keys used by the transport. Defaults to
+// "uptask:".
+func WithStreamsPrefix(prefix string) RedisStreamsOption {
+	return func(t *RedisStreamsTransport) {
+		t.prefix = prefix
+	}
+}
+
+func NewRedisStreamsTransport(client *redis.Client, opts ...RedisStreamsOption) *RedisStreamsTransport {
+	transport := &RedisStreamsTransport{
+		client: client,
+		prefix: defaultStreamsPrefix,
+	}
+	for _, opt := range opts {
+		opt(transport)
+	}
+	return transport
+}
+
+func (t *RedisStreamsTransport) streamKey(queue string) string {
+	return t.prefix + "stream:" + queue
+}
+
+func (t *RedisStreamsTransport) delayedKey() string {
+	return t.prefix + "delayed"
+}
+
+func queueOrDefault(queue string) string {
+	if queue == "" {
+		return "default"
+	}
+	return queue
+}
+
+// Send adds the event to the stream of its queue, or to the delayed set if it is
+// scheduled in the future.
+func (t *RedisStreamsTransport) Send(ctx context.Context, ce cloudevents.Event, opts *InsertOpts) error {
+	queue := queueOrDefault(opts.Queue)
+	if strings.Contains(queue, "|") {
+		return fmt.Errorf("invalid queue name: %q", queue)
+	}
+	events.SetQueue(&ce, queue)
+	if opts.MaxRetries >= 0 {
+		events.SetMaxRetries(&ce, opts.MaxRetries)
+	}
+
+	if !opts.ScheduledAt.IsZero() && opts.ScheduledAt.After(time.Now()) {
+		events.SetNotBefore(&ce, opts.ScheduledAt)
+		return t.schedule(ctx, t.client, ce, queue, opts.ScheduledAt)
+	}
+
+	data, err := ce.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	err = t.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.streamKey(queue),
+		Values: map[string]interface{}{streamEventField: string(data)},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add event to stream: %w", err)
+	}
+	return nil
+}
+
+// schedule adds the event to the delayed set, to be moved to its stream at runAt.
+func (t *RedisStreamsTransport) schedule(ctx context.Context, client redis.Cmdable, ce cloudevents.Event, queue string, runAt time.Time) error {
+	data, err := ce.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	err = client.ZAdd(ctx, t.delayedKey(), redis.Z{
+		Score:  float64(runAt.UnixMilli()),
+		Member: queue + "|" + string(data),
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to schedule event: %w", err)
+	}
+	return nil
+}
+
+// promoteDelayedScript moves due events from the delayed set to their streams.
+var promoteDelayedScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+	local sep = string.find(item, '|', 1, true)
+	local queue = string.sub(item, 1, sep - 1)
+	local event = string.sub(item, sep + 1)
+	redis.call('XADD', ARGV[3] .. queue, '*', ARGV[4], event)
+	redis.call('ZREM', KEYS[1], item)
+end
+return #items
+`)
+
+// RedisStreamsRunner consumes the streams written by a RedisStreamsTransport with a
+// consumer group and dispatches every event to a Handler, usually a TaskService.
+//
+// Events are acknowledged once handled successfully. Failed events are rescheduled
+// with a backoff until their retries are exhausted. Events left pending by a consumer
+// that crashed are claimed after WithStreamsMinIdle.
+type RedisStreamsRunner struct {
+	transport    *RedisStreamsTransport
+	handler      Handler
+	log          Logger
+	queues       []string
+	group        string
+	consumer     string
+	concurrency  int
+	block        time.Duration
+	minIdle      time.Duration
+	pollInterval time.Duration
+	backoff      func(retried int) time.Duration
+}
+
+type RedisStreamsRunnerOption func(*RedisStreamsRunner)
+
+// WithStreamsQueues sets the queues the runner consumes. Defaults to "default".
+func WithStreamsQueues(queues ...string) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.queues = queues
+	}
+}
+
+// WithStreamsConsumer sets the consumer group and the name of this consumer within
+// the group. Every process must use a distinct consumer name.
+func WithStreamsConsumer(group, consumer string) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.group = group
+		r.consumer = consumer
+	}
+}
+
+// WithStreamsConcurrency sets the number of events processed concurrently.
+func WithStreamsConcurrency(n int) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.concurrency = n
+	}
+}
+
+// WithStreamsMinIdle sets how long an event may stay pending with a consumer before
+// another consumer claims it for redelivery.
+func WithStreamsMinIdle(d time.Duration) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.minIdle = d
+	}
+}
+
+// WithStreamsPollInterval sets how often delayed events are checked for being due.
+func WithStreamsPollInterval(d time.Duration) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.pollInterval = d
+	}
+}
+
+// WithStreamsBackoff sets the delay before a failed event is retried, given the
+// number of times it has been retried so far.
+func WithStreamsBackoff(backoff func(retried int) time.Duration) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.backoff = backoff
+	}
+}
+
+// WithStreamsLogger sets the runner's logger.
+func WithStreamsLogger(l Logger) RedisStreamsRunnerOption {
+	return func(r *RedisStreamsRunner) {
+		r.log = l
+	}
+}
+
+// defaultBackoff retries after 1s, 2s, 4s, ... capped at 10 minutes.
+func defaultBackoff(retried int) time.Duration {
+	if retried >= 10 {
+		return 10 * time.Minute
+	}
+	return time.Second << retried
+}
+
+func NewRedisStreamsRunner(transport *RedisStreamsTransport, handler Handler, opts ...RedisStreamsRunnerOption) *RedisStreamsRunner {
+	runner := &RedisStreamsRunner{
+		transport:    transport,
+		handler:      handler,
+		log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		queues:       []string{"default"},
+		group:        "uptask",
+		consumer:     "uptask",
+		concurrency:  10,
+		block:        time.Second,
+		minIdle:      5 * time.Minute,
+		pollInterval: time.Second,
+		backoff:      defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(runner)
+	}
+	if runner.concurrency < 1 {
+		runner.concurrency = 1
+	}
+	return runner
+}
+
+type streamMessage struct {
+	queue   string
+	message redis.XMessage
+	claimed bool
+}
+
+// Run consumes events until ctx is cancelled. Events being handled when ctx is
+// cancelled are allowed to finish.
+func (r *RedisStreamsRunner) Run(ctx context.Context) error {
+	client := r.transport.client
+	for _, queue := range r.queues {
+		err := client.XGroupCreateMkStream(ctx, r.transport.streamKey(queue), r.group, "0").Err()
+		if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group for queue %s: %w", queue, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, r.concurrency)
+	dispatch := func(msg streamMessage) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			r.process(context.WithoutCancel(ctx), msg)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.promoteLoop(ctx)
+	}()
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= r.minIdle/2 {
+			lastClaim = time.Now()
+			for _, msg := range r.claimStale(ctx) {
+				dispatch(msg)
+			}
+		}
+
+		msgs, err := r.read(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.log.Error("failed to read from streams", "error", err)
+				time.Sleep(r.pollInterval)
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			dispatch(msg)
+		}
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (r *RedisStreamsRunner) read(ctx context.Context) ([]streamMessage, error) {
+	streams := make([]string, 0, len(r.queues)*2)
+	for _, queue := range r.queues {
+		streams = append(streams, r.transport.streamKey(queue))
+	}
+	for range r.queues {
+		streams = append(streams, ">")
+	}
+
+	res, err := r.transport.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    r.group,
+		Consumer: r.consumer,
+		Streams:  streams,
+		Count:    int64(r.concurrency),
+		Block:    r.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []streamMessage
+	for _, stream := range res {
+		queue := strings.TrimPrefix(stream.Stream, r.transport.prefix+"stream:")
+		for _, message := range stream.Messages {
+			msgs = append(msgs, streamMessage{queue: queue, message: message})
+		}
+	}
+	return msgs, nil
+}
+
+// claimStale claims events left pending by other consumers for longer than minIdle.
+func (r *RedisStreamsRunner) claimStale(ctx context.Context) []streamMessage {
+	var msgs []streamMessage
+	for _, queue := range r.queues {
+		claimed, _, err := r.transport.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   r.transport.streamKey(queue),
+			Group:    r.group,
+			Consumer: r.consumer,
+			MinIdle:  r.minIdle,
+			Start:    "0",
+			Count:    int64(r.concurrency),
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				r.log.Error("failed to claim stale events", "queue", queue, "error", err)
+			}
+			continue
+		}
+		for _, message := range claimed {
+			r.log.Info("claimed stale event", "queue", queue, "message", message.ID)
+			msgs = append(msgs, streamMessage{queue: queue, message: message, claimed: true})
+		}
+	}
+	return msgs
+}
+
+func (r *RedisStreamsRunner) promoteLoop(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := promoteDelayedScript.Run(ctx, r.transport.client,
+				[]string{r.transport.delayedKey()},
+				time.Now().UnixMilli(), 100, r.transport.prefix+"stream:", streamEventField,
+			).Err()
+			if err != nil && ctx.Err() == nil {
+				r.log.Error("failed to promote delayed events", "error", err)
+			}
+		}
+	}
+}
+
+func (r *RedisStreamsRunner) process(ctx context.Context, msg streamMessage) {
+	client := r.transport.client
+	stream := r.transport.streamKey(msg.queue)
+	ack := func(pipe redis.Pipeliner) {
+		pipe.XAck(ctx, stream, r.group, msg.message.ID)
+		pipe.XDel(ctx, stream, msg.message.ID)
+	}
+
+	data, _ := msg.message.Values[streamEventField].(string)
+	ce := cloudevents.NewEvent()
+	if err := ce.UnmarshalJSON([]byte(data)); err != nil {
+		r.log.Error("dropping invalid event", "queue", msg.queue, "message", msg.message.ID, "error", err)
+		_, _ = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error { ack(pipe); return nil })
+		return
+	}
+
+	retried, _ := events.GetRetried(&ce)
+	maxRetries, _ := events.GetMaxRetries(&ce)
+	if msg.claimed && r.deliveries(ctx, stream, msg.message.ID) > int64(maxRetries)+1 {
+		r.log.Error("dropping event redelivered too many times", "kind", ce.Type(), "id", ce.ID())
+		_, _ = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error { ack(pipe); return nil })
+		return
+	}
+
+	events.SetRetried(&ce, retried)
+	events.SetScheduled(&ce, false)
+	events.SetQstashMessageID(&ce, msg.message.ID)
+
+	handleErr := r.handler.HandleEvent(ctx, ce)
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		switch {
+		case rejected(handleErr):
+			// Delivered again as is, without using a retry
+			if err := r.transport.schedule(ctx, pipe, ce, msg.queue, time.Now().Add(rejectedDelay)); err != nil {
+				return err
+			}
+		case handleErr != nil && retried < maxRetries:
+			events.SetRetried(&ce, retried+1)
+			runAt := time.Now().Add(r.backoff(retried))
+			if err := r.transport.schedule(ctx, pipe, ce, msg.queue, runAt); err != nil {
+				return err
+			}
+		}
+		ack(pipe)
+		return nil
+	})
+	if err != nil {
+		r.log.Error("failed to acknowledge event", "kind", ce.Type(), "id", ce.ID(), "error", err)
+	}
+
+	switch {
+	case handleErr == nil:
+		r.log.Debug("event handled", "kind", ce.Type(), "id", ce.ID())
+	case rejected(handleErr):
+		r.log.Info("event rejected, delivering again later", "kind", ce.Type(), "id", ce.ID(), "error", handleErr)
+	case retried < maxRetries:
+		r.log.Warn("event failed, retrying", "kind", ce.Type(), "id", ce.ID(), "retried", retried, "maxRetries", maxRetries, "error", handleErr)
+	default:
+		r.log.Error("event failed, retries exhausted", "kind", ce.Type(), "id", ce.ID(), "retried", retried, "error", handleErr)
+	}
+}
+
+// deliveries returns the number of times a pending event has been delivered.
+func (r *RedisStreamsRunner) deliveries(ctx context.Context, stream, id string) int64 {
+	pending, err := r.transport.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  r.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// CheckHealth pings Redis.
+func (t *RedisStreamsTransport) CheckHealth(ctx context.Context) error {
+	if err := t.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping redis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package uptask
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func completedTasks(p *DummyTaskProcessor) []taskContainer {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]taskContainer(nil), p.Tasks...)
+}
+
+func resetTasks(p *DummyTaskProcessor) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.Tasks = nil
+}
+
+func TestRedisStreamsTransport(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	transport := NewRedisStreamsTransport(client)
+	tsvc := NewTaskService(transport)
+	processor := &DummyTaskProcessor{}
+	AddTaskHandler(tsvc, processor)
+
+	runner := NewRedisStreamsRunner(transport, tsvc,
+		WithStreamsQueues("default", "critical"),
+		WithStreamsConsumer("workers", "worker-1"),
+		WithStreamsPollInterval(10*time.Millisecond),
+		WithStreamsMinIdle(50*time.Millisecond),
+		WithStreamsBackoff(func(int) time.Duration { return 10 * time.Millisecond }),
+	)
+	runner.block = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	t.Run("handles and acknowledges events", func(t *testing.T) {
+		id, err := tsvc.StartTask(ctx, DummyTask{Name: "now"}, &InsertOpts{Queue: "critical"})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, id, completedTasks(processor)[0].Id)
+		require.Eventually(t, func() bool {
+			return client.XLen(ctx, transport.streamKey("critical")).Val() == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("retries failed events", func(t *testing.T) {
+		resetTasks(processor)
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "flaky", FailFirst: true}, nil)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 1, completedTasks(processor)[0].Retried)
+	})
+
+	t.Run("delays scheduled events", func(t *testing.T) {
+		resetTasks(processor)
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "later"}, &InsertOpts{ScheduledAt: time.Now().Add(200 * time.Millisecond)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), client.ZCard(ctx, transport.delayedKey()).Val())
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Empty(t, completedTasks(processor))
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int64(0), client.ZCard(ctx, transport.delayedKey()).Val())
+	})
+
+	t.Run("claims events left pending by a crashed consumer", func(t *testing.T) {
+		resetTasks(processor)
+		stream := transport.streamKey("crashed")
+		require.NoError(t, client.XGroupCreateMkStream(ctx, stream, "workers", "0").Err())
+
+		crashed := NewRedisStreamsTransport(client)
+		crashedSvc := NewTaskService(crashed)
+		AddTaskHandler(crashedSvc, &DummyTaskProcessor{})
+		_, err := crashedSvc.StartTask(ctx, DummyTask{Name: "orphan"}, &InsertOpts{Queue: "crashed"})
+		require.NoError(t, err)
+		// Another consumer reads the event and never acknowledges it.
+		res, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "workers", Consumer: "worker-2", Streams: []string{stream, ">"}}).Result()
+		require.NoError(t, err)
+		require.Len(t, res[0].Messages, 1)
+
+		claimer := NewRedisStreamsRunner(transport, tsvc,
+			WithStreamsQueues("crashed"),
+			WithStreamsConsumer("workers", "worker-1"),
+			WithStreamsMinIdle(50*time.Millisecond),
+		)
+		claimer.block = 20 * time.Millisecond
+		claimCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() { _ = claimer.Run(claimCtx) }()
+
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "orphan", completedTasks(processor)[0].DummyTask.Name)
+	})
+}
+
+func TestRedisStreamsTransportRequeuesRejectedEvents(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	transport := NewRedisStreamsTransport(client)
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	tsvc := NewTaskService(transport)
+	AddTaskHandler(tsvc, handler)
+	runner := NewRedisStreamsRunner(transport, tsvc,
+		WithStreamsConsumer("workers", "worker-1"),
+		WithStreamsPollInterval(10*time.Millisecond),
+	)
+	runner.block = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	_, err = tsvc.StartTask(ctx, blockingArgs{}, nil)
+	require.NoError(t, err)
+	<-handler.started
+	drained := make(chan error)
+	go func() { drained <- tsvc.Shutdown(ctx) }()
+	require.Eventually(t, tsvc.Draining, time.Second, time.Millisecond)
+	close(handler.release)
+	require.NoError(t, <-drained)
+
+	// Picked up once the service drained
+	rejectedID, err := tsvc.StartTask(ctx, blockingArgs{}, nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return client.ZCard(ctx, transport.delayedKey()).Val() == 1 &&
+			client.XLen(ctx, transport.streamKey("default")).Val() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	items, err := client.ZRangeWithScores(ctx, transport.delayedKey(), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Greater(t, int64(items[0].Score), time.Now().UnixMilli())
+	_, data, _ := strings.Cut(items[0].Member.(string), "|")
+	ce := cloudevents.NewEvent()
+	require.NoError(t, ce.UnmarshalJSON([]byte(data)))
+	assert.Equal(t, rejectedID, ce.ID())
+	retried, _ := events.GetRetried(&ce)
+	assert.Equal(t, 0, retried)
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, defaultBackoff(0))
+	assert.Equal(t, 512*time.Second, defaultBackoff(9))
+	assert.Equal(t, 10*time.Minute, defaultBackoff(10))
+	assert.Equal(t, 10*time.Minute, defaultBackoff(50))
+}
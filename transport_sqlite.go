@@ -0,0 +1,352 @@
+package uptask
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteJobsSchema = `
+CREATE TABLE IF NOT EXISTS uptask_jobs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue        TEXT    NOT NULL,
+	kind         TEXT    NOT NULL,
+	event        BLOB    NOT NULL,
+	run_at       INTEGER NOT NULL,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	locked_until INTEGER NOT NULL DEFAULT 0,
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS uptask_jobs_queue_run_at ON uptask_jobs (queue, run_at);
+`
+
+// SQLiteTransport implements Transport with a jobs table in a SQLite database, for
+// single-node deployments that should not depend on external services. Jobs are
+// processed by a SQLiteWorkerPool.
+type SQLiteTransport struct {
+	db *sql.DB
+}
+
+// NewSQLiteTransport opens the SQLite database at path, creating it and the jobs table
+// if needed. Use ":memory:" for a database that lives as long as the transport.
+func NewSQLiteTransport(path string) (*SQLiteTransport, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := NewSQLiteTransportFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return transport, nil
+}
+
+// NewSQLiteTransportFromDB creates the jobs table in db if needed.
+func NewSQLiteTransportFromDB(db *sql.DB) (*SQLiteTransport, error) {
+	if _, err := db.Exec(sqliteJobsSchema); err != nil {
+		return nil, fmt.Errorf("failed to create jobs table: %w", err)
+	}
+	return &SQLiteTransport{db: db}, nil
+}
+
+// openSQLite opens a SQLite database with foreign keys enabled and a single
+// connection, so that concurrent writers are serialized instead of failing with
+// SQLITE_BUSY.
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// Close closes the underlying database.
+func (t *SQLiteTransport) Close() error {
+	return t.db.Close()
+}
+
+// Send inserts the event into the jobs table. It runs once ScheduledAt has passed.
+func (t *SQLiteTransport) Send(ctx context.Context, ce cloudevents.Event, opts *InsertOpts) error {
+	queue := queueOrDefault(opts.Queue)
+	events.SetQueue(&ce, queue)
+	if opts.MaxRetries >= 0 {
+		events.SetMaxRetries(&ce, opts.MaxRetries)
+	}
+	runAt := time.Now()
+	if !opts.ScheduledAt.IsZero() && opts.ScheduledAt.After(runAt) {
+		events.SetNotBefore(&ce, opts.ScheduledAt)
+		runAt = opts.ScheduledAt
+	}
+
+	data, err := ce.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	_, err = t.db.ExecContext(ctx,
+		`INSERT INTO uptask_jobs (queue, kind, event, run_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		queue, ce.Type(), data, runAt.UnixMilli(), time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert job: %w", err)
+	}
+	return nil
+}
+
+// SQLiteWorkerPool polls the jobs table of a SQLiteTransport and dispatches every job
+// to a Handler, usually a TaskService.
+//
+// A job is leased to a worker while it is handled, and the lease is extended for as
+// long as the handler runs. Jobs whose lease expired, because the process crashed,
+// are picked up again. Failed jobs are rescheduled with a backoff until their retries
+// are exhausted.
+type SQLiteWorkerPool struct {
+	transport    *SQLiteTransport
+	handler      Handler
+	log          Logger
+	queues       map[string]int
+	pollInterval time.Duration
+	lease        time.Duration
+	backoff      func(retried int) time.Duration
+}
+
+type SQLiteWorkerOption func(*SQLiteWorkerPool)
+
+// WithSQLiteQueue makes the pool process queue with concurrency workers. Defaults to
+// the "default" queue with 10 workers.
+func WithSQLiteQueue(queue string, concurrency int) SQLiteWorkerOption {
+	return func(p *SQLiteWorkerPool) {
+		p.queues[queue] = concurrency
+	}
+}
+
+// WithSQLitePollInterval sets how long an idle worker waits before polling again.
+func WithSQLitePollInterval(d time.Duration) SQLiteWorkerOption {
+	return func(p *SQLiteWorkerPool) {
+		p.pollInterval = d
+	}
+}
+
+// WithSQLiteLease sets how long a job stays leased to a worker that stopped extending
+// it, before another worker picks it up.
+func WithSQLiteLease(d time.Duration) SQLiteWorkerOption {
+	return func(p *SQLiteWorkerPool) {
+		p.lease = d
+	}
+}
+
+// WithSQLiteBackoff sets the delay before a failed job is retried, given the number of
+// times it has been retried so far.
+func WithSQLiteBackoff(backoff func(retried int) time.Duration) SQLiteWorkerOption {
+	return func(p *SQLiteWorkerPool) {
+		p.backoff = backoff
+	}
+}
+
+// WithSQLiteLogger sets the pool's logger.
+func WithSQLiteLogger(l Logger) SQLiteWorkerOption {
+	return func(p *SQLiteWorkerPool) {
+		p.log = l
+	}
+}
+
+func NewSQLiteWorkerPool(transport *SQLiteTransport, handler Handler, opts ...SQLiteWorkerOption) *SQLiteWorkerPool {
+	pool := &SQLiteWorkerPool{
+		transport:    transport,
+		handler:      handler,
+		log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		queues:       make(map[string]int),
+		pollInterval: time.Second,
+		lease:        time.Minute,
+		backoff:      defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(pool)
+	}
+	if len(pool.queues) == 0 {
+		pool.queues["default"] = 10
+	}
+	return pool
+}
+
+type sqliteJob struct {
+	id       int64
+	event    []byte
+	attempts int
+}
+
+// Run processes jobs until ctx is cancelled. Jobs being handled when ctx is cancelled
+// are allowed to finish.
+func (p *SQLiteWorkerPool) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for queue, concurrency := range p.queues {
+		for i := 0; i < max(concurrency, 1); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.work(ctx, queue)
+			}()
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+func (p *SQLiteWorkerPool) work(ctx context.Context, queue string) {
+	for ctx.Err() == nil {
+		job, err := p.claim(ctx, queue)
+		if err != nil && ctx.Err() == nil {
+			p.log.Error("failed to claim job", "queue", queue, "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(p.pollInterval):
+			}
+			continue
+		}
+		p.process(context.WithoutCancel(ctx), job)
+	}
+}
+
+// claim leases the next due job of queue, returning nil if there is none.
+func (p *SQLiteWorkerPool) claim(ctx context.Context, queue string) (*sqliteJob, error) {
+	now := time.Now().UnixMilli()
+	row := p.transport.db.QueryRowContext(ctx, `
+		UPDATE uptask_jobs SET locked_until = ?, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM uptask_jobs
+			WHERE queue = ? AND run_at <= ? AND locked_until <= ?
+			ORDER BY run_at, id LIMIT 1
+		)
+		RETURNING id, event, attempts`,
+		now+p.lease.Milliseconds(), queue, now, now,
+	)
+	job := &sqliteJob{}
+	err := row.Scan(&job.id, &job.event, &job.attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (p *SQLiteWorkerPool) process(ctx context.Context, job *sqliteJob) {
+	db := p.transport.db
+	ce := cloudevents.NewEvent()
+	if err := ce.UnmarshalJSON(job.event); err != nil {
+		p.log.Error("dropping invalid job", "job", job.id, "error", err)
+		p.delete(ctx, job)
+		return
+	}
+
+	retried, _ := events.GetRetried(&ce)
+	maxRetries, _ := events.GetMaxRetries(&ce)
+	if job.attempts > maxRetries+1 {
+		p.log.Error("dropping job whose lease expired too many times", "kind", ce.Type(), "id", ce.ID())
+		p.delete(ctx, job)
+		return
+	}
+
+	events.SetRetried(&ce, retried)
+	events.SetScheduled(&ce, false)
+	events.SetQstashMessageID(&ce, fmt.Sprintf("sqlite-%d", job.id))
+
+	stop := p.keepLeased(ctx, job)
+	handleErr := p.handler.HandleEvent(ctx, ce)
+	stop()
+
+	switch {
+	case handleErr == nil:
+		p.log.Debug("job handled", "kind", ce.Type(), "id", ce.ID())
+		p.delete(ctx, job)
+	case rejected(handleErr):
+		p.log.Info("job rejected, delivering again later", "kind", ce.Type(), "id", ce.ID(), "error", handleErr)
+		runAt := time.Now().Add(rejectedDelay)
+		_, err := db.ExecContext(ctx,
+			`UPDATE uptask_jobs SET run_at = ?, attempts = attempts - 1, locked_until = 0 WHERE id = ?`,
+			runAt.UnixMilli(), job.id,
+		)
+		if err != nil {
+			p.log.Error("failed to reschedule job", "kind", ce.Type(), "id", ce.ID(), "error", err)
+		}
+	case retried < maxRetries:
+		p.log.Warn("job failed, retrying", "kind", ce.Type(), "id", ce.ID(), "retried", retried, "maxRetries", maxRetries, "error", handleErr)
+		events.SetRetried(&ce, retried+1)
+		data, err := ce.MarshalJSON()
+		if err != nil {
+			p.log.Error("failed to marshal event", "kind", ce.Type(), "id", ce.ID(), "error", err)
+			return
+		}
+		runAt := time.Now().Add(p.backoff(retried))
+		_, err = db.ExecContext(ctx,
+			`UPDATE uptask_jobs SET event = ?, run_at = ?, attempts = 0, locked_until = 0 WHERE id = ?`,
+			data, runAt.UnixMilli(), job.id,
+		)
+		if err != nil {
+			p.log.Error("failed to reschedule job", "kind", ce.Type(), "id", ce.ID(), "error", err)
+		}
+	default:
+		p.log.Error("job failed, retries exhausted", "kind", ce.Type(), "id", ce.ID(), "retried", retried, "error", handleErr)
+		p.delete(ctx, job)
+	}
+}
+
+// keepLeased extends the lease of job until the returned function is called.
+func (p *SQLiteWorkerPool) keepLeased(ctx context.Context, job *sqliteJob) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(p.lease / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				lockedUntil := time.Now().Add(p.lease).UnixMilli()
+				_, err := p.transport.db.ExecContext(ctx, `UPDATE uptask_jobs SET locked_until = ? WHERE id = ?`, lockedUntil, job.id)
+				if err != nil {
+					p.log.Error("failed to extend job lease", "job", job.id, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (p *SQLiteWorkerPool) delete(ctx context.Context, job *sqliteJob) {
+	if _, err := p.transport.db.ExecContext(ctx, `DELETE FROM uptask_jobs WHERE id = ?`, job.id); err != nil {
+		p.log.Error("failed to delete job", "job", job.id, "error", err)
+	}
+}
+
+// CheckHealth pings the database.
+func (t *SQLiteTransport) CheckHealth(ctx context.Context) error {
+	if err := t.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package uptask
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slowTask struct {
+	Snooze bool
+}
+
+func (slowTask) Kind() string { return "SlowTask" }
+
+// slowTaskProcessor records how many tasks run concurrently.
+type slowTaskProcessor struct {
+	TaskHandlerDefaults[slowTask]
+	running  atomic.Int32
+	peak     atomic.Int32
+	done     atomic.Int32
+	snoozed  sync.Map
+	duration time.Duration
+}
+
+func (p *slowTaskProcessor) ProcessTask(ctx context.Context, task *Container[slowTask]) error {
+	if task.Args.Snooze {
+		if _, ok := p.snoozed.LoadOrStore(task.Id, true); !ok {
+			return JobSnooze(50 * time.Millisecond)
+		}
+	}
+	running := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if running <= peak || p.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	time.Sleep(p.duration)
+	p.done.Add(1)
+	return nil
+}
+
+func jobCount(t *testing.T, transport *SQLiteTransport) int {
+	var n int
+	require.NoError(t, transport.db.QueryRow(`SELECT COUNT(*) FROM uptask_jobs`).Scan(&n))
+	return n
+}
+
+func TestSQLiteTransport(t *testing.T) {
+	transport, err := NewSQLiteTransport(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer transport.Close()
+
+	tsvc := NewTaskService(transport)
+	processor := &DummyTaskProcessor{}
+	AddTaskHandler(tsvc, processor)
+	slow := &slowTaskProcessor{duration: 50 * time.Millisecond}
+	AddTaskHandler(tsvc, slow)
+
+	pool := NewSQLiteWorkerPool(transport, tsvc,
+		WithSQLiteQueue("default", 2),
+		WithSQLiteQueue("serial", 1),
+		WithSQLitePollInterval(10*time.Millisecond),
+		WithSQLiteLease(200*time.Millisecond),
+		WithSQLiteBackoff(func(int) time.Duration { return 10 * time.Millisecond }),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- pool.Run(ctx) }()
+	defer func() {
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	t.Run("handles jobs", func(t *testing.T) {
+		resetTasks(processor)
+		id, err := tsvc.StartTask(ctx, DummyTask{Name: "now"}, nil)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, id, completedTasks(processor)[0].Id)
+		require.Eventually(t, func() bool { return jobCount(t, transport) == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("retries failed jobs", func(t *testing.T) {
+		resetTasks(processor)
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "flaky", FailFirst: true}, nil)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 1, completedTasks(processor)[0].Retried)
+	})
+
+	t.Run("delays scheduled jobs", func(t *testing.T) {
+		resetTasks(processor)
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "later"}, &InsertOpts{ScheduledAt: time.Now().Add(200 * time.Millisecond)})
+		require.NoError(t, err)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Empty(t, completedTasks(processor))
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("limits concurrency per queue", func(t *testing.T) {
+		slow.peak.Store(0)
+		slow.done.Store(0)
+		for i := 0; i < 4; i++ {
+			_, err := tsvc.StartTask(ctx, slowTask{}, &InsertOpts{Queue: "serial"})
+			require.NoError(t, err)
+		}
+		require.Eventually(t, func() bool { return slow.done.Load() == 4 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(1), slow.peak.Load())
+
+		slow.peak.Store(0)
+		slow.done.Store(0)
+		for i := 0; i < 4; i++ {
+			_, err := tsvc.StartTask(ctx, slowTask{}, nil)
+			require.NoError(t, err)
+		}
+		require.Eventually(t, func() bool { return slow.done.Load() == 4 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(2), slow.peak.Load())
+	})
+
+	t.Run("snoozes jobs", func(t *testing.T) {
+		slow.done.Store(0)
+		_, err := tsvc.StartTask(ctx, slowTask{Snooze: true}, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return slow.done.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+		require.Eventually(t, func() bool { return jobCount(t, transport) == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("picks up jobs whose lease expired", func(t *testing.T) {
+		resetTasks(processor)
+		_, err := tsvc.StartTask(ctx, DummyTask{Name: "orphan"}, &InsertOpts{ScheduledAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		// Simulate a worker that claimed the job and crashed.
+		_, err = transport.db.Exec(`UPDATE uptask_jobs SET run_at = 0, attempts = 1, locked_until = ?`, time.Now().Add(100*time.Millisecond).UnixMilli())
+		require.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, completedTasks(processor))
+		require.Eventually(t, func() bool { return len(completedTasks(processor)) == 1 }, 2*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestSQLiteTransportRequeuesRejectedJobs(t *testing.T) {
+	transport, err := NewSQLiteTransport(filepath.Join(t.TempDir(), "jobs.db"))
+	require.NoError(t, err)
+	defer transport.Close()
+
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	tsvc := NewTaskService(transport)
+	AddTaskHandler(tsvc, handler)
+	pool := NewSQLiteWorkerPool(transport, tsvc,
+		WithSQLiteQueue("default", 2),
+		WithSQLitePollInterval(10*time.Millisecond),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- pool.Run(ctx) }()
+	var release sync.Once
+	defer func() {
+		release.Do(func() { close(handler.release) })
+		cancel()
+		require.NoError(t, <-done)
+	}()
+
+	_, err = tsvc.StartTask(ctx, blockingArgs{}, nil)
+	require.NoError(t, err)
+	<-handler.started
+	drained := make(chan error)
+	go func() { drained <- tsvc.Shutdown(ctx) }()
+	require.Eventually(t, tsvc.Draining, time.Second, time.Millisecond)
+
+	// Picked up while the service drains
+	rejectedID, err := tsvc.StartTask(ctx, blockingArgs{}, nil)
+	require.NoError(t, err)
+	requeued := func() bool {
+		var n int
+		err := transport.db.QueryRow(`SELECT COUNT(*) FROM uptask_jobs WHERE run_at > ? AND attempts = 0`, time.Now().UnixMilli()).Scan(&n)
+		return err == nil && n == 1
+	}
+	require.Eventually(t, requeued, time.Second, 10*time.Millisecond)
+
+	release.Do(func() { close(handler.release) })
+	require.NoError(t, <-drained)
+	require.Eventually(t, func() bool { return jobCount(t, transport) == 1 }, time.Second, 10*time.Millisecond)
+
+	var (
+		event    string
+		attempts int
+	)
+	require.NoError(t, transport.db.QueryRow(`SELECT event, attempts FROM uptask_jobs`).Scan(&event, &attempts))
+	assert.Equal(t, 0, attempts)
+	ce := cloudevents.NewEvent()
+	require.NoError(t, ce.UnmarshalJSON([]byte(event)))
+	assert.Equal(t, rejectedID, ce.ID())
+	retried, _ := events.GetRetried(&ce)
+	assert.Equal(t, 0, retried)
+}
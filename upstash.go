@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/url"
 	"strings"
 	"time"
 
@@ -162,16 +163,25 @@ func (c *UpstashTransport) Send(ctx context.Context, ce v2.Event, opts *InsertOp
 		taskPath = fmt.Sprintf("/events/%s/%s", parts[0], parts[1])
 	}
 
-	targetUrl := fmt.Sprintf("%s/%s%s", upstashBaseUrl, c.targetUrl, taskPath)
+	destination := c.targetUrl
+	if opts.targetUrl != "" {
+		destination = strings.TrimRight(opts.targetUrl, "/")
+	}
+
+	targetUrl := fmt.Sprintf("%s/%s%s", upstashBaseUrl, destination, taskPath)
 	var headers = []string{
 		"Authorization", fmt.Sprintf("Bearer %s", c.qstashToken),
 	}
 	if opts.Queue != "" && opts.Queue != "default" {
-		targetUrl = fmt.Sprintf("%s/%s/%s%s", upstashQueueUrl, opts.Queue, c.targetUrl, taskPath)
+		targetUrl = fmt.Sprintf("%s/%s/%s%s", upstashQueueUrl, opts.Queue, destination, taskPath)
 	}
 	if c.dlq != "" {
 		headers = append(headers, "Upstash-Failure-Callback", fmt.Sprintf("%s%s", c.dlq, taskPath))
 	}
+	if opts.id != "" {
+		// Let QStash drop the message if a retried fan-out task enqueues it again.
+		headers = append(headers, "Upstash-Deduplication-Id", opts.id)
+	}
 	c.logger.Debug("Sending event", "url", targetUrl, "dlq", c.dlq, "headers", headers)
 	transportFn := newHttpTransport(targetUrl, headers...)
 	return transportFn.Send(ctx, ce, opts)
@@ -269,3 +279,19 @@ func newHttpTransport(targetUrl string, headers ...string) Transport {
 		}
 	})
 }
+
+// CheckHealth validates the configuration of the transport. It does not call QStash.
+func (c *UpstashTransport) CheckHealth(ctx context.Context) error {
+	if c.qstashToken == "" {
+		return fmt.Errorf("missing QStash token")
+	}
+	for name, rawURL := range map[string]string{"target": c.targetUrl, "dlq": c.dlq} {
+		if rawURL == "" {
+			continue
+		}
+		if u, err := url.Parse(rawURL); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid %s URL: %s", name, rawURL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package uptaskhttp
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/mscno/uptask"
+)
+
+//go:embed dashboard
+var dashboardFS embed.FS
+
+var dashboardIndex = template.Must(template.ParseFS(dashboardFS, "dashboard/index.html"))
+
+type dashboardConfig struct {
+	path  string
+	kinds KindLister
+}
+
+type DashboardOption func(*dashboardConfig)
+
+// WithDashboardPath sets the path the dashboard is mounted on, such as /dashboard.
+// Defaults to the root path.
+func WithDashboardPath(path string) DashboardOption {
+	return func(c *dashboardConfig) {
+		c.path = path
+	}
+}
+
+// WithDashboardKinds lists the kinds of kinds, usually the TaskService, in the
+// dashboard's kind filter.
+func WithDashboardKinds(kinds KindLister) DashboardOption {
+	return func(c *dashboardConfig) {
+		c.kinds = kinds
+	}
+}
+
+// Dashboard returns a handler serving a web UI over the tasks of store, which client
+// retries and cancels. The UI lists tasks by status, shows their args, errors and
+// attempts, and refreshes live if store implements uptask.Watcher, or every few
+// seconds otherwise. Its JSON endpoints are those of TaskApi, under api/, and the UI
+// sends the RequestHeader they require to change tasks.
+//
+// The handler expects the full request path, so mount it at its configured path:
+//
+//	mux.Handle("/dashboard/", uptaskhttp.Dashboard(store, client, uptaskhttp.WithDashboardPath("/dashboard")))
+func Dashboard(store uptask.TaskStore, client *uptask.TaskClient, opts ...DashboardOption) http.Handler {
+	cfg := &dashboardConfig{path: "/"}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	prefix := "/" + strings.Trim(cfg.path, "/")
+	base := strings.TrimSuffix(prefix, "/") + "/"
+
+	var apiOpts []TaskApiOption
+	if cfg.kinds != nil {
+		apiOpts = append(apiOpts, WithKinds(cfg.kinds))
+	}
+	api := NewTaskApi(client, store, apiOpts...)
+	watcher, live := store.(uptask.Watcher)
+
+	assets, err := fs.Sub(dashboardFS, "dashboard/assets")
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", api.Handler()))
+	if live {
+		mux.HandleFunc("GET /api/changes", handleTaskChanges(watcher, cfg.kinds))
+	}
+	mux.Handle("GET /assets/", http.StripPrefix("/assets", http.FileServerFS(assets)))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := dashboardIndex.Execute(w, struct {
+			Base  string
+			Live  bool
+			Kinds bool
+		}{base, live, cfg.kinds != nil})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	handler := http.StripPrefix(strings.TrimSuffix(prefix, "/"), mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The index is served under the trailing slash
+		if r.URL.Path == prefix && prefix != "/" {
+			http.Redirect(w, r, base, http.StatusMovedPermanently)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
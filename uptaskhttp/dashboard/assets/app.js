@@ -0,0 +1,321 @@
+"use strict";
+
+(function () {
+	const body = document.body;
+	const base = body.dataset.base;
+	const api = base + "api/";
+	const live = body.dataset.live === "true";
+	const pageSize = 50;
+	const statuses = ["ALL", "PENDING", "RUNNING", "SUCCESS", "FAILED", "CANCELLED"];
+
+	const state = {
+		status: "ALL",
+		cursors: [""], // Cursor of every page up to the current one
+		tasks: [],
+		nextCursor: "",
+		counts: {},
+		active: null, // ID of the task shown in the detail view
+	};
+
+	const $ = (id) => document.getElementById(id);
+
+	function el(tag, props, ...children) {
+		const node = document.createElement(tag);
+		Object.assign(node, props || {});
+		for (const child of children) {
+			node.append(child instanceof Node ? child : String(child ?? ""));
+		}
+		return node;
+	}
+
+	async function request(method, path) {
+		// The API rejects changes without X-Uptask-Request, which other origins cannot set
+		const headers = { Accept: "application/json", "X-Uptask-Request": "1" };
+		const resp = await fetch(api + path, { method, headers });
+		if (resp.status === 204) {
+			return null;
+		}
+		const data = await resp.json();
+		if (!resp.ok) {
+			throw new Error(data.error ? data.error.message : resp.statusText);
+		}
+		return data;
+	}
+
+	function showMessage(text, isError) {
+		const message = $("message");
+		message.textContent = text;
+		message.className = isError ? "error" : "";
+		message.hidden = !text;
+	}
+
+	// Zero Go times are serialized as year 1
+	function isZero(value) {
+		return !value || value.startsWith("0001-");
+	}
+
+	function formatTime(value) {
+		return isZero(value) ? "-" : new Date(value).toLocaleString();
+	}
+
+	function formatDuration(ns) {
+		const ms = ns / 1e6;
+		return ms < 1000 ? Math.round(ms) + "ms" : (ms / 1000).toFixed(1) + "s";
+	}
+
+	function statusBadge(status) {
+		return el("span", { className: "status status-" + status.toLowerCase() }, status);
+	}
+
+	function renderTabs() {
+		const tabs = $("tabs");
+		tabs.replaceChildren();
+		for (const status of statuses) {
+			const count = status === "ALL"
+				? Object.values(state.counts).reduce((a, b) => a + b, 0)
+				: state.counts[status] || 0;
+			const label = Object.keys(state.counts).length ? status + " (" + count + ")" : status;
+			const tab = el("button", { type: "button", className: status === state.status ? "active" : "" }, label);
+			tab.addEventListener("click", () => {
+				state.status = status;
+				state.cursors = [""];
+				closeDetail();
+				refresh();
+			});
+			tabs.append(tab);
+		}
+	}
+
+	function renderTasks() {
+		const rows = state.tasks.map((task) => {
+			const row = el("tr", {},
+				el("td", { className: "mono" }, task.id),
+				el("td", {}, task.task_kind),
+				el("td", {}, statusBadge(task.status)),
+				el("td", {}, task.retried + "/" + task.max_retries),
+				el("td", {}, task.queue || "-"),
+				el("td", {}, (task.tags || []).join(", ")),
+				el("td", {}, formatTime(task.created_at)),
+				el("td", {}, formatTime(task.scheduled_at)),
+			);
+			row.addEventListener("click", () => openDetail(task.id));
+			return row;
+		});
+		if (!rows.length) {
+			rows.push(el("tr", {}, el("td", { colSpan: 8, className: "empty" }, "No tasks")));
+		}
+		$("tasks").replaceChildren(...rows);
+		$("page").textContent = "Page " + state.cursors.length;
+		$("prev").disabled = state.cursors.length === 1;
+		$("next").disabled = !state.nextCursor;
+	}
+
+	async function loadTasks() {
+		const params = new URLSearchParams({ limit: pageSize });
+		if (state.status !== "ALL") {
+			params.set("status", state.status);
+		}
+		for (const name of ["kind", "queue", "tag"]) {
+			const value = $(name).value.trim();
+			if (value) {
+				params.set(name, value);
+			}
+		}
+		const cursor = state.cursors[state.cursors.length - 1];
+		if (cursor) {
+			params.set("cursor", cursor);
+		}
+		const data = await request("GET", "tasks?" + params);
+		state.tasks = data.tasks || [];
+		state.nextCursor = data.next_cursor || "";
+		renderTasks();
+	}
+
+	async function loadStats() {
+		let stats;
+		try {
+			stats = await request("GET", "stats");
+		} catch (err) {
+			return; // The store does not keep statistics
+		}
+		state.counts = stats.by_status || {};
+		renderTabs();
+		const rate = (stats.success_rate * 100).toFixed(1);
+		$("summary").textContent = "Last 24h: " + stats.succeeded + " succeeded, " + stats.failed +
+			" failed (" + rate + "% success), p95 duration " + formatDuration(stats.duration.p95);
+	}
+
+	async function loadKinds() {
+		if (body.dataset.kinds !== "true") {
+			return;
+		}
+		const data = await request("GET", "kinds");
+		for (const kind of data.kinds) {
+			$("kind").append(el("option", { value: kind.kind }, kind.kind));
+		}
+	}
+
+	function field(name, value) {
+		return [el("dt", {}, name), el("dd", {}, value)];
+	}
+
+	function renderDetail(task) {
+		$("fields").replaceChildren(
+			...field("ID", task.id),
+			...field("Kind", task.task_kind),
+			...field("Status", statusBadge(task.status)),
+			...field("Retries", task.retried + "/" + task.max_retries),
+			...field("Queue", task.queue || "-"),
+			...field("Tags", (task.tags || []).join(", ") || "-"),
+			...field("Parent", task.parent_id || "-"),
+			...field("Schedule", task.schedule_id || "-"),
+			...field("Created", formatTime(task.created_at)),
+			...field("Scheduled", formatTime(task.scheduled_at)),
+			...field("Attempted", formatTime(task.attempted_at)),
+			...field("Finalized", formatTime(task.finalized_at)),
+			...(task.dead_letter ? field("Dead letter", "status " + task.dead_letter.response_status + " after " +
+				task.dead_letter.retried + " retries: " + (task.dead_letter.response_body || "-")) : []),
+		);
+		$("args").textContent = JSON.stringify(task.args, null, 2);
+
+		const errors = (task.errors || []).map((err) => el("div", { className: "task-error" },
+			el("div", { className: "muted" }, formatTime(err.timestamp)),
+			el("pre", {}, err.message),
+			err.details ? el("pre", { className: "muted" }, JSON.stringify(err.details, null, 2)) : "",
+		));
+		$("errors").replaceChildren(...(errors.length ? errors : [el("p", { className: "muted" }, "No errors")]));
+
+		const attempts = (task.attempts || []).map((attempt) => el("tr", {},
+			el("td", {}, attempt.attempt),
+			el("td", {}, statusBadge(attempt.status)),
+			el("td", {}, formatTime(attempt.started_at)),
+			el("td", {}, formatTime(attempt.finished_at)),
+		));
+		$("attempts").replaceChildren(attempts.length
+			? el("table", {},
+				el("thead", {}, el("tr", {}, el("th", {}, "#"), el("th", {}, "Status"), el("th", {}, "Started"), el("th", {}, "Finished"))),
+				el("tbody", {}, ...attempts))
+			: el("p", { className: "muted" }, "No attempts recorded"));
+
+		$("retry").hidden = task.status !== "FAILED" && task.status !== "CANCELLED";
+		$("cancel").hidden = task.status !== "PENDING";
+		$("replay").hidden = !task.dead_letter;
+	}
+
+	async function loadDetail() {
+		if (!state.active) {
+			return;
+		}
+		try {
+			renderDetail(await request("GET", "tasks/" + encodeURIComponent(state.active)));
+		} catch (err) {
+			showMessage(err.message, true);
+		}
+	}
+
+	function openDetail(id) {
+		state.active = id;
+		showMessage("");
+		$("list").hidden = true;
+		$("detail").hidden = false;
+		loadDetail();
+	}
+
+	function closeDetail() {
+		state.active = null;
+		$("detail").hidden = true;
+		$("list").hidden = false;
+	}
+
+	async function refresh() {
+		try {
+			await Promise.all([loadTasks(), loadStats(), loadDetail()]);
+		} catch (err) {
+			showMessage(err.message, true);
+		}
+	}
+
+	// Refreshes once for bursts of changes
+	let pending = null;
+	function scheduleRefresh() {
+		if (pending === null) {
+			pending = setTimeout(() => {
+				pending = null;
+				refresh();
+			}, 250);
+		}
+	}
+
+	function watch() {
+		if (!live) {
+			$("live").textContent = "Refreshing every 5s";
+			setInterval(refresh, 5000);
+			return;
+		}
+		const source = new EventSource(api + "changes");
+		source.addEventListener("open", () => {
+			$("live").textContent = "Live";
+			$("live").className = "live";
+		});
+		source.addEventListener("error", () => {
+			$("live").textContent = "Reconnecting…";
+			$("live").className = "";
+		});
+		source.addEventListener("change", scheduleRefresh);
+	}
+
+	$("prev").addEventListener("click", () => {
+		if (state.cursors.length > 1) {
+			state.cursors.pop();
+			refresh();
+		}
+	});
+	$("next").addEventListener("click", () => {
+		if (state.nextCursor) {
+			state.cursors.push(state.nextCursor);
+			refresh();
+		}
+	});
+	$("filters").addEventListener("change", () => {
+		state.cursors = [""];
+		refresh();
+	});
+	$("filters").addEventListener("submit", (event) => event.preventDefault());
+	$("back").addEventListener("click", () => {
+		closeDetail();
+		refresh();
+	});
+	$("retry").addEventListener("click", async () => {
+		try {
+			const data = await request("POST", "tasks/" + encodeURIComponent(state.active) + "/retry");
+			openDetail(data.ids[0]);
+			showMessage("Retried as " + data.ids[0]);
+		} catch (err) {
+			showMessage(err.message, true);
+		}
+	});
+	$("replay").addEventListener("click", async () => {
+		try {
+			renderDetail(await request("POST", "tasks/" + encodeURIComponent(state.active) + "/replay"));
+			showMessage("Task replayed");
+		} catch (err) {
+			showMessage(err.message, true);
+		}
+	});
+	$("cancel").addEventListener("click", async () => {
+		if (!confirm("Cancel this task?")) {
+			return;
+		}
+		try {
+			renderDetail(await request("POST", "tasks/" + encodeURIComponent(state.active) + "/cancel"));
+			showMessage("Task cancelled");
+		} catch (err) {
+			showMessage(err.message, true);
+		}
+	});
+
+	renderTabs();
+	loadKinds().catch((err) => showMessage(err.message, true));
+	refresh();
+	watch();
+})();
@@ -0,0 +1,88 @@
+package uptaskhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+)
+
+// pollingStore hides the uptask.Watcher implementation of the store it wraps.
+type pollingStore struct {
+	uptask.TaskStore
+}
+
+func serveDashboard(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDashboard(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	client := uptask.NewTaskClient(nopTransport{}, uptask.WithClientStore(store))
+	dashboard := Dashboard(store, client, WithDashboardPath("/dashboard/"))
+
+	rec := serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/dashboard/", rec.Header().Get("Location"))
+
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, `<body data-base="/dashboard/" data-live="true" data-kinds="false">`)
+	assert.Contains(t, body, `href="/dashboard/assets/style.css"`)
+	assert.Contains(t, body, `src="/dashboard/assets/app.js"`)
+
+	for path, contentType := range map[string]string{
+		"/dashboard/assets/app.js":    "text/javascript; charset=utf-8",
+		"/dashboard/assets/style.css": "text/css; charset=utf-8",
+	} {
+		rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, contentType, rec.Header().Get("Content-Type"), path)
+		assert.NotEmpty(t, rec.Body.String(), path)
+	}
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/assets/missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/api/tasks", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tasks": []}`, rec.Body.String())
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/api/tasks/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Changes require the header set by app.js, which forged cross-site posts lack
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodPost, "/dashboard/api/tasks/retry", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	req := httptest.NewRequest(http.MethodPost, "/dashboard/api/tasks/retry", nil)
+	req.Header.Set(RequestHeader, "1")
+	rec = serveDashboard(dashboard, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	// The change stream ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/api/changes", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+}
+
+func TestDashboardWithoutWatcher(t *testing.T) {
+	store := pollingStore{uptask.NewMemoryTaskStore()}
+	tsvc := uptask.NewTaskService(nopTransport{}, uptask.WithStore(store))
+	dashboard := Dashboard(store, uptask.NewTaskClient(nopTransport{}, uptask.WithClientStore(store)), WithDashboardKinds(tsvc))
+
+	rec := serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<body data-base="/" data-live="false" data-kinds="true">`)
+
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/api/changes", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serveDashboard(dashboard, httptest.NewRequest(http.MethodGet, "/api/kinds", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,77 @@
+package uptaskhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mscno/uptask"
+)
+
+// changesHeartbeat is the interval of the comments keeping idle change streams open
+// through proxies.
+const changesHeartbeat = 15 * time.Second
+
+// HandleTaskChanges streams the changes of the executions in watcher as server-sent
+// events named change, with the JSON encoded uptask.TaskChange as data. The changes
+// are filtered by the query parameters of TaskApi.ListTasks, except limit and cursor.
+// Changes are not replayed on reconnection.
+func HandleTaskChanges(watcher uptask.Watcher) http.HandlerFunc {
+	return handleTaskChanges(watcher, nil)
+}
+
+// handleTaskChanges streams the changes of watcher, resolving the kind filter and the
+// kinds of the changed tasks with kinds, see parseTaskFilter.
+func handleTaskChanges(watcher uptask.Watcher, kinds KindLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "internal", "streaming not supported")
+			return
+		}
+
+		filter, err := parseTaskFilter(r, kinds)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		changes := watcher.Watch(r.Context(), filter)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(changesHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+				if kinds != nil {
+					// The task is shared with the other watchers
+					task := *change.Task
+					canonicalKinds(kinds, &task)
+					change.Task = &task
+				}
+				data, err := json.Marshal(change)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: change\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
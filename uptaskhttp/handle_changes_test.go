@@ -0,0 +1,68 @@
+package uptaskhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTaskChanges(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	returned := make(chan struct{})
+	handler := HandleTaskChanges(store)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(returned)
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?status=FAILED&kind=Greet", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The watch is started before the headers are sent, so no change is missed
+	createTasks(t, store, map[string]uptask.TaskStatus{"pending": uptask.TaskStatusPending})
+	require.NoError(t, store.CreateTaskExecution(ctx, &uptask.TaskExecution{ID: "other", TaskKind: "Other", Status: uptask.TaskStatusFailed}))
+	createTasks(t, store, map[string]uptask.TaskStatus{"failed": uptask.TaskStatusFailed})
+
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, "event: change", lines.Text())
+	require.True(t, lines.Scan())
+	data, ok := strings.CutPrefix(lines.Text(), "data: ")
+	require.True(t, ok, lines.Text())
+	var change uptask.TaskChange
+	require.NoError(t, json.Unmarshal([]byte(data), &change))
+	assert.Equal(t, "failed", change.TaskID)
+	assert.Equal(t, uptask.TaskStatusFailed, change.Status)
+	require.True(t, lines.Scan())
+	assert.Empty(t, lines.Text())
+
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return after the client disconnected")
+	}
+}
+
+func TestHandleTaskChangesInvalidFilter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	HandleTaskChanges(uptask.NewMemoryTaskStore())(rec, httptest.NewRequest(http.MethodGet, "/?status=DONE", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
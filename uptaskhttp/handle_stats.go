@@ -0,0 +1,49 @@
+package uptaskhttp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mscno/uptask"
+)
+
+// HandleStats serves the statistics of store as JSON. The time range and bucket size
+// are read from the optional query parameters from and to, in RFC 3339, and bucket, a
+// Go duration such as 15m. A range spanning more than uptask.MaxStatsBuckets buckets
+// is rejected.
+func HandleStats(store uptask.StatsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var query uptask.StatsQuery
+		var err error
+		params := r.URL.Query()
+		if from := params.Get("from"); from != "" {
+			if query.FromDate, err = time.Parse(time.RFC3339, from); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_request", "invalid from")
+				return
+			}
+		}
+		if to := params.Get("to"); to != "" {
+			if query.ToDate, err = time.Parse(time.RFC3339, to); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_request", "invalid to")
+				return
+			}
+		}
+		if bucket := params.Get("bucket"); bucket != "" {
+			if query.BucketSize, err = time.ParseDuration(bucket); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_request", "invalid bucket")
+				return
+			}
+		}
+
+		stats, err := store.Stats(r.Context(), query)
+		if errors.Is(err, uptask.ErrInvalidStatsQuery) {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal", "failed to get stats")
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
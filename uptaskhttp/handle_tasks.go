@@ -2,58 +2,37 @@ package uptaskhttp
 
 import (
 	"context"
-	"fmt"
-	cloudevents "github.com/cloudevents/sdk-go/v2"
-	"github.com/mscno/uptask/internal/httputil"
-	"log/slog"
 	"net/http"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
 )
 
 type CloudEventHandler interface {
 	HandleEvent(ctx context.Context, event cloudevents.Event) error
 }
 
-func HandleTasks(service CloudEventHandler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		ce, err := httputil.NewEventFromHTTPRequest(r)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		err = service.HandleEvent(r.Context(), ce)
-		if err != nil {
-			slog.Error(err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-	}
+// HandleTasks handles every task event posted to it, whatever the path. Prefer
+// NewRouter, which also checks that the path matches the event.
+//
+// Responses tell QStash whether to deliver the task again: handled tasks and tasks
+// snoozed for a duration are acknowledged with 200, and tasks that used all their
+// retries or have no registered handler with 489 and the Upstash-NonRetryable-Error
+// header. Other failures return 500, and tasks rejected during shutdown or overload
+// 503 or 429 with Retry-After. Error responses have application/problem+json bodies,
+// without internal errors unless WithErrorDetails is set.
+func HandleTasks(service CloudEventHandler, opts ...HandlerOption) http.HandlerFunc {
+	return handleEvent(service, nil, newHandlerConfig(opts))
 }
 
+// DlqStorer stores the task events QStash moved to its dead letter queue, along with
+// its failure callback. uptask.DlqStore stores them in a TaskStore.
 type DlqStorer interface {
-	StoreDlqEvent(ce cloudevents.Event) error
+	StoreDlqEvent(ctx context.Context, ce cloudevents.Event, letter uptask.DeadLetter) error
 }
 
-func HandleDlq(store DlqStorer) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		fmt.Printf("Handling Dlq event: %s\n", r.URL.Path)
-
-		ce, err := httputil.NewDlqEventFromHTTPRequest(r)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		err = store.StoreDlqEvent(ce)
-		if err != nil {
-			slog.Error(err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-		}
-		w.WriteHeader(http.StatusOK)
-	}
+// HandleDlq stores the failure callbacks of QStash in store. Prefer NewRouter with
+// WithRouterDlq, which also checks that the path matches the event.
+func HandleDlq(store DlqStorer, opts ...HandlerOption) http.HandlerFunc {
+	return handleDlq(store, nil, newHandlerConfig(opts))
 }
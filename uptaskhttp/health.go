@@ -0,0 +1,55 @@
+package uptaskhttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mscno/uptask"
+)
+
+type healthConfig struct {
+	timeout time.Duration
+}
+
+type HealthOption func(*healthConfig)
+
+// WithHealthTimeout bounds the time the readiness checks may take. Defaults to 5
+// seconds.
+func WithHealthTimeout(d time.Duration) HealthOption {
+	return func(c *healthConfig) {
+		c.timeout = d
+	}
+}
+
+// Health returns the liveness and readiness probes of service, relative to the path
+// it is mounted on:
+//
+//	GET /livez   200 as long as the process serves requests
+//	GET /readyz  200 when ready and 503 otherwise, see uptask.TaskService.CheckReadiness
+//
+// Readiness responds with the checks, draining state and registered kinds of the
+// service as JSON. Once Shutdown was called readiness fails, so that the instance stops
+// receiving traffic while it drains.
+func Health(service *uptask.TaskService, opts ...HealthOption) http.Handler {
+	cfg := &healthConfig{timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.timeout)
+		defer cancel()
+		readiness := service.CheckReadiness(ctx)
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, readiness)
+	})
+	return mux
+}
@@ -0,0 +1,78 @@
+package uptaskhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	var (
+		checkErr error
+		deadline time.Time
+	)
+	check := uptask.HealthCheckFunc(func(ctx context.Context) error {
+		deadline, _ = ctx.Deadline()
+		return checkErr
+	})
+	tsvc := uptask.NewTaskService(nopTransport{},
+		uptask.WithStore(uptask.NewMemoryTaskStore()),
+		uptask.WithHealthCheck("db", check),
+	)
+	uptask.AddTaskHandler(tsvc, &greetHandler{})
+	health := Health(tsvc, WithHealthTimeout(time.Minute))
+
+	serve := func(path string) (*httptest.ResponseRecorder, uptask.Readiness) {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var readiness uptask.Readiness
+		if path == "/readyz" {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&readiness))
+		}
+		return rec, readiness
+	}
+
+	rec, _ := serve("/livez")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+
+	rec, readiness := serve("/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, readiness.Ready)
+	assert.False(t, readiness.Draining)
+	assert.Equal(t, map[string]string{"store": "ok", "db": "ok"}, readiness.Checks)
+	require.Len(t, readiness.Kinds, 2)
+	assert.Equal(t, "Greet", readiness.Kinds[0].Kind)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 10*time.Second)
+
+	checkErr = errors.New("connection refused")
+	rec, readiness = serve("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.False(t, readiness.Ready)
+	assert.Equal(t, "connection refused", readiness.Checks["db"])
+
+	checkErr = nil
+	require.NoError(t, tsvc.Shutdown(context.Background()))
+	rec, readiness = serve("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.False(t, readiness.Ready)
+	assert.True(t, readiness.Draining)
+	assert.Equal(t, "ok", readiness.Checks["db"])
+
+	// The process stays alive while it drains
+	rec, _ = serve("/livez")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	health.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
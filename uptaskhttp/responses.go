@@ -0,0 +1,111 @@
+package uptaskhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mscno/uptask"
+)
+
+// StatusNonRetryable is the status QStash does not retry when the response also sets
+// the Upstash-NonRetryable-Error header.
+const StatusNonRetryable = 489
+
+type handlerConfig struct {
+	errorDetails bool
+	retryAfter   time.Duration
+}
+
+type HandlerOption func(*handlerConfig)
+
+// WithErrorDetails includes the errors of failed tasks in responses, where QStash logs
+// them. By default responses only describe the outcome, and errors are logged.
+func WithErrorDetails() HandlerOption {
+	return func(c *handlerConfig) {
+		c.errorDetails = true
+	}
+}
+
+// WithRetryAfter sets the Retry-After of tasks rejected while the service shuts down
+// or is overloaded. Defaults to 10 seconds.
+func WithRetryAfter(d time.Duration) HandlerOption {
+	return func(c *handlerConfig) {
+		c.retryAfter = d
+	}
+}
+
+func newHandlerConfig(opts []HandlerOption) *handlerConfig {
+	cfg := &handlerConfig{retryAfter: 10 * time.Second}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// problem is an RFC 9457 problem details body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, title, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{Type: "about:blank", Title: title, Status: status, Detail: detail})
+}
+
+// writeBadRequest rejects a request that cannot be handled as sent.
+func (c *handlerConfig) writeBadRequest(w http.ResponseWriter, err error) {
+	writeProblem(w, http.StatusBadRequest, "Invalid task request", err.Error())
+}
+
+// writeResult writes the response of handling a task with the returned err:
+//
+//   - 200 for handled and snoozed tasks
+//   - 503 or 429 with Retry-After while the service shuts down or is overloaded
+//   - 489 with Upstash-NonRetryable-Error for tasks that used all their retries and
+//     tasks without a registered handler
+//   - 500 for other failures, which QStash retries
+func (c *handlerConfig) writeResult(w http.ResponseWriter, err error) {
+	if err == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	retryAfter := strconv.Itoa(int(c.retryAfter.Round(time.Second) / time.Second))
+	switch {
+	case errors.Is(err, uptask.ErrServiceDraining):
+		w.Header().Set("Retry-After", retryAfter)
+		writeProblem(w, http.StatusServiceUnavailable, "Service shutting down", "")
+		return
+	case errors.Is(err, uptask.ErrServiceOverloaded):
+		w.Header().Set("Retry-After", retryAfter)
+		writeProblem(w, http.StatusTooManyRequests, "Service overloaded", "")
+		return
+	}
+
+	slog.Error(err.Error())
+	detail := ""
+	if c.errorDetails {
+		detail = err.Error()
+	}
+	var failed *uptask.TaskFailedError
+	switch {
+	case errors.As(err, &failed) && failed.Final:
+		w.Header().Set("Upstash-NonRetryable-Error", "true")
+		writeProblem(w, StatusNonRetryable, "Task failed permanently", detail)
+	case errors.Is(err, uptask.ErrNoHandler):
+		w.Header().Set("Upstash-NonRetryable-Error", "true")
+		writeProblem(w, StatusNonRetryable, "No handler registered", detail)
+	case errors.As(err, &failed):
+		writeProblem(w, http.StatusInternalServerError, "Task failed", detail)
+	default:
+		writeProblem(w, http.StatusInternalServerError, "Internal error", detail)
+	}
+}
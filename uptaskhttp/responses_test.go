@@ -0,0 +1,139 @@
+package uptaskhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type greetArgs struct {
+	Name string `json:"name"`
+}
+
+func (greetArgs) Kind() string { return "Greet" }
+
+// nopTransport drops the tasks sent to it.
+type nopTransport struct{}
+
+func (nopTransport) Send(ctx context.Context, ce cloudevents.Event, opts *uptask.InsertOpts) error {
+	return nil
+}
+
+// eventRequest returns a request posting args as a structured CloudEvent, as QStash
+// delivers tasks.
+func eventRequest(t *testing.T, path string, args uptask.TaskArgs) (*http.Request, cloudevents.Event) {
+	t.Helper()
+	ce, err := events.Serialize(context.Background(), args)
+	require.NoError(t, err)
+	body, err := json.Marshal(ce)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("Upstash-Message-Id", "msg-"+ce.ID())
+	return req, ce
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem {
+	t.Helper()
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var p problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	assert.Equal(t, rec.Code, p.Status)
+	return p
+}
+
+func TestWriteResult(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name         string
+		err          error
+		status       int
+		title        string
+		retryAfter   string
+		nonRetryable bool
+	}{
+		{name: "handled", status: http.StatusOK},
+		{name: "draining", err: uptask.ErrServiceDraining, status: http.StatusServiceUnavailable, title: "Service shutting down", retryAfter: "30"},
+		{name: "overloaded", err: uptask.ErrServiceOverloaded, status: http.StatusTooManyRequests, title: "Service overloaded", retryAfter: "30"},
+		{name: "final failure", err: &uptask.TaskFailedError{Final: true, Err: boom}, status: StatusNonRetryable, title: "Task failed permanently", nonRetryable: true},
+		{name: "failure", err: &uptask.TaskFailedError{Err: boom}, status: http.StatusInternalServerError, title: "Task failed"},
+		{name: "no handler", err: fmt.Errorf("%w: Greet", uptask.ErrNoHandler), status: StatusNonRetryable, title: "No handler registered", nonRetryable: true},
+		{name: "internal error", err: boom, status: http.StatusInternalServerError, title: "Internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, details := range []bool{false, true} {
+				opts := []HandlerOption{WithRetryAfter(30 * time.Second)}
+				if details {
+					opts = append(opts, WithErrorDetails())
+				}
+				rec := httptest.NewRecorder()
+				newHandlerConfig(opts).writeResult(rec, tt.err)
+
+				assert.Equal(t, tt.status, rec.Code)
+				assert.Equal(t, tt.retryAfter, rec.Header().Get("Retry-After"))
+				assert.Equal(t, tt.nonRetryable, rec.Header().Get("Upstash-NonRetryable-Error") == "true")
+				if tt.err == nil {
+					assert.Empty(t, rec.Body.String())
+					continue
+				}
+				p := decodeProblem(t, rec)
+				assert.Equal(t, "about:blank", p.Type)
+				assert.Equal(t, tt.title, p.Title)
+				if details && tt.retryAfter == "" {
+					assert.Equal(t, tt.err.Error(), p.Detail)
+				} else {
+					assert.Empty(t, p.Detail)
+				}
+			}
+		})
+	}
+}
+
+type snoozeHandler struct {
+	uptask.TaskHandlerDefaults[greetArgs]
+}
+
+func (h *snoozeHandler) ProcessTask(ctx context.Context, task *uptask.Container[greetArgs]) error {
+	return uptask.JobSnooze(time.Minute)
+}
+
+func TestHandleTasks(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	tsvc := uptask.NewTaskService(nopTransport{}, uptask.WithStore(store))
+	handler := HandleTasks(tsvc)
+
+	// No handler is registered for the kind yet
+	req, _ := eventRequest(t, "/", greetArgs{})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, StatusNonRetryable, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Upstash-NonRetryable-Error"))
+	assert.Equal(t, "No handler registered", decodeProblem(t, rec).Title)
+
+	uptask.AddTaskHandler(tsvc, &snoozeHandler{})
+	req, ce := eventRequest(t, "/", greetArgs{})
+	require.NoError(t, store.CreateTaskExecution(context.Background(), &uptask.TaskExecution{
+		ID: ce.ID(), TaskKind: ce.Type(), Status: uptask.TaskStatusPending,
+	}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "Invalid task request", decodeProblem(t, rec).Title)
+}
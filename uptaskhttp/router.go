@@ -0,0 +1,158 @@
+package uptaskhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/httputil"
+	"github.com/mscno/uptask/uptaskmw"
+)
+
+// upstashIssuer is the issuer of the signatures of QStash requests.
+const upstashIssuer = "Upstash"
+
+// DefaultDlqPath is the DLQ path of WithRouterDlq when it is given the root path.
+const DefaultDlqPath = "/dlq"
+
+type routerConfig struct {
+	verify      func(http.Handler) http.Handler
+	dlqPath     string
+	dlqStore    DlqStorer
+	handlerOpts []HandlerOption
+}
+
+type RouterOption func(*routerConfig)
+
+// WithSigningKeys verifies the QStash signature of every request with the current
+// signing key, or the next one while QStash rolls them.
+func WithSigningKeys(current, next string) RouterOption {
+	return func(c *routerConfig) {
+		c.verify = uptaskmw.VerifyMiddlewareWithConfig(uptaskmw.Config{
+			SigningKey:     current,
+			NextSigningKey: next,
+			Issuer:         upstashIssuer,
+		})
+	}
+}
+
+// WithRouterDlq stores the failure callbacks of QStash in store. path is the path of
+// the DLQ URL given to uptask.WithDlq, such as /dlq for https://example.com/dlq. As the
+// DLQ routes cannot share the task routes, an empty or root path uses DefaultDlqPath.
+func WithRouterDlq(path string, store DlqStorer) RouterOption {
+	return func(c *routerConfig) {
+		c.dlqPath = "/" + strings.Trim(path, "/")
+		if c.dlqPath == "/" {
+			c.dlqPath = DefaultDlqPath
+		}
+		c.dlqStore = store
+	}
+}
+
+// WithHandlerOptions configures the responses of the routes.
+func WithHandlerOptions(opts ...HandlerOption) RouterOption {
+	return func(c *routerConfig) {
+		c.handlerOpts = append(c.handlerOpts, opts...)
+	}
+}
+
+// NewRouter returns a handler serving the routes UpstashTransport sends tasks to,
+// relative to its target URL:
+//
+//	POST /tasks/{kind}
+//	POST /events/{handler}/{event}
+//
+// and, with WithRouterDlq, the same routes under the DLQ path. Requests whose event
+// type does not match their path are rejected with 400 Bad Request. See HandleTasks for
+// the responses.
+func NewRouter(service CloudEventHandler, opts ...RouterOption) http.Handler {
+	cfg := &routerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.Handler) {
+		if cfg.verify != nil {
+			handler = cfg.verify(handler)
+		}
+		mux.Handle(pattern, handler)
+	}
+
+	handlerCfg := newHandlerConfig(cfg.handlerOpts)
+	handle("POST /tasks/{kind}", handleEvent(service, taskKind, handlerCfg))
+	handle("POST /events/{handler}/{event...}", handleEvent(service, eventKind, handlerCfg))
+	if cfg.dlqStore != nil {
+		handle("POST "+cfg.dlqPath+"/tasks/{kind}", handleDlq(cfg.dlqStore, taskKind, handlerCfg))
+		handle("POST "+cfg.dlqPath+"/events/{handler}/{event...}", handleDlq(cfg.dlqStore, eventKind, handlerCfg))
+	}
+	return mux
+}
+
+// taskKind returns the task kind of a /tasks/{kind} request.
+func taskKind(r *http.Request) string {
+	return r.PathValue("kind")
+}
+
+// eventKind returns the task kind of a /events/{handler}/{event} request.
+func eventKind(r *http.Request) string {
+	return r.PathValue("handler") + "/" + r.PathValue("event")
+}
+
+// checkKind returns an error if the type of ce is not the kind of the request path.
+func checkKind(r *http.Request, ce cloudevents.Event, kindOf func(*http.Request) string) error {
+	if kindOf == nil {
+		return nil
+	}
+	if kind := kindOf(r); ce.Type() != kind {
+		return fmt.Errorf("event type %q does not match path kind %q", ce.Type(), kind)
+	}
+	return nil
+}
+
+// handleEvent handles the task events of service, checking their type with kindOf if
+// set.
+func handleEvent(service CloudEventHandler, kindOf func(*http.Request) string, cfg *handlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ce, err := httputil.NewEventFromHTTPRequest(r)
+		if err == nil {
+			err = checkKind(r, ce, kindOf)
+		}
+		if err != nil {
+			cfg.writeBadRequest(w, err)
+			return
+		}
+		cfg.writeResult(w, service.HandleEvent(r.Context(), ce))
+	}
+}
+
+// handleDlq stores the failure callbacks of QStash in store, checking their type with
+// kindOf if set.
+func handleDlq(store DlqStorer, kindOf func(*http.Request) string, cfg *handlerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ce, failure, err := httputil.NewDlqEventFromHTTPRequest(r)
+		if err == nil {
+			err = checkKind(r, ce, kindOf)
+		}
+		if err != nil {
+			cfg.writeBadRequest(w, err)
+			return
+		}
+		letter := uptask.DeadLetter{
+			DlqID:          failure.DlqID,
+			MessageID:      failure.MessageID,
+			ResponseStatus: failure.Status,
+			ResponseBody:   failure.Body,
+			Retried:        failure.Retried,
+			MaxRetries:     failure.MaxRetries,
+			Raw:            failure.Raw,
+			ReceivedAt:     time.Now(),
+		}
+		cfg.writeResult(w, store.StoreDlqEvent(r.Context(), ce, letter))
+	}
+}
@@ -0,0 +1,112 @@
+package uptaskhttp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userCreated struct{}
+
+func (userCreated) Kind() string { return "Mailer/UserCreated" }
+
+// recordingService records the events it handles.
+type recordingService struct {
+	handled []string
+}
+
+func (s *recordingService) HandleEvent(ctx context.Context, ce cloudevents.Event) error {
+	s.handled = append(s.handled, ce.Type())
+	return nil
+}
+
+// recordingDlq records the dead letters it stores.
+type recordingDlq struct {
+	stored []string
+}
+
+func (s *recordingDlq) StoreDlqEvent(ctx context.Context, ce cloudevents.Event, letter uptask.DeadLetter) error {
+	s.stored = append(s.stored, ce.Type())
+	return nil
+}
+
+// dlqRequest returns a request posting the QStash failure callback of args.
+func dlqRequest(t *testing.T, path string, args uptask.TaskArgs) *http.Request {
+	t.Helper()
+	_, ce := eventRequest(t, path, args)
+	body, err := json.Marshal(ce)
+	require.NoError(t, err)
+	callback, err := json.Marshal(map[string]any{
+		"dlqId":           "dlq-1",
+		"sourceMessageId": "msg-1",
+		"status":          500,
+		"sourceBody":      base64.StdEncoding.EncodeToString(body),
+	})
+	require.NoError(t, err)
+	return httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(callback)))
+}
+
+func TestNewRouter(t *testing.T) {
+	service := &recordingService{}
+	dlq := &recordingDlq{}
+	router := NewRouter(service, WithRouterDlq("/dlq/", dlq))
+
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	task := func(path string, args uptask.TaskArgs) *http.Request {
+		req, _ := eventRequest(t, path, args)
+		return req
+	}
+
+	assert.Equal(t, http.StatusOK, serve(task("/tasks/Greet", greetArgs{})))
+	assert.Equal(t, http.StatusOK, serve(task("/events/Mailer/UserCreated", userCreated{})))
+	assert.Equal(t, []string{"Greet", "Mailer/UserCreated"}, service.handled)
+
+	assert.Equal(t, http.StatusOK, serve(dlqRequest(t, "/dlq/tasks/Greet", greetArgs{})))
+	assert.Equal(t, http.StatusOK, serve(dlqRequest(t, "/dlq/events/Mailer/UserCreated", userCreated{})))
+	assert.Equal(t, []string{"Greet", "Mailer/UserCreated"}, dlq.stored)
+
+	// The kind of the path must match the event type
+	assert.Equal(t, http.StatusBadRequest, serve(task("/tasks/Other", greetArgs{})))
+	assert.Equal(t, http.StatusBadRequest, serve(task("/events/Mailer/UserDeleted", userCreated{})))
+	assert.Equal(t, http.StatusBadRequest, serve(dlqRequest(t, "/dlq/tasks/Other", greetArgs{})))
+	assert.Len(t, service.handled, 2)
+	assert.Len(t, dlq.stored, 2)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(httptest.NewRequest(http.MethodGet, "/tasks/Greet", nil)))
+	assert.Equal(t, http.StatusNotFound, serve(task("/other/Greet", greetArgs{})))
+}
+
+func TestNewRouterWithoutDlq(t *testing.T) {
+	router := NewRouter(&recordingService{})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, dlqRequest(t, "/dlq/tasks/Greet", greetArgs{}))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewRouterRootDlqPath(t *testing.T) {
+	for _, path := range []string{"/", ""} {
+		service := &recordingService{}
+		dlq := &recordingDlq{}
+		var router http.Handler
+		require.NotPanics(t, func() { router = NewRouter(service, WithRouterDlq(path, dlq)) })
+
+		req, _ := eventRequest(t, "/tasks/Greet", greetArgs{})
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		router.ServeHTTP(httptest.NewRecorder(), dlqRequest(t, DefaultDlqPath+"/tasks/Greet", greetArgs{}))
+		assert.Equal(t, []string{"Greet"}, service.handled)
+		assert.Equal(t, []string{"Greet"}, dlq.stored)
+	}
+}
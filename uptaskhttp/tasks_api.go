@@ -1,48 +1,409 @@
 package uptaskhttp
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/mscno/uptask"
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
+
+	"github.com/mscno/uptask"
 )
 
-type taskApi struct {
+// KindLister lists the task kinds handled by a service, such as *uptask.TaskService.
+type KindLister interface {
+	RegisteredKinds() []uptask.RegisteredKind
+}
+
+// attemptLister is implemented by stores that keep the attempts of each execution.
+type attemptLister interface {
+	ListTaskAttempts(ctx context.Context, taskID string) ([]uptask.TaskAttempt, error)
+}
+
+// RequestHeader must be set, to any value, on the requests of TaskApi that change
+// tasks. Browsers only send custom headers cross-origin after a CORS preflight, so
+// other sites cannot forge these requests with plain forms or fetches.
+const RequestHeader = "X-Uptask-Request"
+
+// TaskApi is a JSON admin API over the tasks of a store. Errors are returned with
+// their HTTP status as {"error": {"code": "...", "message": "..."}}.
+type TaskApi struct {
 	client *uptask.TaskClient
 	store  uptask.TaskStore
+	kinds  KindLister
 }
 
-func NewTaskApi(client *uptask.TaskClient) *taskApi {
-	return &taskApi{client: client}
+type TaskApiOption func(*TaskApi)
+
+// WithKinds serves the kinds listed by kinds, usually the TaskService, on GET /kinds.
+// A kind filter then matches the tasks stored under the kind and its aliases, and
+// tasks are reported under the current kind of their handler.
+func WithKinds(kinds KindLister) TaskApiOption {
+	return func(a *TaskApi) {
+		a.kinds = kinds
+	}
+}
+
+// NewTaskApi returns an admin API reading tasks from store and retrying them with
+// client, which should use the same store.
+func NewTaskApi(client *uptask.TaskClient, store uptask.TaskStore, opts ...TaskApiOption) *TaskApi {
+	a := &TaskApi{client: client, store: store}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Handler returns the routes of the API, relative to the path it is mounted on:
+//
+//	GET    /tasks              list tasks, see ListTasks
+//	POST   /tasks/retry        retry the failed and cancelled tasks matching a filter
+//	GET    /tasks/{id}         get a task with its attempts
+//	DELETE /tasks/{id}         delete a task
+//	POST   /tasks/{id}/retry   retry a failed or cancelled task
+//	POST   /tasks/{id}/cancel  cancel a pending task
+//	POST   /tasks/{id}/replay  replay a dead-lettered task
+//	GET    /stats              statistics, if the store implements uptask.StatsStore
+//	GET    /kinds              registered kinds, if configured with WithKinds
+//
+// The POST and DELETE routes are rejected with 403 unless RequestHeader is set.
+//
+// Mount it under a prefix with http.StripPrefix:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", api.Handler()))
+func (a *TaskApi) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", a.ListTasks)
+	mux.HandleFunc("POST /tasks/retry", requireRequestHeader(a.RetryTasks))
+	mux.HandleFunc("GET /tasks/{id}", a.GetTask)
+	mux.HandleFunc("DELETE /tasks/{id}", requireRequestHeader(a.DeleteTask))
+	mux.HandleFunc("POST /tasks/{id}/retry", requireRequestHeader(a.RetryTask))
+	mux.HandleFunc("POST /tasks/{id}/cancel", requireRequestHeader(a.CancelTask))
+	mux.HandleFunc("POST /tasks/{id}/replay", requireRequestHeader(a.ReplayTask))
+	mux.HandleFunc("GET /stats", a.Stats)
+	mux.HandleFunc("GET /kinds", a.Kinds)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such route: "+r.Method+" "+r.URL.Path)
+	})
+	return mux
 }
 
 type ListTasksResponse struct {
 	Tasks []*uptask.TaskExecution `json:"tasks"`
+	// NextCursor continues the listing after the returned tasks. It is empty on the
+	// last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
-func (a *taskApi) ListTasks(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var limit = 100
-	limitQueryParam := r.URL.Query().Get("limit")
-	if limitQueryParam != "" {
-		limit, err = strconv.Atoi(limitQueryParam)
+// ListTasks lists tasks newest first, filtered by the query parameters status (one of
+// the uptask.TaskStatus values), kind, queue, tag (repeatable), schedule_id, and from
+// and to in RFC 3339. Pages hold limit tasks, 100 by default, and cursor continues from
+// the next_cursor of a previous page.
+func (a *TaskApi) ListTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r, a.kinds)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	tasks, err := a.store.ListTaskExecutions(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	canonicalKinds(a.kinds, tasks...)
+	resp := ListTasksResponse{Tasks: tasks}
+	if len(tasks) == filter.Limit {
+		resp.NextCursor = uptask.NextTaskCursor(tasks)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type TaskResponse struct {
+	*uptask.TaskExecution
+	// Attempts are listed for stores that keep them, such as SQLiteTaskStore.
+	Attempts []uptask.TaskAttempt `json:"attempts,omitempty"`
+}
+
+func (a *TaskApi) GetTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := a.getTask(w, r)
+	if !ok {
+		return
+	}
+	resp := TaskResponse{TaskExecution: task}
+	if lister, ok := a.store.(attemptLister); ok {
+		attempts, err := lister.ListTaskAttempts(r.Context(), task.ID)
 		if err != nil {
-			http.Error(w, "invalid limit", http.StatusBadRequest)
+			writeError(w, http.StatusInternalServerError, "internal", err.Error())
 			return
 		}
+		resp.Attempts = attempts
 	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *TaskApi) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.getTask(w, r); !ok {
+		return
+	}
+	if err := a.store.DeleteTaskExecution(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type RetryResponse struct {
+	// IDs are the IDs of the started copies of the retried tasks.
+	IDs []string `json:"ids"`
+}
 
-	tasks, err := a.store.GetMostRecentTaskExecutions(r.Context(), limit)
+// RetryTask starts a copy of a failed or cancelled task, see uptask.TaskClient.RetryTask.
+func (a *TaskApi) RetryTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.getTask(w, r); !ok {
+		return
+	}
+	id, err := a.client.RetryTask(r.Context(), r.PathValue("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeTaskError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusAccepted, RetryResponse{IDs: []string{id}})
+}
 
-	resp := ListTasksResponse{Tasks: tasks}
-	err = json.NewEncoder(w).Encode(resp)
+// RetryTasks starts a copy of every failed or cancelled task matching the filter of
+// ListTasks, up to limit tasks if set. If a retry fails, the error response also
+// lists the ids of the copies started before it.
+func (a *TaskApi) RetryTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r, a.kinds)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	ids, err := a.client.RetryTasks(r.Context(), filter)
+	if err != nil && len(ids) > 0 {
+		// Report the tasks retried before the failure, so they are not retried twice
+		status, code := taskErrorStatus(err)
+		writeJSON(w, status, retryErrorResponse{
+			errorResponse: errorResponse{Error: apiError{Code: code, Message: err.Error()}},
+			IDs:           ids,
+		})
+		return
+	} else if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, RetryResponse{IDs: append([]string{}, ids...)})
+}
+
+// CancelTask cancels a pending task and returns it, see uptask.TaskClient.CancelTask.
+func (a *TaskApi) CancelTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.getTask(w, r); !ok {
+		return
+	}
+	if err := a.client.CancelTask(r.Context(), r.PathValue("id")); err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	task, ok := a.getTask(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, task)
+}
+
+// ReplayTask publishes a dead-lettered task again with a fresh retry budget, and
+// responds with the reset task.
+func (a *TaskApi) ReplayTask(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.getTask(w, r); !ok {
+		return
+	}
+	if err := a.client.ReplayDeadLetter(r.Context(), r.PathValue("id")); err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	task, ok := a.getTask(w, r)
+	if !ok {
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, task)
+}
+
+// Stats serves the statistics of the store, see HandleStats.
+func (a *TaskApi) Stats(w http.ResponseWriter, r *http.Request) {
+	store, ok := a.store.(uptask.StatsStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "not_implemented", "task store does not keep statistics")
+		return
+	}
+	HandleStats(store)(w, r)
+}
+
+type KindsResponse struct {
+	Kinds []uptask.RegisteredKind `json:"kinds"`
+}
+
+func (a *TaskApi) Kinds(w http.ResponseWriter, r *http.Request) {
+	if a.kinds == nil {
+		writeError(w, http.StatusNotImplemented, "not_implemented", "registered kinds are not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, KindsResponse{Kinds: a.kinds.RegisteredKinds()})
+}
+
+// requireRequestHeader rejects the requests missing RequestHeader, which browsers do
+// not let other origins set without a CORS preflight.
+func requireRequestHeader(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(RequestHeader) == "" {
+			writeError(w, http.StatusForbidden, "forbidden", "missing "+RequestHeader+" header")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getTask reads the task of the id path value, under the kind of its handler, writing
+// the error response and returning false if it does not exist.
+func (a *TaskApi) getTask(w http.ResponseWriter, r *http.Request) (*uptask.TaskExecution, bool) {
+	id := r.PathValue("id")
+	exists, err := a.store.TaskExists(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return nil, false
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "not_found", "task not found: "+id)
+		return nil, false
+	}
+	task, err := a.store.GetTaskExecution(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return nil, false
+	}
+	canonicalKinds(a.kinds, task)
+	return task, true
+}
+
+// parseTaskFilter reads a task filter from the query parameters of r. If kinds is not
+// nil, the kind filter also matches the other kinds of its handler.
+func parseTaskFilter(r *http.Request, kinds KindLister) (uptask.TaskFilter, error) {
+	var filter uptask.TaskFilter
+	var err error
+	params := r.URL.Query()
+	if status := params.Get("status"); status != "" {
+		s := uptask.TaskStatus(status)
+		switch s {
+		case uptask.TaskStatusPending, uptask.TaskStatusRunning, uptask.TaskStatusSuccess,
+			uptask.TaskStatusFailed, uptask.TaskStatusCancelled:
+		default:
+			return filter, errors.New("invalid status")
+		}
+		filter.Status = &s
+	}
+	if kind := params.Get("kind"); kind != "" {
+		filter.Kind = kind
+		if registered, ok := registeredKind(kinds, kind); ok {
+			// Tasks stored before a handler was renamed keep its old kind
+			filter.Kind = ""
+			filter.Kinds = append([]string{registered.Kind}, registered.Aliases...)
+		}
+	}
+	filter.Queue = params.Get("queue")
+	filter.Tags = params["tag"]
+	filter.ScheduleID = params.Get("schedule_id")
+	filter.Cursor = params.Get("cursor")
+	if from := params.Get("from"); from != "" {
+		if filter.FromDate, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, errors.New("invalid from")
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if filter.ToDate, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, errors.New("invalid to")
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return filter, errors.New("invalid limit")
+		}
+	}
+	return filter, nil
+}
+
+// registeredKind returns the kind of kinds registered under kind or one of its aliases.
+func registeredKind(kinds KindLister, kind string) (uptask.RegisteredKind, bool) {
+	if kinds == nil {
+		return uptask.RegisteredKind{}, false
+	}
+	for _, registered := range kinds.RegisteredKinds() {
+		if registered.Kind == kind || slices.Contains(registered.Aliases, kind) {
+			return registered, true
+		}
+	}
+	return uptask.RegisteredKind{}, false
+}
+
+// canonicalKinds replaces the aliased kinds of tasks with the kinds of their handlers.
+func canonicalKinds(kinds KindLister, tasks ...*uptask.TaskExecution) {
+	if kinds == nil {
+		return
+	}
+	aliases := make(map[string]string)
+	for _, registered := range kinds.RegisteredKinds() {
+		for _, alias := range registered.Aliases {
+			aliases[alias] = registered.Kind
+		}
+	}
+	for _, task := range tasks {
+		if kind, ok := aliases[task.TaskKind]; ok {
+			task.TaskKind = kind
+		}
+	}
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// retryErrorResponse is the error response of RetryTasks once some tasks were retried.
+type retryErrorResponse struct {
+	errorResponse
+	IDs []string `json:"ids"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+// writeTaskError writes the response of an error returned by the task client.
+func writeTaskError(w http.ResponseWriter, err error) {
+	status, code := taskErrorStatus(err)
+	writeError(w, status, code, err.Error())
+}
+
+// taskErrorStatus returns the status and error code of an error returned by the task
+// client.
+func taskErrorStatus(err error) (int, string) {
+	if errors.Is(err, uptask.ErrTaskNotRetryable) || errors.Is(err, uptask.ErrTaskNotCancellable) ||
+		errors.Is(err, uptask.ErrTaskNotDeadLettered) {
+		return http.StatusConflict, "conflict"
+	}
+	return http.StatusInternalServerError, "internal"
 }
@@ -0,0 +1,244 @@
+package uptaskhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attemptStore keeps a single attempt for every execution.
+type attemptStore struct {
+	*uptask.MemoryTaskStore
+}
+
+func (s attemptStore) ListTaskAttempts(ctx context.Context, taskID string) ([]uptask.TaskAttempt, error) {
+	return []uptask.TaskAttempt{{Attempt: 1, Status: uptask.TaskStatusFailed}}, nil
+}
+
+// serveApi serves a request to the API of store and decodes its JSON response into v,
+// if not nil.
+func serveApi(t *testing.T, store uptask.TaskStore, method, path string, v any) int {
+	t.Helper()
+	client := uptask.NewTaskClient(nopTransport{}, uptask.WithClientStore(store))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(RequestHeader, "1")
+	NewTaskApi(client, store).Handler().ServeHTTP(rec, req)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if v != nil {
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(v))
+	}
+	return rec.Code
+}
+
+func createTasks(t *testing.T, store uptask.TaskStore, statuses map[string]uptask.TaskStatus) {
+	t.Helper()
+	now := time.Now()
+	for id, status := range statuses {
+		require.NoError(t, store.CreateTaskExecution(context.Background(), &uptask.TaskExecution{
+			ID: id, TaskKind: "Greet", Status: status, Args: map[string]any{}, CreatedAt: now,
+		}))
+	}
+}
+
+func TestTaskApiListTasks(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{
+		"failed":  uptask.TaskStatusFailed,
+		"pending": uptask.TaskStatusPending,
+	})
+
+	var resp ListTasksResponse
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodGet, "/tasks", &resp))
+	assert.Len(t, resp.Tasks, 2)
+	assert.Empty(t, resp.NextCursor)
+
+	resp = ListTasksResponse{}
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodGet, "/tasks?status=FAILED", &resp))
+	require.Len(t, resp.Tasks, 1)
+	assert.Equal(t, "failed", resp.Tasks[0].ID)
+
+	resp = ListTasksResponse{}
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodGet, "/tasks?limit=1", &resp))
+	assert.Len(t, resp.Tasks, 1)
+	assert.NotEmpty(t, resp.NextCursor)
+
+	for _, query := range []string{"status=DONE", "status=failed", "limit=-1", "from=yesterday", "to=1"} {
+		var errResp errorResponse
+		assert.Equal(t, http.StatusBadRequest, serveApi(t, store, http.MethodGet, "/tasks?"+query, &errResp), query)
+		assert.Equal(t, "invalid_request", errResp.Error.Code, query)
+	}
+}
+
+func TestTaskApiGetTask(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{"failed": uptask.TaskStatusFailed})
+
+	var resp TaskResponse
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodGet, "/tasks/failed", &resp))
+	assert.Equal(t, "failed", resp.ID)
+	assert.Empty(t, resp.Attempts)
+
+	resp = TaskResponse{}
+	assert.Equal(t, http.StatusOK, serveApi(t, attemptStore{store}, http.MethodGet, "/tasks/failed", &resp))
+	assert.Equal(t, []uptask.TaskAttempt{{Attempt: 1, Status: uptask.TaskStatusFailed}}, resp.Attempts)
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusNotFound, serveApi(t, store, http.MethodGet, "/tasks/missing", &errResp))
+	assert.Equal(t, "not_found", errResp.Error.Code)
+}
+
+func TestTaskApiRetryAndCancel(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{
+		"failed":  uptask.TaskStatusFailed,
+		"pending": uptask.TaskStatusPending,
+	})
+
+	var retry RetryResponse
+	assert.Equal(t, http.StatusAccepted, serveApi(t, store, http.MethodPost, "/tasks/failed/retry", &retry))
+	require.Len(t, retry.IDs, 1)
+	retried, err := store.GetTaskExecution(context.Background(), retry.IDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusPending, retried.Status)
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusConflict, serveApi(t, store, http.MethodPost, "/tasks/pending/retry", &errResp))
+	assert.Equal(t, "conflict", errResp.Error.Code)
+
+	var task uptask.TaskExecution
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodPost, "/tasks/pending/cancel", &task))
+	assert.Equal(t, uptask.TaskStatusCancelled, task.Status)
+
+	errResp = errorResponse{}
+	assert.Equal(t, http.StatusConflict, serveApi(t, store, http.MethodPost, "/tasks/failed/cancel", &errResp))
+	assert.Equal(t, "conflict", errResp.Error.Code)
+	assert.Equal(t, http.StatusNotFound, serveApi(t, store, http.MethodPost, "/tasks/missing/cancel", nil))
+
+	// Retries the tasks matching the filter
+	retry = RetryResponse{}
+	assert.Equal(t, http.StatusAccepted, serveApi(t, store, http.MethodPost, "/tasks/retry?kind=Greet&status=CANCELLED", &retry))
+	assert.Len(t, retry.IDs, 1)
+	assert.Equal(t, http.StatusBadRequest, serveApi(t, store, http.MethodPost, "/tasks/retry?status=DONE", nil))
+}
+
+// failingTransport accepts n tasks and fails to send the next ones.
+type failingTransport struct {
+	n *int
+}
+
+func (t failingTransport) Send(ctx context.Context, ce cloudevents.Event, opts *uptask.InsertOpts) error {
+	if *t.n == 0 {
+		return errors.New("transport down")
+	}
+	*t.n--
+	return nil
+}
+
+func TestTaskApiRetryTasksReportsPartialRetries(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{
+		"first":  uptask.TaskStatusFailed,
+		"second": uptask.TaskStatusFailed,
+	})
+	accepted := 1
+	client := uptask.NewTaskClient(failingTransport{n: &accepted}, uptask.WithClientStore(store))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/tasks/retry", nil)
+	req.Header.Set(RequestHeader, "1")
+	NewTaskApi(client, store).Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	var resp retryErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "internal", resp.Error.Code)
+	assert.Len(t, resp.IDs, 1)
+}
+
+func TestTaskApiRequiresRequestHeader(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{"failed": uptask.TaskStatusFailed})
+	api := NewTaskApi(uptask.NewTaskClient(nopTransport{}, uptask.WithClientStore(store)), store).Handler()
+
+	for _, route := range []string{"POST /tasks/retry", "POST /tasks/failed/retry", "POST /tasks/failed/cancel",
+		"POST /tasks/failed/replay", "DELETE /tasks/failed"} {
+		method, path, _ := strings.Cut(route, " ")
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader("status=FAILED"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		api.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, route)
+	}
+	task, err := store.GetTaskExecution(context.Background(), "failed")
+	require.NoError(t, err)
+	assert.Equal(t, uptask.TaskStatusFailed, task.Status)
+}
+
+func TestTaskApiStats(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{"failed": uptask.TaskStatusFailed})
+
+	var stats uptask.TaskStats
+	assert.Equal(t, http.StatusOK, serveApi(t, store, http.MethodGet, "/stats", &stats))
+	assert.Equal(t, int64(1), stats.ByStatus[uptask.TaskStatusFailed])
+
+	now := time.Now().UTC()
+	for _, query := range []string{"from=yesterday", "bucket=1m&from=" + now.Add(-48*time.Hour).Format(time.RFC3339),
+		"from=" + now.Format(time.RFC3339) + "&to=" + now.Add(-time.Hour).Format(time.RFC3339)} {
+		var errResp errorResponse
+		assert.Equal(t, http.StatusBadRequest, serveApi(t, store, http.MethodGet, "/stats?"+query, &errResp), query)
+		assert.Equal(t, "invalid_request", errResp.Error.Code, query)
+	}
+
+	var errResp errorResponse
+	assert.Equal(t, http.StatusNotImplemented, serveApi(t, pollingStore{store}, http.MethodGet, "/stats", &errResp))
+	assert.Equal(t, "not_implemented", errResp.Error.Code)
+}
+
+type greetHandler struct {
+	uptask.TaskHandlerDefaults[greetArgs]
+}
+
+func (h *greetHandler) ProcessTask(ctx context.Context, task *uptask.Container[greetArgs]) error {
+	return nil
+}
+
+func TestTaskApiResolvesKindAliases(t *testing.T) {
+	store := uptask.NewMemoryTaskStore()
+	createTasks(t, store, map[string]uptask.TaskStatus{"current": uptask.TaskStatusFailed})
+	// Finished before the handler was renamed from Hello
+	require.NoError(t, store.CreateTaskExecution(context.Background(), &uptask.TaskExecution{
+		ID: "renamed", TaskKind: "Hello", Status: uptask.TaskStatusSuccess, Args: map[string]any{}, CreatedAt: time.Now(),
+	}))
+	tsvc := uptask.NewTaskService(nopTransport{}, uptask.WithStore(store))
+	uptask.AddTaskHandler(tsvc, &greetHandler{}, uptask.WithKindAliases("Hello"))
+	api := NewTaskApi(tsvc.Client(), store, WithKinds(tsvc)).Handler()
+
+	for _, kind := range []string{"Hello", "Greet"} {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks?kind="+kind, nil))
+		var resp ListTasksResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		require.Len(t, resp.Tasks, 2, kind)
+		for _, task := range resp.Tasks {
+			assert.Equal(t, "Greet", task.TaskKind, kind)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks/renamed", nil))
+	var resp TaskResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "Greet", resp.TaskKind)
+}
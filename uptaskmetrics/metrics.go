@@ -0,0 +1,163 @@
+// Package uptaskmetrics records metrics of task services and exposes them in the
+// Prometheus text format.
+package uptaskmetrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mscno/uptask"
+)
+
+// DefaultBuckets are the bounds in seconds of the duration histograms.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// unknownErrorCode labels transport errors that are not uptask.UpstashTaskError.
+const unknownErrorCode = "UNKNOWN"
+
+type Option func(*Metrics)
+
+// WithBuckets sets the bounds in seconds of the duration histograms. Defaults to
+// DefaultBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(m *Metrics) {
+		m.buckets = buckets
+	}
+}
+
+// Metrics records the metrics of task services through their hooks:
+//
+//	uptask_tasks_enqueued_total{kind,queue}
+//	uptask_tasks_processed_total{kind,queue}
+//	uptask_tasks_succeeded_total{kind,queue}
+//	uptask_tasks_failed_total{kind,queue}
+//	uptask_tasks_snoozed_total{kind,queue}
+//	uptask_task_duration_seconds{kind,queue}
+//	uptask_task_queue_lag_seconds{kind,queue}
+//	uptask_transport_send_duration_seconds{kind,queue}
+//	uptask_transport_send_errors_total{code}
+//	uptask_store_operation_duration_seconds{op}
+//	uptask_store_operation_errors_total{op}
+type Metrics struct {
+	mux     sync.Mutex
+	buckets []float64
+	metrics []metric
+
+	enqueued     *counterVec
+	processed    *counterVec
+	outcomes     map[uptask.TaskOutcome]*counterVec
+	duration     *histogramVec
+	lag          *histogramVec
+	sendDuration *histogramVec
+	sendErrors   *counterVec
+	storeOps     *histogramVec
+	storeErrors  *counterVec
+}
+
+func New(opts ...Option) *Metrics {
+	m := &Metrics{buckets: DefaultBuckets}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.enqueued = newCounterVec("uptask_tasks_enqueued_total", "Tasks enqueued.", "kind", "queue")
+	m.processed = newCounterVec("uptask_tasks_processed_total", "Tasks processed by a handler.", "kind", "queue")
+	m.outcomes = map[uptask.TaskOutcome]*counterVec{
+		uptask.TaskSucceeded: newCounterVec("uptask_tasks_succeeded_total", "Tasks processed successfully.", "kind", "queue"),
+		uptask.TaskFailed:    newCounterVec("uptask_tasks_failed_total", "Tasks whose handler failed.", "kind", "queue"),
+		uptask.TaskSnoozed:   newCounterVec("uptask_tasks_snoozed_total", "Tasks snoozed by their handler.", "kind", "queue"),
+	}
+	m.duration = newHistogramVec("uptask_task_duration_seconds", "Time handlers took to process tasks.", m.buckets, "kind", "queue")
+	m.lag = newHistogramVec("uptask_task_queue_lag_seconds", "Time between the creation or scheduled time of tasks and their receipt.", m.buckets, "kind", "queue")
+	m.sendDuration = newHistogramVec("uptask_transport_send_duration_seconds", "Time the transport took to send tasks.", m.buckets, "kind", "queue")
+	m.sendErrors = newCounterVec("uptask_transport_send_errors_total", "Tasks the transport failed to send, by error code.", "code")
+	m.storeOps = newHistogramVec("uptask_store_operation_duration_seconds", "Time task store operations took.", m.buckets, "op")
+	m.storeErrors = newCounterVec("uptask_store_operation_errors_total", "Task store operations that failed.", "op")
+
+	m.metrics = []metric{
+		m.enqueued, m.processed,
+		m.outcomes[uptask.TaskSucceeded], m.outcomes[uptask.TaskFailed], m.outcomes[uptask.TaskSnoozed],
+		m.duration, m.lag, m.sendDuration, m.sendErrors, m.storeOps, m.storeErrors,
+	}
+	return m
+}
+
+// Hooks returns the hooks recording the metrics, to pass to uptask.WithHooks or
+// uptask.WithClientHooks.
+func (m *Metrics) Hooks() uptask.Hooks {
+	return uptask.Hooks{
+		OnEnqueue: func(kind, queue string, err error) {
+			if err != nil {
+				return
+			}
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.enqueued.add(1, kind, queue)
+		},
+		OnSend: func(kind, queue string, d time.Duration, err error) {
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.sendDuration.observe(d.Seconds(), kind, queue)
+			if err != nil {
+				m.sendErrors.add(1, errorCode(err))
+			}
+		},
+		OnTaskStart: func(kind, queue string, lag time.Duration) {
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.lag.observe(lag.Seconds(), kind, queue)
+		},
+		OnTaskDone: func(kind, queue string, d time.Duration, outcome uptask.TaskOutcome) {
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.processed.add(1, kind, queue)
+			if counter, ok := m.outcomes[outcome]; ok {
+				counter.add(1, kind, queue)
+			}
+			m.duration.observe(d.Seconds(), kind, queue)
+		},
+		OnStoreOp: func(op string, d time.Duration, err error) {
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.storeOps.observe(d.Seconds(), op)
+			if err != nil {
+				m.storeErrors.add(1, op)
+			}
+		},
+	}
+}
+
+// errorCode returns the code of a transport error.
+func errorCode(err error) string {
+	var upstashErr *uptask.UpstashTaskError
+	if errors.As(err, &upstashErr) {
+		return string(upstashErr.Code)
+	}
+	return unknownErrorCode
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	m.mux.Lock()
+	for _, metric := range m.metrics {
+		if err := metric.write(&buf); err != nil {
+			m.mux.Unlock()
+			return 0, err
+		}
+	}
+	m.mux.Unlock()
+	return buf.WriteTo(w)
+}
+
+// Handler serves the metrics in the Prometheus text format, such as on /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = m.WriteTo(w)
+	})
+}
@@ -0,0 +1,100 @@
+package uptaskmetrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mscno/uptask"
+	"github.com/mscno/uptask/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type greetArgs struct {
+	Fail bool `json:"fail"`
+}
+
+func (greetArgs) Kind() string { return "Greet" }
+
+type greetHandler struct {
+	uptask.TaskHandlerDefaults[greetArgs]
+}
+
+func (h *greetHandler) ProcessTask(ctx context.Context, task *uptask.Container[greetArgs]) error {
+	if task.Args.Fail {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+// loopbackTransport hands sent tasks to a service right away, with the extensions the
+// transport and HTTP layer set on received events.
+type loopbackTransport struct {
+	service *uptask.TaskService
+	err     error
+}
+
+func (t *loopbackTransport) Send(ctx context.Context, ce cloudevents.Event, opts *uptask.InsertOpts) error {
+	if t.err != nil {
+		return t.err
+	}
+	events.SetQueue(&ce, opts.Queue)
+	events.SetScheduled(&ce, false)
+	events.SetQstashMessageID(&ce, "msg-"+ce.ID())
+	_ = t.service.HandleEvent(ctx, ce)
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	metrics := New(WithBuckets([]float64{1}))
+	transport := &loopbackTransport{}
+	tsvc := uptask.NewTaskService(transport,
+		uptask.WithStore(uptask.NewMemoryTaskStore()),
+		uptask.WithHooks(metrics.Hooks()),
+		uptask.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	transport.service = tsvc
+	uptask.AddTaskHandler(tsvc, &greetHandler{})
+
+	_, err := tsvc.StartTask(ctx, greetArgs{}, &uptask.InsertOpts{Queue: "mail"})
+	require.NoError(t, err)
+	_, err = tsvc.StartTask(ctx, greetArgs{Fail: true}, &uptask.InsertOpts{Queue: "mail"})
+	require.NoError(t, err)
+	transport.err = uptask.NewUpstashTaskError(uptask.ErrDeliveryFailed, "send", "unreachable", nil)
+	_, err = tsvc.StartTask(ctx, greetArgs{}, nil)
+	require.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE uptask_tasks_enqueued_total counter",
+		`uptask_tasks_enqueued_total{kind="Greet",queue="mail"} 2`,
+		`uptask_tasks_processed_total{kind="Greet",queue="mail"} 2`,
+		`uptask_tasks_succeeded_total{kind="Greet",queue="mail"} 1`,
+		`uptask_tasks_failed_total{kind="Greet",queue="mail"} 1`,
+		"# TYPE uptask_task_duration_seconds histogram",
+		`uptask_task_duration_seconds_bucket{kind="Greet",queue="mail",le="1"} 2`,
+		`uptask_task_duration_seconds_bucket{kind="Greet",queue="mail",le="+Inf"} 2`,
+		`uptask_task_duration_seconds_count{kind="Greet",queue="mail"} 2`,
+		`uptask_task_queue_lag_seconds_count{kind="Greet",queue="mail"} 2`,
+		`uptask_transport_send_duration_seconds_count{kind="Greet",queue=""} 1`,
+		`uptask_transport_send_errors_total{code="DELIVERY_FAILED"} 1`,
+		`uptask_store_operation_duration_seconds_count{op="create"} 3`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, `uptask_store_operation_errors_total{op="update_status"}`)
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, `{kind="a\"b\\c\nd"}`, formatLabels([]string{"kind"}, []string{"a\"b\\c\nd"}))
+	assert.Equal(t, "", formatLabels(nil, nil))
+}
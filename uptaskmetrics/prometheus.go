@@ -0,0 +1,152 @@
+package uptaskmetrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metric is a family of series written in the Prometheus text format.
+type metric interface {
+	write(w io.Writer) error
+}
+
+// counterVec is a counter with one series per combination of label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64 // joined label values -> value
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	c.values[joinLabels(labelValues)] += v
+}
+
+func (c *counterVec) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(c.values) {
+		labels := formatLabels(c.labels, splitLabels(key, len(c.labels)))
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatValue(c.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// histogramVec is a histogram with one series per combination of label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogram // joined label values -> histogram
+}
+
+type histogram struct {
+	counts []uint64 // Cumulative count of each bucket
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	key := joinLabels(labelValues)
+	series, ok := h.values[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += v
+}
+
+func (h *histogramVec) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(h.values) {
+		values := splitLabels(key, len(h.labels))
+		series := h.values[key]
+		bucketNames := append(append([]string(nil), h.labels...), "le")
+		bucketValues := append(append([]string(nil), values...), "")
+		for i, bound := range h.buckets {
+			bucketValues[len(values)] = formatValue(bound)
+			labels := formatLabels(bucketNames, bucketValues)
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, series.counts[i]); err != nil {
+				return err
+			}
+		}
+		bucketValues[len(values)] = "+Inf"
+		labels := formatLabels(bucketNames, bucketValues)
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, series.count); err != nil {
+			return err
+		}
+		labels = formatLabels(h.labels, values)
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.name, labels, formatValue(series.sum), h.name, labels, series.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelSep separates label values in the keys of series, as it cannot appear in
+// valid UTF-8 label values.
+const labelSep = "\xff"
+
+func joinLabels(values []string) string {
+	return strings.Join(values, labelSep)
+}
+
+func splitLabels(key string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.Split(key, labelSep)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
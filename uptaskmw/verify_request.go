@@ -18,8 +18,11 @@ import (
 // Config holds the configuration for the middleware
 type Config struct {
 	SigningKey string
-	Issuer     string
-	Logger     *slog.Logger
+	// NextSigningKey, if set, is tried when SigningKey does not verify a request, so
+	// that requests keep being accepted while QStash rolls its signing keys.
+	NextSigningKey string
+	Issuer         string
+	Logger         *slog.Logger
 }
 
 // VerifyMiddleware creates a standard http middleware function that verifies
@@ -54,6 +57,9 @@ func VerifyMiddlewareWithConfig(config Config) func(http.Handler) http.Handler {
 
 			// Verify the signature
 			err = verifySignature(bodyBytes, r.Header.Get("Upstash-Signature"), config.SigningKey, config.Issuer)
+			if err != nil && config.NextSigningKey != "" {
+				err = verifySignature(bodyBytes, r.Header.Get("Upstash-Signature"), config.NextSigningKey, config.Issuer)
+			}
 			if err != nil {
 				logger.Error(err.Error(), "error", err)
 				httpErr, ok := err.(*httpError)
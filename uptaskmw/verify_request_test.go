@@ -413,3 +413,42 @@ func TestVerifyMiddleware_LargeBody(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 }
+
+func TestVerifyMiddleware_NextSigningKey(t *testing.T) {
+	const nextSigningKey = "next-signing-key-must-be-at-least-32-bytes"
+	testBody := []byte(`{"test":"data"}`)
+	token, err := createJWT(testBody, nextSigningKey, testIssuer, 1*time.Hour, -1*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create test JWT: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		nextKey string
+		want    int
+	}{
+		{"accepted with next key", nextSigningKey, http.StatusOK},
+		{"rejected without next key", "", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/test", bytes.NewBuffer(testBody))
+			req.Header.Set("Upstash-Signature", token)
+			rr := httptest.NewRecorder()
+
+			handler := &testHandler{called: false}
+			middleware := VerifyMiddlewareWithConfig(Config{
+				SigningKey:     testSigningKey,
+				NextSigningKey: tt.nextKey,
+				Issuer:         testIssuer,
+			})
+			middleware(handler).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.want {
+				t.Errorf("Handler returned wrong status code: got %v want %v", status, tt.want)
+			}
+			if handler.called != (tt.want == http.StatusOK) {
+				t.Errorf("Handler called: got %v", handler.called)
+			}
+		})
+	}
+}